@@ -0,0 +1,214 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"kns-indexer/keeta"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config is the effective configuration of the indexer and API. Every field can be set in the config file under its
+// yaml key, through its env var and through a flag named after the yaml key, which take precedence in that order.
+type Config struct {
+	DatabaseURL string `yaml:"database_url" env:"DATABASE_URL" secret:"true" usage:"PostgreSQL connection string, sqlite://path or memory://"`
+
+	API     API     `yaml:"api"`
+	Keeta   Keeta   `yaml:"keeta"`
+	Indexer Indexer `yaml:"indexer"`
+	Fee     Fee     `yaml:"fee"`
+	Devnet  Devnet  `yaml:"devnet"`
+	Outbox  Outbox  `yaml:"outbox"`
+}
+
+type API struct {
+	ListenAddr  string `yaml:"listen_addr" env:"LISTEN_ADDR" usage:"address the API listens on"`
+	IPFSGateway string `yaml:"ipfs_gateway" env:"IPFS_GATEWAY" usage:"gateway username subdomains are proxied to, followed by the CID"`
+	// GatewayDomain is empty for the legacy gateway resolving the longest name in front of the last label of any host.
+	GatewayDomain string `yaml:"gateway_domain" env:"GATEWAY_DOMAIN" usage:"domain whose subdomains are names proxied to the IPFS gateway, e.g. blog.alice under kns.example"`
+}
+
+type Keeta struct {
+	BaseURL  string   `yaml:"base_url" env:"KEETA_BASE_URL" secret:"true" usage:"node API base URL"`
+	BaseURLs []string `yaml:"base_urls" env:"KEETA_BASE_URLS" secret:"true" usage:"nodes history is cross-checked between, base_url alone when empty"`
+	// Quorum is resolved to a majority of BaseURLs when zero.
+	Quorum          int    `yaml:"quorum" env:"KEETA_QUORUM" usage:"nodes that have to agree on a history page, a majority when 0"`
+	KeetoolsBaseURL string `yaml:"keetools_base_url" env:"KEETOOLS_BASE_URL" usage:"Keetools API base URL"`
+}
+
+type Indexer struct {
+	LaunchDate       string        `yaml:"launch_date" env:"LAUNCH_DATE" usage:"date history is fetched from"`
+	PageLimit        int           `yaml:"page_limit" env:"PAGE_LIMIT" usage:"vote staples per history page"`
+	PollInterval     time.Duration `yaml:"poll_interval" env:"POLL_INTERVAL" usage:"delay between polls of the chain head"`
+	PendingTimeout   time.Duration `yaml:"pending_timeout" env:"PENDING_TIMEOUT" usage:"time after which a block that is not final is rolled back"`
+	FinalityQuorum   int           `yaml:"finality_quorum" env:"FINALITY_QUORUM" usage:"distinct trusted representatives whose votes make a vote staple final, a majority of representatives when 0"`
+	VerifySignatures bool          `yaml:"verify_signatures" env:"VERIFY_SIGNATURES" usage:"verify hashes, signatures and votes locally"`
+	Representatives  []string      `yaml:"representatives" env:"REPRESENTATIVES" usage:"representative accounts whose votes are trusted, only their votes count toward finality"`
+	MaxFailures      int           `yaml:"max_failures" env:"INDEXER_MAX_FAILURES" usage:"failed runs in a row after which the instance is not ready"`
+	BackfillPages    int           `yaml:"backfill_pages" env:"BACKFILL_PAGES" usage:"pages applied per transaction while catching up, below 2 to disable"`
+	// Activations is empty for the activation timestamps of the protocol versions every indexer agrees on.
+	Activations string `yaml:"activations" env:"PROTOCOL_ACTIVATIONS" usage:"version=timestamp pairs moving the RFC 3339 activation of protocol versions, for test networks, e.g. 2=2026-01-01T00:00:00Z"`
+	// InstanceID is resolved to the hostname when empty.
+	InstanceID  string        `yaml:"instance_id" env:"INSTANCE_ID" usage:"name of this replica in the leader election, the hostname when empty"`
+	LeaderLease time.Duration `yaml:"leader_lease" env:"LEADER_LEASE" usage:"time after which another replica takes over the indexer from a leader that stopped renewing"`
+}
+
+// Fee configures the registration fee, which is disabled when TreasuryAddress is empty.
+type Fee struct {
+	ActivatedAt     string `yaml:"activated_at" env:"FEE_ACTIVATED_AT" usage:"RFC 3339 timestamp from which the fee is enforced"`
+	TreasuryAddress string `yaml:"treasury_address" env:"FEE_TREASURY_ADDRESS" usage:"account fees are sent to"`
+	BaseToken       string `yaml:"base_token" env:"FEE_BASE_TOKEN" usage:"token fees are paid in"`
+	Tiers           string `yaml:"tiers" env:"FEE_TIERS" usage:"maxLength:amount pairs separated by commas, e.g. 3:1000000,32:1000"`
+}
+
+// Devnet configures the simulated ledger of the devnet command.
+type Devnet struct {
+	ListenAddr string `yaml:"listen_addr" env:"DEVNET_LISTEN_ADDR" usage:"address the simulated ledger and its admin API listen on"`
+}
+
+// Outbox configures the relays of the recorded actions to event sinks, which run with the indexer.
+type Outbox struct {
+	Sinks        []string      `yaml:"sinks" env:"OUTBOX_SINKS" secret:"true" usage:"event sinks recorded actions are relayed to: stdout, file:path or an http(s) URL"`
+	BatchSize    int           `yaml:"batch_size" env:"OUTBOX_BATCH_SIZE" usage:"outbox entries delivered to a sink at once"`
+	PollInterval time.Duration `yaml:"poll_interval" env:"OUTBOX_POLL_INTERVAL" usage:"delay between polls of the outbox once a sink is up to date"`
+}
+
+// Default returns the configuration used for everything not set explicitly.
+func Default() Config {
+	return Config{
+		API: API{
+			ListenAddr:  ":8000",
+			IPFSGateway: "https://dweb.link/ipfs/",
+		},
+		Indexer: Indexer{
+			LaunchDate:     "2025-12-02",
+			PageLimit:      100,
+			PollInterval:   time.Second,
+			PendingTimeout: 10 * time.Minute,
+			MaxFailures:    5,
+			BackfillPages:  20,
+			LeaderLease:    15 * time.Second,
+		},
+		Devnet: Devnet{
+			ListenAddr: ":8001",
+		},
+		Outbox: Outbox{
+			BatchSize:    100,
+			PollInterval: time.Second,
+		},
+	}
+}
+
+// Resolve fills in the values derived from other ones, which Load already does.
+func (c *Config) Resolve() {
+	if len(c.Keeta.BaseURLs) == 0 && c.Keeta.BaseURL != "" {
+		c.Keeta.BaseURLs = []string{c.Keeta.BaseURL}
+	}
+	if c.Keeta.Quorum == 0 {
+		c.Keeta.Quorum = len(c.Keeta.BaseURLs)/2 + 1
+	}
+	if c.Indexer.FinalityQuorum == 0 {
+		c.Indexer.FinalityQuorum = len(c.Indexer.Representatives)/2 + 1
+	}
+	if c.Indexer.InstanceID == "" {
+		c.Indexer.InstanceID, _ = os.Hostname()
+	}
+}
+
+// Validate reports every invalid value at once.
+func (c Config) Validate() error {
+	var errs []error
+
+	if _, err := url.Parse(c.API.IPFSGateway); err != nil {
+		errs = append(errs, fmt.Errorf("api.ipfs_gateway: %w", err))
+	}
+	if domain := c.API.GatewayDomain; domain != strings.ToLower(domain) || strings.Trim(domain, ".") != domain {
+		errs = append(errs, fmt.Errorf("api.gateway_domain should be a lower case domain like kns.example: %q", domain))
+	}
+
+	if len(c.Keeta.BaseURLs) == 0 {
+		errs = append(errs, errors.New("keeta.base_url or keeta.base_urls is required"))
+	}
+	for _, baseURL := range c.Keeta.BaseURLs {
+		if err := validateURL(baseURL); err != nil {
+			errs = append(errs, fmt.Errorf("keeta.base_urls: %w", err))
+		}
+	}
+	if len(c.Keeta.BaseURLs) > 0 && (c.Keeta.Quorum < 1 || c.Keeta.Quorum > len(c.Keeta.BaseURLs)) {
+		errs = append(errs, fmt.Errorf("keeta.quorum should be between 1 and %d", len(c.Keeta.BaseURLs)))
+	}
+	if err := validateURL(c.Keeta.KeetoolsBaseURL); err != nil {
+		errs = append(errs, fmt.Errorf("keeta.keetools_base_url: %w", err))
+	}
+
+	if _, err := time.Parse(time.DateOnly, c.Indexer.LaunchDate); err != nil {
+		errs = append(errs, fmt.Errorf("indexer.launch_date should be YYYY-MM-DD: %w", err))
+	}
+	if c.Indexer.PageLimit < 1 {
+		errs = append(errs, errors.New("indexer.page_limit should be positive"))
+	}
+	if c.Indexer.PollInterval <= 0 {
+		errs = append(errs, errors.New("indexer.poll_interval should be positive"))
+	}
+	if c.Indexer.PendingTimeout <= 0 {
+		errs = append(errs, errors.New("indexer.pending_timeout should be positive"))
+	}
+	if len(c.Indexer.Representatives) == 0 {
+		errs = append(errs, errors.New("indexer.representatives is required"))
+	}
+	for _, representative := range c.Indexer.Representatives {
+		if _, err := keeta.ParseAccount(representative); err != nil {
+			errs = append(errs, fmt.Errorf("indexer.representatives: %v: %w", representative, err))
+		}
+	}
+	if len(c.Indexer.Representatives) > 0 &&
+		(c.Indexer.FinalityQuorum < 1 || c.Indexer.FinalityQuorum > len(c.Indexer.Representatives)) {
+		errs = append(errs, fmt.Errorf("indexer.finality_quorum should be between 1 and %d", len(c.Indexer.Representatives)))
+	}
+	if c.Indexer.MaxFailures < 1 {
+		errs = append(errs, errors.New("indexer.max_failures should be positive"))
+	}
+	if c.Indexer.BackfillPages < 0 {
+		errs = append(errs, errors.New("indexer.backfill_pages should not be negative"))
+	}
+	if c.Indexer.InstanceID == "" {
+		errs = append(errs, errors.New("indexer.instance_id is required when the hostname is unknown"))
+	}
+	if c.Indexer.LeaderLease < 3*time.Second {
+		errs = append(errs, errors.New("indexer.leader_lease should be at least 3s"))
+	}
+
+	if c.Fee.TreasuryAddress != "" {
+		if _, err := time.Parse(time.RFC3339, c.Fee.ActivatedAt); err != nil {
+			errs = append(errs, fmt.Errorf("fee.activated_at should be RFC 3339 timestamp: %w", err))
+		}
+		if c.Fee.BaseToken == "" {
+			errs = append(errs, errors.New("fee.base_token is required when fee.treasury_address is set"))
+		}
+		if c.Fee.Tiers == "" {
+			errs = append(errs, errors.New("fee.tiers is required when fee.treasury_address is set"))
+		}
+	}
+
+	if c.Outbox.BatchSize < 1 {
+		errs = append(errs, errors.New("outbox.batch_size should be positive"))
+	}
+	if c.Outbox.PollInterval <= 0 {
+		errs = append(errs, errors.New("outbox.poll_interval should be positive"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func validateURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("%q should be absolute URL", s)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// field is a configurable value of Config.
+type field struct {
+	key    string
+	env    string
+	usage  string
+	secret bool
+	value  reflect.Value
+}
+
+// fields lists the configurable values of c in declaration order with their dotted yaml keys.
+func fields(c *Config) []field {
+	var result []field
+	var walk func(prefix string, v reflect.Value)
+	walk = func(prefix string, v reflect.Value) {
+		for i := 0; i < v.NumField(); i++ {
+			structField := v.Type().Field(i)
+			key := prefix + strings.Split(structField.Tag.Get("yaml"), ",")[0]
+			if structField.Type.Kind() == reflect.Struct {
+				walk(key+".", v.Field(i))
+				continue
+			}
+			result = append(result, field{
+				key:    key,
+				env:    structField.Tag.Get("env"),
+				usage:  structField.Tag.Get("usage"),
+				secret: structField.Tag.Get("secret") == "true",
+				value:  v.Field(i),
+			})
+		}
+	}
+	walk("", reflect.ValueOf(c).Elem())
+	return result
+}
+
+// flagName turns a yaml key like indexer.poll_interval into the flag name indexer.poll-interval.
+func flagName(key string) string {
+	return strings.ReplaceAll(key, "_", "-")
+}
+
+// Load builds the configuration from the defaults, the YAML file passed with -config or CONFIG_FILE, env vars and
+// the flags in args, each overriding the previous ones. It returns the arguments left after the flags.
+func Load(args []string) (Config, []string, error) {
+	c := Default()
+
+	flagSet := flag.NewFlagSet("kns-indexer", flag.ContinueOnError)
+	configFile := flagSet.String("config", os.Getenv("CONFIG_FILE"), "YAML config file")
+	flagValues := map[string]string{}
+	for _, f := range fields(&c) {
+		set := func(s string) error {
+			flagValues[f.key] = s
+			return nil
+		}
+		usage := fmt.Sprintf("%v (env %v)", f.usage, f.env)
+		if f.value.Kind() == reflect.Bool {
+			flagSet.BoolFunc(flagName(f.key), usage, set)
+		} else {
+			flagSet.Func(flagName(f.key), usage, set)
+		}
+	}
+	if err := flagSet.Parse(args); err != nil {
+		return Config{}, nil, err
+	}
+
+	if *configFile != "" {
+		data, err := os.ReadFile(*configFile)
+		if err != nil {
+			return Config{}, nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		if err = yaml.UnmarshalStrict(data, &c); err != nil {
+			return Config{}, nil, fmt.Errorf("failed to parse config file %v: %w", *configFile, err)
+		}
+	}
+
+	for _, f := range fields(&c) {
+		if s := os.Getenv(f.env); s != "" {
+			if err := setValue(f.value, s); err != nil {
+				return Config{}, nil, fmt.Errorf("invalid %v: %w", f.env, err)
+			}
+		}
+	}
+
+	for _, f := range fields(&c) {
+		if s, ok := flagValues[f.key]; ok {
+			if err := setValue(f.value, s); err != nil {
+				return Config{}, nil, fmt.Errorf("invalid -%v: %w", flagName(f.key), err)
+			}
+		}
+	}
+
+	c.Resolve()
+
+	return c, flagSet.Args(), nil
+}
+
+// setValue parses s into v, lists are separated by commas.
+func setValue(v reflect.Value, s string) error {
+	switch v.Interface().(type) {
+	case string:
+		v.SetString(s)
+	case int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case []string:
+		var list []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported type %v", v.Type())
+	}
+	return nil
+}
+
+// Redacted returns a copy of c with the secrets hidden, keeping everything but the password and query values of
+// secret URLs.
+func (c Config) Redacted() Config {
+	for _, f := range fields(&c) {
+		if !f.secret {
+			continue
+		}
+		switch value := f.value.Interface().(type) {
+		case string:
+			f.value.SetString(redact(value))
+		case []string:
+			// the copy shares the list with c
+			redacted := make([]string, len(value))
+			for i, item := range value {
+				redacted[i] = redact(item)
+			}
+			f.value.Set(reflect.ValueOf(redacted))
+		}
+	}
+	return c
+}
+
+func redact(s string) string {
+	if s == "" {
+		return s
+	}
+	if u, err := url.Parse(s); err == nil && u.Scheme != "" && u.Host != "" {
+		// API keys are often passed in the query
+		query := u.Query()
+		for key := range query {
+			query[key] = []string{"xxxxx"}
+		}
+		u.RawQuery = query.Encode()
+		return u.Redacted()
+	}
+	return "xxxxx"
+}
+
+// Print writes the effective configuration as YAML with the secrets redacted.
+func (c Config) Print(w io.Writer) error {
+	data, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kns-indexer/config"
+	"kns-indexer/devnet"
+	"kns-indexer/indexer"
+	"kns-indexer/store"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// devnetCommands maps the admin commands of the devnet command to their admin API names and arguments after the
+// account.
+var devnetCommands = map[string]struct {
+	name      string
+	arguments []string
+}{
+	"inscribe":         {"inscribe", []string{"username"}},
+	"transfer":         {"transfer", []string{"username", "to"}},
+	"set-cid":          {"set_cid", []string{"username", "cid"}},
+	"set-primary-name": {"set_primary_name", []string{"username"}},
+	"set-record":       {"set_record", []string{"username", "key", "value"}},
+	"set-address":      {"set_address", []string{"username", "coin", "address"}},
+
+	"clear-primary-name": {"clear_primary_name", []string{"username"}},
+	"clear-cid":          {"clear_cid", []string{"username"}},
+	"clear-record":       {"clear_record", []string{"username", "key"}},
+
+	"assign-subname": {"assign_subname", []string{"username", "to"}},
+}
+
+// devnetURL is the URL of the simulated ledger listening on devnet.listen_addr.
+func devnetURL(cfg config.Config) string {
+	host, port, err := net.SplitHostPort(cfg.Devnet.ListenAddr)
+	if err != nil {
+		return "http://" + cfg.Devnet.ListenAddr
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// devnetConfig points the indexer at the simulated ledger, trusting its representatives, activates every protocol
+// version from the first one on, so the devnet accepts the newest commands before they are live, and keeps the
+// index in memory unless a database is set.
+func devnetConfig(cfg config.Config) config.Config {
+	url := devnetURL(cfg)
+	cfg.Keeta.BaseURL, cfg.Keeta.BaseURLs, cfg.Keeta.Quorum = url, []string{url}, 1
+	cfg.Keeta.KeetoolsBaseURL = url
+	cfg.Indexer.VerifySignatures = false
+	cfg.Indexer.Representatives, cfg.Indexer.FinalityQuorum = devnet.Representatives, 0
+	cfg.Resolve()
+
+	var activations []string
+	for _, rules := range indexer.RuleSets {
+		activations = append(activations, fmt.Sprintf("%d=%s", rules.Version, indexer.RuleSets[0].ActivatedAt.Format(time.RFC3339)))
+	}
+	cfg.Indexer.Activations = strings.Join(activations, ",")
+	if cfg.DatabaseURL == "" {
+		cfg.DatabaseURL = "memory://"
+	}
+	return cfg
+}
+
+// runDevnet runs a simulated ledger, the indexer following it with the outbox relay and the API until the context is
+// done.
+func runDevnet(
+	ctx context.Context, cfg config.Config, ix *indexer.Indexer, db store.Store, relay func(ctx context.Context),
+) error {
+	listener, err := net.Listen("tcp", cfg.Devnet.ListenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for devnet ledger: %w", err)
+	}
+
+	server := &http.Server{Handler: devnet.NewLedger(time.Now)}
+	go func() {
+		<-ctx.Done()
+		if err := server.Shutdown(context.Background()); err != nil {
+			slog.Error("failed to shut down devnet ledger", "error", err)
+		}
+	}()
+	go func() {
+		if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("devnet ledger stopped", "error", err)
+		}
+	}()
+
+	slog.Info("Starting devnet ledger on " + cfg.Devnet.ListenAddr)
+
+	go runIndexer(ctx, ix, db, relay)
+	return serve(ctx, cfg, ix, db)
+}
+
+// devnetCommand sends "devnet <command> <account> [arguments]" to the admin API of a running devnet.
+func devnetCommand(cfg config.Config, args []string) error {
+	command, ok := devnetCommands[args[0]]
+	if !ok || len(args) != 2+len(command.arguments) {
+		return fmt.Errorf(
+			"usage: devnet inscribe|transfer|set-cid|set-primary-name|set-record|set-address|clear-primary-name|" +
+				"clear-cid|clear-record|assign-subname <account> [arguments]",
+		)
+	}
+
+	request := devnet.Command{Account: args[1]}
+	for i, argument := range command.arguments {
+		value := args[2+i]
+		switch argument {
+		case "username":
+			request.Username = value
+		case "to":
+			request.To = value
+		case "cid":
+			request.CID = value
+		case "key":
+			request.Key = value
+		case "value":
+			request.Value = value
+		case "coin":
+			request.Coin = value
+		case "address":
+			request.Address = value
+		}
+	}
+
+	result, err := devnet.Post(devnetURL(cfg), command.name, request)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("block %v\naccount %v\ntoken %v\n", result.Hash, result.Account, result.Token)
+	return nil
+}
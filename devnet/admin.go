@@ -0,0 +1,166 @@
+package devnet
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Commands are the KNS commands of the admin API, served at POST /devnet/<command>.
+var Commands = []string{
+	"inscribe", "transfer", "set_cid", "set_primary_name", "set_record", "set_address",
+	"clear_primary_name", "clear_cid", "clear_record", "assign_subname",
+}
+
+// Command is a KNS command appended through the admin API. Accounts given by name instead of keeta_ address are
+// turned into fake addresses with Account, and the token of inscribed usernames can be given by username.
+type Command struct {
+	Account  string `json:"account"`
+	Username string `json:"username,omitempty"`
+	Token    string `json:"token,omitempty"`
+	To       string `json:"to,omitempty"`
+	CID      string `json:"cid,omitempty"`
+	Key      string `json:"key,omitempty"`
+	Value    string `json:"value,omitempty"`
+	Coin     string `json:"coin,omitempty"`
+	Address  string `json:"address,omitempty"`
+}
+
+// Result is the block appended for a command.
+type Result struct {
+	Hash    string `json:"hash"`
+	Account string `json:"account"`
+	Token   string `json:"token"`
+}
+
+func (l *Ledger) handleAdmin() {
+	for _, name := range Commands {
+		l.mux.HandleFunc("POST /devnet/"+name, func(w http.ResponseWriter, r *http.Request) {
+			var command Command
+			if err := json.NewDecoder(r.Body).Decode(&command); err != nil {
+				writeError(w, http.StatusBadRequest, "malformed command: "+err.Error())
+				return
+			}
+			result, err := l.apply(name, command)
+			if err != nil {
+				writeError(w, http.StatusUnprocessableEntity, err.Error())
+				return
+			}
+			writeJSON(w, http.StatusOK, result)
+		})
+	}
+}
+
+// apply appends the block of the command.
+func (l *Ledger) apply(name string, command Command) (Result, error) {
+	if command.Account == "" {
+		return Result{}, errors.New("account is required")
+	}
+	result := Result{Account: address(command.Account), Token: command.Token}
+
+	if name == "inscribe" {
+		if command.Username == "" {
+			return Result{}, errors.New("username is required")
+		}
+		if result.Token == "" {
+			result.Token = Account(fmt.Sprintf("token %v %d", command.Username, len(l.History())))
+		}
+		result.Hash = l.Inscribe(result.Account, result.Token, command.Username)
+		return result, nil
+	}
+
+	if result.Token == "" {
+		var ok bool
+		if result.Token, ok = l.Token(command.Username); !ok {
+			return Result{}, fmt.Errorf("token or username inscribed on this ledger is required")
+		}
+	}
+
+	switch name {
+	case "transfer":
+		if command.To == "" {
+			return Result{}, errors.New("to is required")
+		}
+		result.Hash = l.Transfer(result.Account, result.Token, address(command.To))
+	case "set_cid":
+		if command.CID == "" {
+			return Result{}, errors.New("cid is required")
+		}
+		result.Hash = l.SetCid(result.Account, result.Token, command.CID)
+	case "set_primary_name":
+		result.Hash = l.SetPrimaryName(result.Account, result.Token)
+	case "set_record":
+		if command.Key == "" || command.Value == "" {
+			return Result{}, errors.New("key and value are required")
+		}
+		result.Hash = l.SetRecord(result.Account, result.Token, command.Key, command.Value)
+	case "set_address":
+		if command.Coin == "" || command.Address == "" {
+			return Result{}, errors.New("coin and address are required")
+		}
+		result.Hash = l.SetAddress(result.Account, result.Token, command.Coin, command.Address)
+	case "clear_primary_name":
+		result.Hash = l.ClearPrimaryName(result.Account, result.Token)
+	case "clear_cid":
+		result.Hash = l.ClearCid(result.Account, result.Token)
+	case "clear_record":
+		if command.Key == "" {
+			return Result{}, errors.New("key is required")
+		}
+		result.Hash = l.ClearRecord(result.Account, result.Token, command.Key)
+	case "assign_subname":
+		if command.To == "" {
+			return Result{}, errors.New("to is required")
+		}
+		result.Hash = l.AssignSubname(result.Account, result.Token, address(command.To))
+	}
+	return result, nil
+}
+
+// address returns the account as is when it is an address and the fake address of the name otherwise.
+func address(account string) string {
+	if strings.HasPrefix(account, "keeta_") {
+		return account
+	}
+	return Account(account)
+}
+
+// Post sends the command to the admin API of the ledger at baseURL.
+func Post(baseURL, name string, command Command) (Result, error) {
+	body, err := json.Marshal(command)
+	if err != nil {
+		return Result{}, err
+	}
+	resp, err := http.Post(baseURL+"/devnet/"+name, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&failure)
+		return Result{}, fmt.Errorf("%v: %v", resp.Status, failure.Error)
+	}
+
+	var result Result
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Result{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return result, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"status": "error", "error": message})
+}
@@ -0,0 +1,311 @@
+// Package devnet simulates a Keeta ledger serving the node and Keetools APIs the indexer consumes, so the indexer and
+// the API can run with no network.
+package devnet
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha3"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"kns-indexer/keeta"
+	"kns-indexer/kns/protocol"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// BurnAddress is the account KNS commands are sent to.
+	BurnAddress = "keeta_aeaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaazpi2nodu"
+
+	operationTypeSend             = 0
+	operationTypeSetInfo          = 2
+	operationTypeCreateIdentifier = 4
+)
+
+var (
+	// BaseToken is the token KNS commands send to the burn address.
+	BaseToken = Account("base token")
+
+	// Representatives are the accounts of the representatives voting on the ledger, with keys derived from their
+	// names so their votes verify.
+	Representatives []string
+
+	representativeKeys []ed25519.PrivateKey
+)
+
+func init() {
+	for _, name := range []string{"representative 1", "representative 2", "representative 3"} {
+		seed := sha256.Sum256([]byte(name))
+		key := ed25519.NewKeyFromSeed(seed[:])
+		account := keeta.Account{Algorithm: keeta.KeyAlgorithmED25519, PublicKey: key.Public().(ed25519.PublicKey)}
+		Representatives = append(Representatives, account.String())
+		representativeKeys = append(representativeKeys, key)
+	}
+}
+
+// Votes returns the signed votes of the first n representatives on the blocks. The votes of all of them make a vote
+// staple final, of only one keep it pending.
+func Votes(n int, blockHashes ...string) []any {
+	var votes, blocks []any
+	for _, blockHash := range blockHashes {
+		blocks = append(blocks, blockHash)
+	}
+	for i, key := range representativeKeys[:n] {
+		data, err := keeta.Vote{Issuer: Representatives[i], Blocks: blockHashes}.MarshalBinary()
+		if err != nil {
+			panic(err)
+		}
+		hash := sha3.Sum256(data)
+		votes = append(votes, map[string]any{
+			"$binary":   base64.StdEncoding.EncodeToString(data),
+			"$hash":     strings.ToUpper(hex.EncodeToString(hash[:])),
+			"issuer":    Representatives[i],
+			"blocks":    blocks,
+			"signature": hex.EncodeToString(ed25519.Sign(key, hash[:])),
+		})
+	}
+	return votes
+}
+
+// Account returns the fake account address of the name. It has the form of an account address but no valid key or
+// checksum, so the ledger only works with verify_signatures off.
+func Account(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return "keeta_" + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(sum[:]))
+}
+
+// Ledger is a simulated ledger whose history is a list of final vote staples of one block each. It serves
+// /api/staples/metadata and /api/node/ledger/history in pages of the requested limit, and the admin API under
+// /devnet.
+type Ledger struct {
+	mu      sync.Mutex
+	history []any
+	blocks  int
+	now     func() time.Time
+	// tokens are the tokens of the inscribed usernames, for the admin API
+	tokens map[string]string
+
+	mux *http.ServeMux
+}
+
+// NewLedger returns a ledger starting with the history items, dating blocks with now.
+func NewLedger(now func() time.Time, history ...any) *Ledger {
+	l := &Ledger{history: history, now: now, tokens: map[string]string{}, mux: http.NewServeMux()}
+	l.mux.HandleFunc("GET /api/staples/metadata", l.metadata)
+	l.mux.HandleFunc("GET /api/node/ledger/history", l.ledgerHistory)
+	l.handleAdmin()
+	return l
+}
+
+func (l *Ledger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.mux.ServeHTTP(w, r)
+}
+
+// History returns the history items in order.
+func (l *Ledger) History() []any {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]any(nil), l.history...)
+}
+
+// Append adds history items as is, e.g. malformed ones.
+func (l *Ledger) Append(history ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.history = append(l.history, history...)
+}
+
+// Block appends a block of the account signed by the signer and returns its hash.
+func (l *Ledger) Block(account, signer string, operations ...map[string]any) string {
+	return l.staple(true, account, signer, operations)
+}
+
+// PendingBlock appends a block whose vote staple is not final and returns its hash.
+func (l *Ledger) PendingBlock(account, signer string, operations ...map[string]any) string {
+	return l.staple(false, account, signer, operations)
+}
+
+// Finalize adds the votes of all representatives to the vote staple of the pending block.
+func (l *Ledger) Finalize(hash string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, item := range l.history {
+		voteStaple, _ := item.(map[string]any)["voteStaple"].(map[string]any)
+		blocks, _ := voteStaple["blocks"].([]any)
+		for _, block := range blocks {
+			if block.(map[string]any)["$hash"] == hash {
+				voteStaple["votes"] = Votes(len(Representatives), hash)
+			}
+		}
+	}
+}
+
+func (l *Ledger) staple(final bool, account, signer string, operations []map[string]any) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.blocks++
+	hash := fmt.Sprintf("%064X", l.blocks)
+	block := map[string]any{
+		"$hash":      hash,
+		"date":       l.now().UTC().Format(time.RFC3339Nano),
+		"account":    account,
+		"signer":     signer,
+		"operations": operations,
+	}
+
+	votes := Votes(1, hash)
+	if final {
+		votes = Votes(len(Representatives), hash)
+	}
+	l.history = append(l.history, map[string]any{"voteStaple": map[string]any{"blocks": []any{block}, "votes": votes}})
+	return hash
+}
+
+// Inscribe appends the owner creating the token followed by the token block naming it, and returns the hash of the
+// latter.
+func (l *Ledger) Inscribe(owner, token, username string) string {
+	l.Block(owner, owner, CreateIdentifier(token))
+	hash := l.Block(token, owner, SetInfo("KNS", username))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.tokens[normalize(username)]; !ok {
+		l.tokens[normalize(username)] = token
+	}
+	return hash
+}
+
+// Transfer appends the owner sending the username token to the account.
+func (l *Ledger) Transfer(owner, token, to string) string {
+	return l.Block(owner, owner, Send(to, token, "0x1", "transfer"))
+}
+
+// SetCid appends the owner setting the CID of the username token.
+func (l *Ledger) SetCid(owner, token, cid string) string {
+	return l.Block(owner, owner, Send(BurnAddress, BaseToken, "0x1", protocol.CommandSetCID+" "+token+" "+cid))
+}
+
+// SetPrimaryName appends the owner making the username token their primary name.
+func (l *Ledger) SetPrimaryName(owner, token string) string {
+	return l.Block(owner, owner, Send(BurnAddress, BaseToken, "0x1", protocol.CommandSetPrimaryName+" "+token))
+}
+
+// SetRecord appends the owner setting the text record of the username token.
+func (l *Ledger) SetRecord(owner, token, key, value string) string {
+	return l.Block(
+		owner, owner, Send(BurnAddress, BaseToken, "0x1", protocol.CommandSetRecord+" "+token+" "+key+" "+value),
+	)
+}
+
+// SetAddress appends the owner setting the address of the username token on the coin.
+func (l *Ledger) SetAddress(owner, token, coin, address string) string {
+	return l.Block(
+		owner, owner, Send(BurnAddress, BaseToken, "0x1", protocol.CommandSetAddress+" "+token+" "+coin+" "+address),
+	)
+}
+
+// ClearPrimaryName appends the owner unsetting the username token as their primary name.
+func (l *Ledger) ClearPrimaryName(owner, token string) string {
+	return l.Block(owner, owner, Send(BurnAddress, BaseToken, "0x1", protocol.CommandClearPrimaryName+" "+token))
+}
+
+// ClearCid appends the owner removing the CID of the username token.
+func (l *Ledger) ClearCid(owner, token string) string {
+	return l.Block(owner, owner, Send(BurnAddress, BaseToken, "0x1", protocol.CommandClearCID+" "+token))
+}
+
+// ClearRecord appends the owner removing the text record of the username token.
+func (l *Ledger) ClearRecord(owner, token, key string) string {
+	return l.Block(owner, owner, Send(BurnAddress, BaseToken, "0x1", protocol.CommandClearRecord+" "+token+" "+key))
+}
+
+// AssignSubname appends the owner of the parent name giving the subname token to the account.
+func (l *Ledger) AssignSubname(owner, token, to string) string {
+	return l.Block(owner, owner, Send(BurnAddress, BaseToken, "0x1", protocol.CommandAssignSubname+" "+token+" "+to))
+}
+
+// Token returns the token of the first inscription of the username on this ledger.
+func (l *Ledger) Token(username string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	token, ok := l.tokens[normalize(username)]
+	return token, ok
+}
+
+// normalize returns the name the username inscribes, only lower-cased when it is not valid.
+func normalize(username string) string {
+	if name, err := protocol.ParseName(username); err == nil {
+		return name
+	}
+	return strings.ToLower(username)
+}
+
+func CreateIdentifier(identifier string) map[string]any {
+	return map[string]any{"type": operationTypeCreateIdentifier, "identifier": identifier}
+}
+
+func SetInfo(name, description string) map[string]any {
+	return map[string]any{"type": operationTypeSetInfo, "name": name, "description": description}
+}
+
+// Send is a send operation, without extra when it is empty.
+func Send(to, token, amount, extra string) map[string]any {
+	operation := map[string]any{"type": operationTypeSend, "to": to, "token": token, "amount": amount}
+	if extra != "" {
+		operation["extra"] = extra
+	}
+	return operation
+}
+
+// metadata responds with the total number of pages and, for an existing page, the offset of its first history item
+// as startBlocksHash.
+func (l *Ledger) metadata(w http.ResponseWriter, r *http.Request) {
+	limit, limitOK := positive(r, "limit")
+	page, pageOK := positive(r, "page")
+	if !limitOK || !pageOK {
+		writeError(w, http.StatusBadRequest, "limit and page should be positive integers")
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	totalPages := (len(l.history) + limit - 1) / limit
+	metadata := map[string]any{"totalPages": totalPages}
+	if page <= totalPages {
+		metadata["startBlocksHash"] = strconv.Itoa((page - 1) * limit)
+	}
+	writeJSON(w, http.StatusOK, metadata)
+}
+
+// ledgerHistory responds with up to limit history items from start, nothing without start.
+func (l *Ledger) ledgerHistory(w http.ResponseWriter, r *http.Request) {
+	limit, ok := positive(r, "limit")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "limit should be positive integer")
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	history := []any{}
+	if start, err := strconv.Atoi(r.URL.Query().Get("start")); err == nil && start >= 0 && start < len(l.history) {
+		history = l.history[start:min(start+limit, len(l.history))]
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"history": history})
+}
+
+// positive parses the query parameter as a positive integer.
+func positive(r *http.Request, name string) (int, bool) {
+	value, err := strconv.Atoi(r.URL.Query().Get(name))
+	return value, err == nil && value > 0
+}
@@ -15,6 +15,112 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/api/events": {
+            "get": {
+                "description": "Streams the KNS actions committed by the indexer from now on as server-sent events named after the action type. Actions are dropped for clients that fall behind",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "events"
+                ],
+                "summary": "Stream committed actions",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/store.Action"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/fees": {
+            "get": {
+                "description": "Returns registration fee tiers by username length of the protocol version active now. An inscription is accepted only if its block or the linked identifier block sends at least the fee in the base token to the treasury; each payment pays for a single inscription. Returns 503 before the first protocol version activates",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "protocol"
+                ],
+                "summary": "Get registration fee schedule",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.GetFeesSuccessResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/models.FailureResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/metrics": {
+            "get": {
+                "description": "Returns indexer metrics in Prometheus text exposition format",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "status"
+                ],
+                "summary": "Get metrics",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/pending-actions": {
+            "get": {
+                "description": "Returns KNS actions from vote staples that are not final yet. They are not reflected in usernames until final and are dropped if they never become final",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "pending"
+                ],
+                "summary": "Get pending actions",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Filter by account that issued the action",
+                        "name": "account",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.GetPendingActionsSuccessResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.FailureResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/api/primary-username/{owner}": {
             "get": {
                 "description": "Returns primary username by owner",
@@ -35,6 +141,13 @@ const docTemplate = `{
                         "name": "owner",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "default": false,
+                        "description": "Include the text records and coin addresses of the username",
+                        "name": "records",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -59,6 +172,58 @@ const docTemplate = `{
                 }
             }
         },
+        "/api/ready": {
+            "get": {
+                "description": "Returns 200 while the indexer is healthy and 503 once it failed INDEXER_MAX_FAILURES times in a row, so orchestrators can restart it instead of serving stale data",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "status"
+                ],
+                "summary": "Readiness probe",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.GetReadySuccessResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/models.FailureResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/status": {
+            "get": {
+                "description": "Returns sync progress of the indexer, agreement of the upstream nodes history is cross-checked between and the replica currently running the indexer",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "status"
+                ],
+                "summary": "Get indexer status",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.GetStatusSuccessResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/api/usernames": {
             "get": {
                 "description": "Returns paginated list of all registered usernames with sorting by timestamp",
@@ -100,6 +265,13 @@ const docTemplate = `{
                         "description": "Sort order by timestamp: asc or desc",
                         "name": "sortOrder",
                         "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "default": false,
+                        "description": "Include the text records and coin addresses of each username",
+                        "name": "records",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -172,6 +344,13 @@ const docTemplate = `{
                         "description": "Sort order by timestamp: asc or desc",
                         "name": "sortOrder",
                         "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "default": false,
+                        "description": "Include the text records and coin addresses of each username",
+                        "name": "records",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -212,10 +391,17 @@ const docTemplate = `{
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Username",
+                        "description": "Username or subname like blog.alice",
                         "name": "username",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "default": false,
+                        "description": "Include the text records and coin addresses of the username",
+                        "name": "records",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -239,9 +425,151 @@ const docTemplate = `{
                     }
                 }
             }
+        },
+        "/api/usernames/{username}/addresses/{coin}": {
+            "get": {
+                "description": "Returns the address a username resolves to on another chain, by coin symbol or SLIP-44 coin type",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "username"
+                ],
+                "summary": "Resolve username address on a coin",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Username or subname like blog.alice",
+                        "name": "username",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Coin symbol (btc, eth, sol) or SLIP-44 coin type",
+                        "name": "coin",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.GetAddressSuccessResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.FailureResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/models.FailureResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.FailureResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/usernames/{username}/records": {
+            "get": {
+                "description": "Returns the text records set on a username by key",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "username"
+                ],
+                "summary": "Get username records",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Username or subname like blog.alice",
+                        "name": "username",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.GetRecordsSuccessResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.FailureResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.FailureResponse"
+                        }
+                    }
+                }
+            }
         }
     },
     "definitions": {
+        "handlers.GetAddressSuccessResponse": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "$ref": "#/definitions/handlers.GetAddressSuccessResponseData"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "ok"
+                }
+            }
+        },
+        "handlers.GetAddressSuccessResponseData": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string",
+                    "example": "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"
+                },
+                "coin": {
+                    "type": "string",
+                    "example": "eth"
+                },
+                "coinType": {
+                    "type": "integer",
+                    "example": 60
+                }
+            }
+        },
+        "handlers.GetFeesSuccessResponse": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "$ref": "#/definitions/models.FeeSchedule"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "ok"
+                }
+            }
+        },
         "handlers.GetOwnerUsernamesSuccessResponse": {
             "type": "object",
             "properties": {
@@ -269,6 +597,21 @@ const docTemplate = `{
                 }
             }
         },
+        "handlers.GetPendingActionsSuccessResponse": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PendingAction"
+                    }
+                },
+                "status": {
+                    "type": "string",
+                    "example": "ok"
+                }
+            }
+        },
         "handlers.GetPrimaryUsernameSuccessResponse": {
             "type": "object",
             "properties": {
@@ -281,6 +624,33 @@ const docTemplate = `{
                 }
             }
         },
+        "handlers.GetReadySuccessResponse": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "$ref": "#/definitions/models.Health"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "ok"
+                }
+            }
+        },
+        "handlers.GetRecordsSuccessResponse": {
+            "type": "object"
+        },
+        "handlers.GetStatusSuccessResponse": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "$ref": "#/definitions/models.Status"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "ok"
+                }
+            }
+        },
         "handlers.GetUsernameSuccessResponse": {
             "type": "object",
             "properties": {
@@ -320,6 +690,55 @@ const docTemplate = `{
                 }
             }
         },
+        "models.ConsensusStatus": {
+            "type": "object",
+            "properties": {
+                "disagreements": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "lastAgreedAt": {
+                    "type": "string",
+                    "example": "2025-11-25T11:22:33.123Z"
+                },
+                "lastDisagreement": {
+                    "$ref": "#/definitions/models.Disagreement"
+                },
+                "quorum": {
+                    "type": "integer",
+                    "example": 2
+                },
+                "sources": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Source"
+                    }
+                }
+            }
+        },
+        "models.Disagreement": {
+            "type": "object",
+            "properties": {
+                "fingerprints": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "page": {
+                    "type": "integer",
+                    "example": 42
+                },
+                "quorumMet": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "timestamp": {
+                    "type": "string",
+                    "example": "2025-11-25T11:22:33.123Z"
+                }
+            }
+        },
         "models.FailureResponse": {
             "type": "object",
             "properties": {
@@ -333,6 +752,228 @@ const docTemplate = `{
                 }
             }
         },
+        "models.FeeSchedule": {
+            "type": "object",
+            "properties": {
+                "activatedAt": {
+                    "type": "string",
+                    "example": "2026-01-01T00:00:00Z"
+                },
+                "baseToken": {
+                    "type": "string",
+                    "example": "keeta_cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc"
+                },
+                "enabled": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "protocolVersion": {
+                    "type": "integer",
+                    "example": 2
+                },
+                "tiers": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.FeeTier"
+                    }
+                },
+                "treasury": {
+                    "type": "string",
+                    "example": "keeta_aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+                }
+            }
+        },
+        "models.FeeTier": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "string",
+                    "example": "1000000"
+                },
+                "maxLength": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "minLength": {
+                    "type": "integer",
+                    "example": 1
+                }
+            }
+        },
+        "models.Health": {
+            "type": "object",
+            "properties": {
+                "consecutiveFailures": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "lastError": {
+                    "type": "string",
+                    "example": "failed to fetch page metadata of page 42: unexpected status 502 Bad Gateway"
+                },
+                "lastFailureAt": {
+                    "type": "string",
+                    "example": "2025-11-25T11:22:33.123Z"
+                },
+                "lastSuccessAt": {
+                    "type": "string",
+                    "example": "2025-11-25T11:22:33.123Z"
+                },
+                "ready": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "restarts": {
+                    "type": "integer",
+                    "example": 0
+                }
+            }
+        },
+        "models.Leader": {
+            "type": "object",
+            "properties": {
+                "holder": {
+                    "type": "string",
+                    "example": "kns-indexer-1"
+                },
+                "instanceId": {
+                    "type": "string",
+                    "example": "kns-indexer-1"
+                },
+                "isLeader": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "leaseExpiresAt": {
+                    "type": "string",
+                    "example": "2025-11-25T11:22:33.123Z"
+                },
+                "term": {
+                    "type": "integer",
+                    "example": 3
+                }
+            }
+        },
+        "models.PendingAction": {
+            "type": "object",
+            "properties": {
+                "account": {
+                    "type": "string",
+                    "example": "keeta_aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+                },
+                "blockHash": {
+                    "type": "string",
+                    "example": "0F3E5A6B7C8D9E0F1A2B3C4D5E6F7A8B9C0D1E2F3A4B5C6D7E8F9A0B1C2D3E4F"
+                },
+                "cid": {
+                    "type": "string",
+                    "example": "Qmaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+                },
+                "firstSeen": {
+                    "type": "string",
+                    "example": "2025-11-25T11:22:34.456Z"
+                },
+                "key": {
+                    "type": "string",
+                    "example": "avatar"
+                },
+                "owner": {
+                    "type": "string",
+                    "example": "keeta_bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+                },
+                "position": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "timestamp": {
+                    "type": "string",
+                    "example": "2025-11-25T11:22:33.123Z"
+                },
+                "token": {
+                    "type": "string",
+                    "example": "keeta_aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+                },
+                "type": {
+                    "type": "string",
+                    "enum": [
+                        "inscribe",
+                        "transfer",
+                        "set_primary_name",
+                        "set_cid",
+                        "set_record",
+                        "set_address",
+                        "clear_primary_name",
+                        "clear_cid",
+                        "clear_record",
+                        "assign_subname"
+                    ],
+                    "example": "inscribe"
+                },
+                "username": {
+                    "type": "string",
+                    "example": "username"
+                },
+                "value": {
+                    "type": "string",
+                    "example": "https://example.com/avatar.png"
+                }
+            }
+        },
+        "models.Source": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string",
+                    "example": "unexpected status 502 Bad Gateway"
+                },
+                "fingerprint": {
+                    "type": "string",
+                    "example": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+                },
+                "inQuorum": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "lastFetchedAt": {
+                    "type": "string",
+                    "example": "2025-11-25T11:22:33.123Z"
+                },
+                "url": {
+                    "type": "string",
+                    "example": "https://rep1.test.network.api.keeta.com"
+                }
+            }
+        },
+        "models.Status": {
+            "type": "object",
+            "properties": {
+                "consensus": {
+                    "$ref": "#/definitions/models.ConsensusStatus"
+                },
+                "health": {
+                    "$ref": "#/definitions/models.Health"
+                },
+                "lastBlockHash": {
+                    "type": "string",
+                    "example": "0F3E5A6B7C8D9E0F1A2B3C4D5E6F7A8B9C0D1E2F3A4B5C6D7E8F9A0B1C2D3E4F"
+                },
+                "lastBlockTimestamp": {
+                    "type": "string",
+                    "example": "2025-11-25T11:22:33.123Z"
+                },
+                "leader": {
+                    "$ref": "#/definitions/models.Leader"
+                },
+                "page": {
+                    "type": "integer",
+                    "example": 42
+                },
+                "pendingBlocks": {
+                    "type": "integer",
+                    "example": 0
+                }
+            }
+        },
         "models.Username": {
             "type": "object",
             "properties": {
@@ -340,10 +981,22 @@ const docTemplate = `{
                     "type": "string",
                     "example": "keeta_aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
                 },
+                "addresses": {
+                    "description": "Addresses are the addresses on other chains by coin symbol, only filled in with the records.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
                 "cid": {
                     "type": "string",
                     "example": "Qmaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
                 },
+                "display": {
+                    "description": "Display is the name in the form it was inscribed in when that differs from its normalized username.",
+                    "type": "string",
+                    "example": "Alice"
+                },
                 "isPrimary": {
                     "type": "boolean",
                     "example": false
@@ -352,6 +1005,18 @@ const docTemplate = `{
                     "type": "string",
                     "example": "keeta_bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
                 },
+                "parent": {
+                    "description": "Parent is the name a subname is under, whose owner controls it.",
+                    "type": "string",
+                    "example": "alice"
+                },
+                "records": {
+                    "description": "Records are the text records by key, only filled in when requested.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
                 "timestamp": {
                     "type": "string",
                     "example": "2025-11-25T11:22:33.123Z"
@@ -361,6 +1026,45 @@ const docTemplate = `{
                     "example": "username"
                 }
             }
+        },
+        "store.Action": {
+            "type": "object",
+            "properties": {
+                "account": {
+                    "type": "string"
+                },
+                "blockHash": {
+                    "type": "string"
+                },
+                "cid": {
+                    "type": "string"
+                },
+                "key": {
+                    "description": "Key and Value are the record key and value of set_record, the key of clear_record, and the coin and address\nof set_address. Value is also the display form of the name of inscribe.",
+                    "type": "string"
+                },
+                "owner": {
+                    "type": "string"
+                },
+                "position": {
+                    "type": "integer"
+                },
+                "timestamp": {
+                    "type": "string"
+                },
+                "token": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                },
+                "username": {
+                    "type": "string"
+                },
+                "value": {
+                    "type": "string"
+                }
+            }
         }
     }
 }`
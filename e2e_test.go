@@ -0,0 +1,784 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"kns-indexer/config"
+	"kns-indexer/devnet"
+	"kns-indexer/events"
+	"kns-indexer/handlers"
+	"kns-indexer/indexer"
+	"kns-indexer/models"
+	"kns-indexer/store"
+	"kns-indexer/testutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+const (
+	userA  = "keeta_usera"
+	userB  = "keeta_userb"
+	tokenA = "keeta_tokena"
+	tokenB = "keeta_tokenb"
+)
+
+var scenarioStart = time.Date(2025, 12, 3, 10, 0, 0, 0, time.UTC)
+
+// stack is the indexer and the API sharing an in-memory store, configured to follow a fake node.
+type stack struct {
+	ix  *indexer.Indexer
+	db  store.Store
+	app *fiber.App
+	// stopEvents stops following the committed actions, ending the event streams
+	stopEvents context.CancelFunc
+}
+
+func newStack(t *testing.T, server *testutil.Server, pageLimit, backfillPages int) *stack {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.Keeta.BaseURL, cfg.Keeta.BaseURLs, cfg.Keeta.Quorum = server.URL, []string{server.URL}, 1
+	cfg.Keeta.KeetoolsBaseURL = server.URL
+	cfg.Indexer.PageLimit = pageLimit
+	cfg.Indexer.BackfillPages = backfillPages
+	cfg.Indexer.PollInterval = 5 * time.Millisecond
+	cfg.Indexer.Representatives = devnet.Representatives
+	cfg.Resolve()
+	return startStack(t, cfg)
+}
+
+// startStack returns the indexer and the API of the configuration on a memory store.
+func startStack(t *testing.T, cfg config.Config) *stack {
+	t.Helper()
+
+	ix, err := indexer.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := store.NewMemory()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	bus := events.NewBus()
+	go bus.Follow(ctx, ix, db)
+
+	return &stack{ix: ix, db: db, app: newApp(cfg, ix, db, bus), stopEvents: cancel}
+}
+
+// index runs the indexer until it committed the block and returns the error it stopped with before that, if any.
+func (s *stack) index(t *testing.T, hash string) error {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := make(chan error, 1)
+	go func() { errs <- s.ix.Run(ctx, s.db) }()
+
+	deadline := time.After(10 * time.Second)
+	for {
+		select {
+		case err := <-errs:
+			return err
+		case <-deadline:
+			cancel()
+			<-errs
+			t.Fatalf("indexer did not reach block %v", hash)
+		case <-time.After(5 * time.Millisecond):
+		}
+
+		_, _, lastBlockHash, err := s.db.LoadCursor(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lastBlockHash != nil && *lastBlockHash == hash {
+			cancel()
+			if err = <-errs; !errors.Is(err, context.Canceled) {
+				return err
+			}
+			return nil
+		}
+	}
+}
+
+// get requests the API path and decodes the response into T.
+func get[T any](t *testing.T, app *fiber.App, path string) (int, T) {
+	t.Helper()
+
+	var body T
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, path, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(data, &body); err != nil {
+		t.Fatalf("failed to decode %v response %s: %v", path, data, err)
+	}
+	return resp.StatusCode, body
+}
+
+func getUsername(t *testing.T, app *fiber.App, username string) (int, models.Username) {
+	t.Helper()
+	status, body := get[handlers.GetUsernameSuccessResponse](t, app, "/usernames/"+username)
+	return status, body.Data
+}
+
+func ownerUsernames(t *testing.T, app *fiber.App, owner string) []string {
+	t.Helper()
+	status, body := get[handlers.GetOwnerUsernamesSuccessResponse](t, app, "/usernames/owner/"+owner+"?sortOrder=asc")
+	if status != fiber.StatusOK {
+		t.Fatalf("owner usernames status %d, want 200", status)
+	}
+	usernames := []string{}
+	for _, u := range body.Data.Usernames {
+		usernames = append(usernames, u.Username)
+	}
+	return usernames
+}
+
+func TestFixtureHistory(t *testing.T) {
+	server := testutil.NewServer(t, testutil.LoadHistory(t, "testdata/history.json")...)
+	s := newStack(t, server, 100, 0)
+	if err := s.index(t, "000000000000000000000000000000000000000000000000000000000000A006"); err != nil {
+		t.Fatal(err)
+	}
+
+	status, body := get[handlers.GetUsernamesSuccessResponse](t, s.app, "/usernames?sortOrder=asc")
+	if status != fiber.StatusOK {
+		t.Fatalf("usernames status %d, want 200", status)
+	}
+	want := []models.Username{
+		{
+			Username:  "alice",
+			Address:   "keeta_anqdilpazdekdu4acw65fj7smltcp26wbrildkqtszqvverljpwpezmd44ssg",
+			Owner:     "keeta_aabszsbrqppriqddrkptq5awubshpq3cgsoi4rc624xm6phdt74vo5vsftoyc7s",
+			Timestamp: time.Date(2025, 12, 3, 10, 1, 0, 0, time.UTC),
+		},
+		{
+			Username:  "bob",
+			Address:   "keeta_ao7nitutebhm2pkngjr2hlytaml3lpclnq4zfr4h5qd3hnqykjenhgxiwnjqg",
+			Owner:     devnet.BurnAddress,
+			Timestamp: time.Date(2025, 12, 3, 10, 3, 0, 0, time.UTC),
+		},
+	}
+	if body.Data.Total != 2 || !reflect.DeepEqual(body.Data.Usernames, want) {
+		t.Fatalf("usernames %+v of %d, want %+v", body.Data.Usernames, body.Data.Total, want)
+	}
+
+	deadLetters, err := s.db.UnreplayedDeadLetters(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deadLetters) != 2 {
+		t.Fatalf("dead letters %+v, want the malformed operation and vote staple", deadLetters)
+	}
+}
+
+func TestScenarios(t *testing.T) {
+	tests := []struct {
+		name   string
+		script func(s *devnet.Ledger)
+		check  func(t *testing.T, app *fiber.App)
+	}{
+		{
+			name:   "inscribe",
+			script: func(s *devnet.Ledger) { s.Inscribe(userA, tokenA, "Alice") },
+			check: func(t *testing.T, app *fiber.App) {
+				for _, username := range []string{"alice", "ALICE"} {
+					status, u := getUsername(t, app, username)
+					if status != fiber.StatusOK || u.Username != "alice" || u.Address != tokenA || u.Owner != userA {
+						t.Errorf("%v %d %+v, want alice of %v owned by %v", username, status, u, tokenA, userA)
+					}
+				}
+			},
+		},
+		{
+			name: "inscribe taken username",
+			script: func(s *devnet.Ledger) {
+				s.Inscribe(userA, tokenA, "alice")
+				s.Inscribe(userB, tokenB, "alice")
+			},
+			check: func(t *testing.T, app *fiber.App) {
+				if usernames := ownerUsernames(t, app, userB); len(usernames) != 0 {
+					t.Errorf("usernames of %v %v, want none", userB, usernames)
+				}
+				if _, u := getUsername(t, app, "alice"); u.Owner != userA {
+					t.Errorf("alice owned by %v, want %v", u.Owner, userA)
+				}
+			},
+		},
+		{
+			name:   "inscribe invalid username",
+			script: func(s *devnet.Ledger) { s.Inscribe(userA, tokenA, "not valid!") },
+			check: func(t *testing.T, app *fiber.App) {
+				if usernames := ownerUsernames(t, app, userA); len(usernames) != 0 {
+					t.Errorf("usernames of %v %v, want none", userA, usernames)
+				}
+			},
+		},
+		{
+			name:   "inscribe without creating the token first",
+			script: func(s *devnet.Ledger) { s.Block(tokenA, userA, devnet.SetInfo("KNS", "alice")) },
+			check: func(t *testing.T, app *fiber.App) {
+				if status, _ := getUsername(t, app, "alice"); status != fiber.StatusNotFound {
+					t.Errorf("alice status %d, want 404", status)
+				}
+			},
+		},
+		{
+			name: "transfer",
+			script: func(s *devnet.Ledger) {
+				s.Inscribe(userA, tokenA, "alice")
+				s.Transfer(userA, tokenA, devnet.BurnAddress)
+			},
+			check: func(t *testing.T, app *fiber.App) {
+				if _, u := getUsername(t, app, "alice"); u.Owner != devnet.BurnAddress {
+					t.Errorf("alice owned by %v, want %v", u.Owner, devnet.BurnAddress)
+				}
+				if usernames := ownerUsernames(t, app, userA); len(usernames) != 0 {
+					t.Errorf("usernames of %v %v, want none", userA, usernames)
+				}
+			},
+		},
+		{
+			name: "transfer by another account",
+			script: func(s *devnet.Ledger) {
+				s.Inscribe(userA, tokenA, "alice")
+				s.Transfer(userB, tokenA, devnet.BurnAddress)
+			},
+			check: func(t *testing.T, app *fiber.App) {
+				if _, u := getUsername(t, app, "alice"); u.Owner != userA {
+					t.Errorf("alice owned by %v, want %v", u.Owner, userA)
+				}
+			},
+		},
+		// protocol v1 takes the whole memo as the token address, so set_cid and set_primary_name never match a
+		// username and have no effect
+		{
+			name: "set_cid",
+			script: func(s *devnet.Ledger) {
+				s.Inscribe(userA, tokenA, "alice")
+				s.SetCid(userA, tokenA, "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG")
+			},
+			check: func(t *testing.T, app *fiber.App) {
+				if _, u := getUsername(t, app, "alice"); u.CID != nil {
+					t.Errorf("alice CID %v, want none in protocol v1", *u.CID)
+				}
+			},
+		},
+		{
+			name: "set_primary_name",
+			script: func(s *devnet.Ledger) {
+				s.Inscribe(userA, tokenA, "alice")
+				s.SetPrimaryName(userA, tokenA)
+			},
+			check: func(t *testing.T, app *fiber.App) {
+				status, _ := get[handlers.GetPrimaryUsernameSuccessResponse](t, app, "/primary-username/"+userA)
+				if status != fiber.StatusNotFound {
+					t.Errorf("primary username status %d, want 404 in protocol v1", status)
+				}
+			},
+		},
+		{
+			name: "malformed data",
+			script: func(s *devnet.Ledger) {
+				s.Append(map[string]any{"voteStaple": map[string]any{"votes": []any{}}})
+				s.Append(map[string]any{"voteStaple": map[string]any{"blocks": []any{map[string]any{"account": userA}}}})
+				s.Block(userA, userA, map[string]any{"type": 0, "to": 5})
+				s.Inscribe(userA, tokenA, "alice")
+			},
+			check: func(t *testing.T, app *fiber.App) {
+				if usernames := ownerUsernames(t, app, userA); !reflect.DeepEqual(usernames, []string{"alice"}) {
+					t.Errorf("usernames of %v %v, want [alice]", userA, usernames)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scenario := testutil.NewScenario(scenarioStart)
+			test.script(scenario)
+			end := scenario.Block(userB, userB)
+
+			s := newStack(t, testutil.NewServer(t, scenario.History()...), 100, 0)
+			if err := s.index(t, end); err != nil {
+				t.Fatal(err)
+			}
+			test.check(t, s.app)
+		})
+	}
+}
+
+// TestProtocolV2 runs a scenario after protocol v2 activated, where set_cid, set_primary_name, set_record and
+// set_address read the token from the memo.
+func TestProtocolV2(t *testing.T) {
+	scenario := testutil.NewScenario(indexer.RuleSets[len(indexer.RuleSets)-1].ActivatedAt.Add(time.Hour))
+	scenario.Inscribe(userA, tokenA, "alice")
+	scenario.Inscribe(userA, tokenB, "bob")
+	scenario.SetCid(userA, tokenA, "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG")
+	scenario.SetPrimaryName(userA, tokenA)
+	scenario.SetRecord(userA, tokenA, "url", "https://example.com/old")
+	scenario.SetRecord(userA, tokenA, "url", "https://alice.example")
+	scenario.SetRecord(userA, tokenA, "description", "Alice in Keeta land")
+	scenario.SetRecord(userB, tokenA, "url", "https://mallory.example")
+	scenario.SetRecord(userA, tokenA, "URL", "https://ignored.example")
+	scenario.SetAddress(userA, tokenA, "eth", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed")
+	scenario.SetAddress(userA, tokenA, "btc", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed")
+	end := scenario.SetAddress(userA, tokenA, "eth", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeD")
+
+	s := newStack(t, testutil.NewServer(t, scenario.History()...), 100, 0)
+	if err := s.index(t, end); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"url": "https://alice.example", "description": "Alice in Keeta land"}
+	status, body := get[handlers.GetUsernameSuccessResponse](t, s.app, "/usernames/alice?records=true")
+	if u := body.Data; status != fiber.StatusOK || u.CID == nil || !u.IsPrimary || !reflect.DeepEqual(u.Records, want) {
+		t.Fatalf("alice %d %+v, want CID, primary and records %v", status, u, want)
+	}
+	if _, u := getUsername(t, s.app, "alice"); u.Records != nil {
+		t.Errorf("alice records %v without ?records=true, want none", u.Records)
+	}
+
+	status, records := get[handlers.GetRecordsSuccessResponse](t, s.app, "/usernames/ALICE/records")
+	if status != fiber.StatusOK || !reflect.DeepEqual(records.Data, want) {
+		t.Errorf("alice records %d %v, want %v", status, records.Data, want)
+	}
+	status, records = get[handlers.GetRecordsSuccessResponse](t, s.app, "/usernames/bob/records")
+	if status != fiber.StatusOK || records.Data == nil || len(records.Data) != 0 {
+		t.Errorf("bob records %d %v, want empty", status, records.Data)
+	}
+	if status, _ = get[models.FailureResponse](t, s.app, "/usernames/carol/records"); status != fiber.StatusNotFound {
+		t.Errorf("carol records status %d, want 404", status)
+	}
+
+	events, err := s.db.Events(context.Background(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	wantTypes := []string{
+		"inscribe", "set_cid", "set_primary_name", "set_record", "set_record", "set_record", "set_address",
+	}
+	if !reflect.DeepEqual(types, wantTypes) {
+		t.Errorf("alice events %v, want %v", types, wantTypes)
+	}
+
+	const eth = "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"
+	if addresses := body.Data.Addresses; !reflect.DeepEqual(addresses, map[string]string{"eth": eth}) {
+		t.Errorf("alice addresses %v, want the eth address with a valid checksum", addresses)
+	}
+	for _, coin := range []string{"eth", "ETH", "60"} {
+		status, address := get[handlers.GetAddressSuccessResponse](t, s.app, "/usernames/alice/addresses/"+coin)
+		want := handlers.GetAddressSuccessResponseData{Coin: "eth", CoinType: 60, Address: eth}
+		if status != fiber.StatusOK || address.Data != want {
+			t.Errorf("alice %v address %d %+v, want %+v", coin, status, address.Data, want)
+		}
+	}
+	for path, want := range map[string]int{
+		"/usernames/alice/addresses/btc":  fiber.StatusNotFound,
+		"/usernames/alice/addresses/doge": fiber.StatusUnprocessableEntity,
+		"/usernames/carol/addresses/eth":  fiber.StatusNotFound,
+	} {
+		if status, _ := get[models.FailureResponse](t, s.app, path); status != want {
+			t.Errorf("%v status %d, want %d", path, status, want)
+		}
+	}
+}
+
+func TestClearCommands(t *testing.T) {
+	const cid = "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"
+	scenario := testutil.NewScenario(indexer.RuleSets[len(indexer.RuleSets)-1].ActivatedAt.Add(time.Hour))
+	scenario.Inscribe(userA, tokenA, "alice")
+	scenario.SetCid(userA, tokenA, cid)
+	scenario.SetPrimaryName(userA, tokenA)
+	scenario.SetRecord(userA, tokenA, "url", "https://alice.example")
+	scenario.SetRecord(userA, tokenA, "avatar", "https://alice.example/avatar.png")
+	scenario.ClearCid(userB, tokenA)
+	scenario.ClearPrimaryName(userB, tokenA)
+	scenario.ClearRecord(userB, tokenA, "url")
+	scenario.ClearCid(userA, tokenA)
+	scenario.ClearPrimaryName(userA, tokenA)
+	scenario.ClearRecord(userA, tokenA, "url")
+	end := scenario.ClearRecord(userA, tokenA, "email")
+
+	s := newStack(t, testutil.NewServer(t, scenario.History()...), 100, 0)
+	if err := s.index(t, end); err != nil {
+		t.Fatal(err)
+	}
+
+	status, u := getUsername(t, s.app, "alice")
+	if status != fiber.StatusOK || u.CID != nil || u.IsPrimary {
+		t.Fatalf("alice %d %+v, want no CID and not primary", status, u)
+	}
+	status, _ = get[handlers.GetPrimaryUsernameSuccessResponse](t, s.app, "/primary-username/"+userA)
+	if status != fiber.StatusNotFound {
+		t.Errorf("primary username status %d, want 404 after clear_primary_name", status)
+	}
+	_, records := get[handlers.GetRecordsSuccessResponse](t, s.app, "/usernames/alice/records")
+	if want := map[string]string{"avatar": "https://alice.example/avatar.png"}; !reflect.DeepEqual(records.Data, want) {
+		t.Errorf("alice records %v, want %v", records.Data, want)
+	}
+
+	// without a CID the gateway no longer proxies the username subdomain
+	request := httptest.NewRequest(fiber.MethodGet, "/", nil)
+	request.Host = "alice.kns.example"
+	resp, err := s.app.Test(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("alice.kns.example status %d, want 404", resp.StatusCode)
+	}
+
+	events, err := s.db.Events(context.Background(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, event := range events[5:] {
+		types = append(types, event.Type)
+	}
+	if want := []string{"clear_cid", "clear_primary_name", "clear_record", "clear_record"}; !reflect.DeepEqual(types, want) {
+		t.Errorf("alice clear events %v, want %v", types, want)
+	}
+}
+
+func TestSubnames(t *testing.T) {
+	const (
+		cid       = "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"
+		tokenBlog = "keeta_tokenblog"
+		tokenPay  = "keeta_tokenpay"
+	)
+	scenario := testutil.NewScenario(indexer.RuleSets[len(indexer.RuleSets)-1].ActivatedAt.Add(time.Hour))
+	scenario.Inscribe(userA, tokenA, "alice")
+	scenario.Inscribe(userA, tokenBlog, "Blog.Alice")
+	scenario.Inscribe(userB, "keeta_tokenmallory", "pay.alice")
+	scenario.Inscribe(userA, tokenPay, "pay.alice")
+	scenario.Inscribe(userA, "keeta_tokenorphan", "blog.carol")
+	scenario.AssignSubname(userB, tokenBlog, userB)
+	scenario.AssignSubname(userA, tokenA, userB)
+	scenario.AssignSubname(userA, tokenBlog, userB)
+	scenario.SetCid(userB, tokenBlog, cid)
+	end := scenario.Inscribe(userB, "keeta_tokennested", "www.blog.alice")
+
+	s := newStack(t, testutil.NewServer(t, scenario.History()...), 100, 0)
+	if err := s.index(t, end); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]struct{ owner, token, parent string }{
+		"blog.alice":     {userB, tokenBlog, "alice"},
+		"PAY.alice":      {userA, tokenPay, "alice"},
+		"www.blog.alice": {userB, "keeta_tokennested", "blog.alice"},
+	} {
+		status, u := getUsername(t, s.app, name)
+		if status != fiber.StatusOK || u.Owner != want.owner || u.Address != want.token || u.Parent == nil ||
+			*u.Parent != want.parent {
+			t.Errorf("%v %d %+v, want %+v", name, status, u, want)
+		}
+	}
+	if status, u := getUsername(t, s.app, "alice"); status != fiber.StatusOK || u.Owner != userA || u.Parent != nil {
+		t.Errorf("alice %d %+v, want owned by user A without parent", status, u)
+	}
+	if status, _ := getUsername(t, s.app, "blog.carol"); status != fiber.StatusNotFound {
+		t.Errorf("blog.carol status %d, want 404 without parent", status)
+	}
+
+	events, err := s.db.Events(context.Background(), "blog.alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	if want := []string{"inscribe", "assign_subname", "set_cid"}; !reflect.DeepEqual(types, want) {
+		t.Errorf("blog.alice events %v, want %v", types, want)
+	}
+
+	// under the gateway domain every label in front of it is part of the name
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.Path)
+	}))
+	defer gateway.Close()
+	app := fiber.New()
+	app.Get("/*", handlers.NewDomainHandler(s.db, gateway.URL+"/ipfs/", "kns.example"))
+	for host, want := range map[string]string{
+		"blog.alice.kns.example":   "/ipfs/" + cid + "/index.html",
+		"Blog.Alice.KNS.example":   "/ipfs/" + cid + "/index.html",
+		"alice.kns.example":        "",
+		"blog.alice.other.example": "",
+		"kns.example":              "",
+	} {
+		request := httptest.NewRequest(fiber.MethodGet, "/index.html", nil)
+		request.Host = host
+		resp, err := app.Test(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if want == "" && resp.StatusCode != fiber.StatusNotFound ||
+			want != "" && (resp.StatusCode != fiber.StatusOK || string(body) != want) {
+			t.Errorf("%v: %d %s, want %q", host, resp.StatusCode, body, want)
+		}
+	}
+}
+
+func TestUnicodeNames(t *testing.T) {
+	const (
+		cid      = "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"
+		tokenZoe = "keeta_tokenzoe"
+	)
+	scenario := testutil.NewScenario(indexer.RuleSets[len(indexer.RuleSets)-1].ActivatedAt.Add(time.Hour))
+	scenario.Inscribe(userA, tokenZoe, "Zoë")
+	// full-width letters normalize to the name taken above
+	scenario.Inscribe(userB, "keeta_tokenwide", "ｚｏë")
+	scenario.Inscribe(userA, "keeta_tokenrocket", "🚀")
+	// Cyrillic letters passing for "app"
+	scenario.Inscribe(userB, "keeta_tokenapp", "арр")
+	end := scenario.SetCid(userA, tokenZoe, cid)
+
+	s := newStack(t, testutil.NewServer(t, scenario.History()...), 100, 0)
+	if err := s.index(t, end); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{url.PathEscape("zoë"), url.PathEscape("ZOË"), "xn--zo-ija", "XN--ZO-IJA"} {
+		status, u := getUsername(t, s.app, name)
+		if status != fiber.StatusOK || u.Username != "zoë" || u.Owner != userA || u.Display == nil ||
+			*u.Display != "Zoë" {
+			t.Errorf("%v %d %+v, want zoë displayed as Zoë", name, status, u)
+		}
+	}
+	if status, u := getUsername(t, s.app, url.PathEscape("🚀")); status != fiber.StatusOK || u.Display != nil {
+		t.Errorf("rocket %d %+v, want found without display", status, u)
+	}
+	if status, _ := getUsername(t, s.app, url.PathEscape("арр")); status != fiber.StatusNotFound {
+		t.Errorf("confusable name status %d, want 404", status)
+	}
+
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.Path)
+	}))
+	defer gateway.Close()
+	app := fiber.New()
+	app.Get("/*", handlers.NewDomainHandler(s.db, gateway.URL+"/ipfs/", "kns.example"))
+	request := httptest.NewRequest(fiber.MethodGet, "/index.html", nil)
+	request.Host = "xn--zo-ija.kns.example"
+	resp, err := app.Test(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); resp.StatusCode != fiber.StatusOK || string(body) != "/ipfs/"+cid+"/index.html" {
+		t.Errorf("xn--zo-ija.kns.example: %d %s, want the CID of zoë", resp.StatusCode, body)
+	}
+}
+
+// paginationScenario inscribes five usernames and transfers one between malformed history items.
+func paginationScenario() (*devnet.Ledger, string) {
+	s := testutil.NewScenario(scenarioStart)
+	for i, owner := range []string{userA, userB, userA, userB, userA} {
+		s.Inscribe(owner, fmt.Sprintf("keeta_token%d", i), fmt.Sprintf("name%d", i))
+		if i == 2 {
+			s.Append(map[string]any{"voteStaple": "malformed"})
+			s.Transfer(userA, "keeta_token0", devnet.BurnAddress)
+		}
+	}
+	return s, s.Block(userB, userB)
+}
+
+func TestPagination(t *testing.T) {
+	scenario, end := paginationScenario()
+	items := len(scenario.History())
+
+	var want handlers.GetUsernamesSuccessResponse
+	for _, pageLimit := range []int{1, 2, 3, items - 1, items, items + 1} {
+		for _, backfillPages := range []int{0, 2, 20} {
+			t.Run(fmt.Sprintf("pageLimit=%d/backfillPages=%d", pageLimit, backfillPages), func(t *testing.T) {
+				s := newStack(t, testutil.NewServer(t, scenario.History()...), pageLimit, backfillPages)
+				if err := s.index(t, end); err != nil {
+					t.Fatal(err)
+				}
+
+				_, got := get[handlers.GetUsernamesSuccessResponse](t, s.app, "/usernames?sortOrder=asc")
+				if got.Data.Total != 5 {
+					t.Fatalf("total %d, want 5", got.Data.Total)
+				}
+				if want.Data.Usernames == nil {
+					want = got
+				} else if !reflect.DeepEqual(got, want) {
+					t.Fatalf("usernames %+v, want %+v", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestHeadPageGrows(t *testing.T) {
+	scenario := testutil.NewScenario(scenarioStart)
+	first := scenario.Inscribe(userA, tokenA, "alice")
+	server := testutil.NewServer(t, scenario.History()...)
+	s := newStack(t, server, 3, 20)
+	if err := s.index(t, first); err != nil {
+		t.Fatal(err)
+	}
+
+	indexed := len(scenario.History())
+	scenario.Inscribe(userB, tokenB, "bob")
+	scenario.Transfer(userA, tokenA, devnet.BurnAddress)
+	last := scenario.Block(userB, userB)
+	server.Append(scenario.History()[indexed:]...)
+	if err := s.index(t, last); err != nil {
+		t.Fatal(err)
+	}
+
+	if usernames := ownerUsernames(t, s.app, userB); !reflect.DeepEqual(usernames, []string{"bob"}) {
+		t.Errorf("usernames of %v %v, want [bob]", userB, usernames)
+	}
+	if usernames := ownerUsernames(t, s.app, devnet.BurnAddress); !reflect.DeepEqual(usernames, []string{"alice"}) {
+		t.Errorf("usernames of the burn address %v, want [alice]", usernames)
+	}
+}
+
+func TestResumesAfterNodeFailure(t *testing.T) {
+	scenario, end := paginationScenario()
+	server := testutil.NewServer(t, scenario.History()...)
+	s := newStack(t, server, 2, 0)
+
+	server.Fail(1)
+	if err := s.index(t, end); err == nil {
+		t.Fatal("indexer did not stop on the failed request")
+	}
+	if err := s.index(t, end); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, body := get[handlers.GetUsernamesSuccessResponse](t, s.app, "/usernames"); body.Data.Total != 5 {
+		t.Fatalf("total %d, want 5", body.Data.Total)
+	}
+}
+
+func TestDevnetAdminAPI(t *testing.T) {
+	server := testutil.NewServer(t)
+	cfg := config.Default()
+	cfg.Devnet.ListenAddr = strings.TrimPrefix(server.URL, "http://")
+	cfg = devnetConfig(cfg)
+	cfg.Indexer.PollInterval = 5 * time.Millisecond
+	s := startStack(t, cfg)
+
+	inscribed, err := devnet.Post(server.URL, "inscribe", devnet.Command{Account: "alice", Username: "Alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	transferred, err := devnet.Post(server.URL, "transfer", devnet.Command{Account: "bob", Username: "alice", To: "carol"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = devnet.Post(server.URL, "set_cid", devnet.Command{Account: "alice"}); err == nil {
+		t.Fatal("set_cid without token accepted")
+	}
+	if err = s.index(t, transferred.Hash); err != nil {
+		t.Fatal(err)
+	}
+
+	// bob does not own alice, so the transfer has no effect
+	status, u := getUsername(t, s.app, "alice")
+	if status != fiber.StatusOK || u.Owner != devnet.Account("alice") || u.Address != inscribed.Token {
+		t.Fatalf("alice %d %+v, want %v owned by %v", status, u, inscribed.Token, devnet.Account("alice"))
+	}
+
+	transferred, err = devnet.Post(server.URL, "transfer", devnet.Command{Account: "alice", Username: "alice", To: "carol"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.index(t, transferred.Hash); err != nil {
+		t.Fatal(err)
+	}
+	if status, u = getUsername(t, s.app, "alice"); status != fiber.StatusOK || u.Owner != devnet.Account("carol") {
+		t.Errorf("alice %d %+v, want it owned by %v", status, u, devnet.Account("carol"))
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	scenario := testutil.NewScenario(scenarioStart)
+	inscription := scenario.Inscribe(userA, tokenA, "alice")
+	s := newStack(t, testutil.NewServer(t, scenario.History()...), 100, 0)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.app.Listener(listener, fiber.ListenConfig{DisableStartupMessage: true})
+	t.Cleanup(func() {
+		s.stopEvents()
+		s.app.Shutdown()
+	})
+
+	resp, err := http.Get("http://" + listener.Addr().String() + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if contentType := resp.Header.Get(fiber.HeaderContentType); contentType != "text/event-stream" {
+		t.Fatalf("content type %v, want text/event-stream", contentType)
+	}
+
+	lines := make(chan string, 16)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if scanner.Text() != "" {
+				lines <- scanner.Text()
+			}
+		}
+		close(lines)
+	}()
+	if line := <-lines; line != ": subscribed" {
+		t.Fatalf("first line %q, want the subscription comment", line)
+	}
+
+	if err = s.index(t, inscription); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for len(got) < 2 {
+		select {
+		case line := <-lines:
+			got = append(got, line)
+		case <-time.After(10 * time.Second):
+			t.Fatalf("lines %q, want the inscription event", got)
+		}
+	}
+	var action store.Action
+	if got[0] != "event: inscribe" || json.Unmarshal([]byte(strings.TrimPrefix(got[1], "data: ")), &action) != nil {
+		t.Fatalf("lines %q, want the inscription event", got)
+	}
+	if action.Username != "alice" || action.Owner != userA || action.BlockHash != inscription {
+		t.Errorf("action %+v, want alice inscribed by %v in %v", action, userA, inscription)
+	}
+}
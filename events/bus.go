@@ -0,0 +1,110 @@
+// Package events fans the actions committed by the indexer out to subscribers in the API process, whether the
+// indexer runs in the same process or in another one sharing the PostgreSQL database.
+package events
+
+import (
+	"context"
+	"kns-indexer/indexer"
+	"kns-indexer/metrics"
+	"kns-indexer/store"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const relistenDelay = time.Second
+
+var (
+	published = metrics.NewCounter("kns_events_published_total", "Committed actions passed to the event bus")
+	dropped   = metrics.NewCounter("kns_events_dropped_total", "Committed actions dropped for subscribers that fell behind")
+)
+
+// Bus passes every published action to all subscribers.
+type Bus struct {
+	mu          sync.Mutex
+	subscribers map[chan store.Action]struct{}
+	closed      bool
+}
+
+func NewBus() *Bus {
+	return &Bus{subscribers: map[chan store.Action]struct{}{}}
+}
+
+// Subscribe returns a channel receiving the actions published from now on and a function unsubscribing it. Actions
+// are dropped for a subscriber whose buffer is full instead of holding the others up.
+func (b *Bus) Subscribe(buffer int) (<-chan store.Action, func()) {
+	ch := make(chan store.Action, buffer)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+	} else {
+		b.subscribers[ch] = struct{}{}
+	}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Publish passes the action to every subscriber.
+func (b *Bus) Publish(action store.Action) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	published.Inc()
+	for ch := range b.subscribers {
+		select {
+		case ch <- action:
+		default:
+			dropped.Inc()
+		}
+	}
+}
+
+// close closes the channel of every subscriber, present and future.
+func (b *Bus) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Follow publishes the actions committed to the store until the context is done and closes the subscriptions then.
+// On PostgreSQL it listens for the notifications of every indexer sharing the database, reconnecting whenever the
+// connection fails, otherwise it subscribes to the given indexer.
+func (b *Bus) Follow(ctx context.Context, ix *indexer.Indexer, db store.Store) {
+	defer b.close()
+
+	pg, ok := db.(*store.Postgres)
+	if !ok {
+		unsubscribe := ix.Subscribe(b.Publish)
+		<-ctx.Done()
+		unsubscribe()
+		return
+	}
+
+	for {
+		err := pg.Listen(ctx, b.Publish)
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Error("Listening for committed actions failed, listening again", "error", err, "delay", relistenDelay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(relistenDelay):
+		}
+	}
+}
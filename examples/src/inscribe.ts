@@ -15,6 +15,13 @@ async function main() {
     const metadata = Buffer.from(JSON.stringify({decimalPlaces: 0}), 'utf-8').toString('base64');
 
     const builder = userClient.initBuilder();
+
+    // Registration fee from GET /api/fees, paid in the same publish as the inscription
+    if (process.env.FEE_TREASURY_ADDRESS && process.env.FEE_AMOUNT) {
+        const treasury = KeetaNet.lib.Account.fromPublicKeyString(process.env.FEE_TREASURY_ADDRESS);
+        builder.send(treasury, BigInt(process.env.FEE_AMOUNT), userClient.baseToken);
+    }
+
     builder.setInfo({
         name: tokenName,
         description: username,
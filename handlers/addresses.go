@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"errors"
+	"kns-indexer/kns/protocol"
+	"kns-indexer/models"
+	"kns-indexer/store"
+	"log/slog"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+type GetAddressSuccessResponseData struct {
+	Coin     string `json:"coin" example:"eth"`
+	CoinType uint32 `json:"coinType" example:"60"`
+	Address  string `json:"address" example:"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"`
+}
+
+type GetAddressSuccessResponse = models.SuccessResponse[GetAddressSuccessResponseData]
+
+// NewGetAddressHandler godoc
+// @Summary      Resolve username address on a coin
+// @Description  Returns the address a username resolves to on another chain, by coin symbol or SLIP-44 coin type
+// @Tags         username
+// @Accept       json
+// @Produce      json
+// @Param        username  path  string  true  "Username or subname like blog.alice"
+// @Param        coin      path  string  true  "Coin symbol (btc, eth, sol) or SLIP-44 coin type"
+// @Success      200  {object}  GetAddressSuccessResponse
+// @Failure      404  {object}  models.FailureResponse
+// @Failure      422  {object}  models.FailureResponse
+// @Failure      500  {object}  models.FailureResponse
+// @Router       /api/usernames/{username}/addresses/{coin} [get]
+func NewGetAddressHandler(db store.Store) fiber.Handler {
+	return func(ctx fiber.Ctx) error {
+		username := normalizeName(ctx.Params("username"))
+
+		coin, ok := protocol.LookupCoin(strings.ToLower(ctx.Params("coin")))
+		if !ok {
+			symbols := make([]string, len(protocol.Coins))
+			for i, c := range protocol.Coins {
+				symbols[i] = c.Symbol
+			}
+			return ctx.Status(fiber.StatusUnprocessableEntity).JSON(
+				models.FailureResponse{Status: "error", Error: "coin should be one of " + strings.Join(symbols, ", ")},
+			)
+		}
+
+		_, err := db.Username(ctx.Context(), username)
+		if errors.Is(err, store.ErrNotFound) {
+			return ctx.Status(fiber.StatusNotFound).JSON(
+				models.FailureResponse{Status: "error", Error: "username not found"},
+			)
+		} else if err != nil {
+			slog.Error("failed to get username", "username", username, "error", err)
+			return ctx.Status(fiber.StatusInternalServerError).JSON(
+				models.FailureResponse{Status: "error", Error: "internal server error"},
+			)
+		}
+
+		addresses, err := db.Addresses(ctx.Context(), username)
+		if err != nil {
+			slog.Error("failed to get addresses", "username", username, "error", err)
+			return ctx.Status(fiber.StatusInternalServerError).JSON(
+				models.FailureResponse{Status: "error", Error: "internal server error"},
+			)
+		}
+
+		address, ok := addresses[username][coin.Symbol]
+		if !ok {
+			return ctx.Status(fiber.StatusNotFound).JSON(
+				models.FailureResponse{Status: "error", Error: "no " + coin.Symbol + " address set"},
+			)
+		}
+		return ctx.JSON(GetAddressSuccessResponse{
+			Status: "ok", Data: GetAddressSuccessResponseData{Coin: coin.Symbol, CoinType: coin.Type, Address: address},
+		})
+	}
+}
@@ -3,38 +3,56 @@ package handlers
 import (
 	"errors"
 	"kns-indexer/models"
+	"kns-indexer/store"
 	"log/slog"
 	"strings"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/gofiber/fiber/v3/middleware/proxy"
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func NewDomainHandler(pool *pgxpool.Pool) fiber.Handler {
+// NewDomainHandler proxies requests to name subdomains to the CID set for the name on the IPFS gateway. Under the
+// domain every label in front of it is part of the name, so blog.alice.kns.example resolves blog.alice. Without a
+// domain the longest name in front of the last label that exists is resolved, so blog.alice.localhost resolves
+// blog.alice too. Hosts are in ASCII form, xn--zo-ija.kns.example resolves zoë.
+func NewDomainHandler(db store.Store, ipfsGateway, domain string) fiber.Handler {
 	return func(ctx fiber.Ctx) error {
-		hostname := ctx.Hostname()
-		username := strings.SplitN(hostname, ".", 2)[0]
-		if username == hostname {
-			return ctx.Next()
+		for _, username := range hostNames(strings.ToLower(ctx.Hostname()), domain) {
+			u, err := db.Username(ctx.Context(), normalizeName(username))
+			if errors.Is(err, store.ErrNotFound) {
+				continue
+			} else if err != nil {
+				slog.Error("failed to get CID by username", "username", username, "error", err)
+				return ctx.Status(fiber.StatusInternalServerError).JSON(
+					models.FailureResponse{Status: "error", Error: "internal server error"},
+				)
+			}
+			if u.CID == nil {
+				break
+			}
+			return proxy.Do(ctx, ipfsGateway+*u.CID+ctx.OriginalURL())
 		}
+		return ctx.Next()
+	}
+}
 
-		var cid *string
-
-		err := pool.QueryRow(
-			ctx.Context(), "SELECT cid FROM username WHERE username = $1;", strings.ToLower(username),
-		).Scan(&cid)
-
-		if errors.Is(err, pgx.ErrNoRows) || cid == nil {
-			return ctx.Next()
-		} else if err != nil {
-			slog.Error("failed to get CID by username", "username", username, "error", err)
-			return ctx.Status(fiber.StatusInternalServerError).JSON(
-				models.FailureResponse{Status: "error", Error: "internal server error"},
-			)
+// hostNames returns the names the host may be a subdomain of, the most specific first: the labels in front of the
+// domain, or without one every run of leading labels short of the last label.
+func hostNames(hostname, domain string) []string {
+	if domain != "" {
+		name, ok := strings.CutSuffix(hostname, "."+domain)
+		if !ok || name == "" {
+			return nil
 		}
+		return []string{name}
+	}
 
-		return proxy.Do(ctx, "https://dweb.link/ipfs/"+*cid+ctx.OriginalURL())
+	labels := strings.Split(hostname, ".")
+	names := []string{}
+	for i := len(labels) - 1; i > 0; i-- {
+		if name := strings.Join(labels[:i], "."); name != "" {
+			names = append(names, name)
+		}
 	}
+	return names
 }
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"kns-indexer/events"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+const eventsKeepAlive = 15 * time.Second
+
+// NewEventsHandler godoc
+// @Summary      Stream committed actions
+// @Description  Streams the KNS actions committed by the indexer from now on as server-sent events named after the action type. Actions are dropped for clients that fall behind
+// @Tags         events
+// @Produce      text/event-stream
+// @Success      200  {object}  store.Action
+// @Router       /api/events [get]
+func NewEventsHandler(bus *events.Bus) fiber.Handler {
+	return func(ctx fiber.Ctx) error {
+		ctx.Set(fiber.HeaderContentType, "text/event-stream")
+		ctx.Set(fiber.HeaderCacheControl, "no-cache")
+
+		actions, unsubscribe := bus.Subscribe(64)
+		return ctx.SendStreamWriter(func(w *bufio.Writer) {
+			defer unsubscribe()
+
+			// lets the client know it is subscribed before the first action
+			fmt.Fprint(w, ": subscribed\n\n")
+			if err := w.Flush(); err != nil {
+				return
+			}
+
+			keepAlive := time.NewTicker(eventsKeepAlive)
+			defer keepAlive.Stop()
+
+			for {
+				select {
+				case action, ok := <-actions:
+					if !ok {
+						return
+					}
+					data, err := json.Marshal(action)
+					if err != nil {
+						slog.Error("failed to encode action", "action", action, "error", err)
+						continue
+					}
+					fmt.Fprintf(w, "event: %s\ndata: %s\n\n", action.Type, data)
+				case <-keepAlive.C:
+					fmt.Fprint(w, ": keep-alive\n\n")
+				}
+				// fails once the client is gone
+				if err := w.Flush(); err != nil {
+					return
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"kns-indexer/indexer"
+	"kns-indexer/models"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+type GetFeesSuccessResponse = models.SuccessResponse[models.FeeSchedule]
+
+// NewGetFeesHandler godoc
+// @Summary      Get registration fee schedule
+// @Description  Returns registration fee tiers by username length of the protocol version active now. An inscription is accepted only if its block or the linked identifier block sends at least the fee in the base token to the treasury; each payment pays for a single inscription. Returns 503 before the first protocol version activates
+// @Tags         protocol
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  GetFeesSuccessResponse
+// @Failure      503  {object}  models.FailureResponse
+// @Router       /api/fees [get]
+func NewGetFeesHandler(ix *indexer.Indexer) fiber.Handler {
+	return func(ctx fiber.Ctx) error {
+		rules := ix.RulesAt(time.Now())
+		if rules == nil {
+			return ctx.Status(fiber.StatusServiceUnavailable).JSON(
+				models.FailureResponse{Status: "error", Error: "no protocol version is active yet"},
+			)
+		}
+
+		schedule := models.FeeSchedule{ProtocolVersion: rules.Version, ActivatedAt: rules.ActivatedAt, Tiers: []models.FeeTier{}}
+		if rules.Fee != nil {
+			schedule.Enabled = true
+			schedule.Treasury = rules.Fee.Treasury
+			schedule.BaseToken = rules.Fee.BaseToken
+
+			minLength := 1
+			for _, tier := range rules.Fee.Tiers {
+				schedule.Tiers = append(
+					schedule.Tiers,
+					models.FeeTier{MinLength: minLength, MaxLength: tier.MaxLength, Amount: tier.Amount.String()},
+				)
+				minLength = tier.MaxLength + 1
+			}
+		}
+
+		return ctx.JSON(GetFeesSuccessResponse{Status: "ok", Data: schedule})
+	}
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"bytes"
+	"kns-indexer/metrics"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// NewMetricsHandler godoc
+// @Summary      Get metrics
+// @Description  Returns indexer metrics in Prometheus text exposition format
+// @Tags         status
+// @Produce      plain
+// @Success      200  {string}  string
+// @Router       /api/metrics [get]
+func NewMetricsHandler() fiber.Handler {
+	return func(ctx fiber.Ctx) error {
+		var buf bytes.Buffer
+		if err := metrics.Write(&buf); err != nil {
+			return err
+		}
+		ctx.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+		return ctx.Send(buf.Bytes())
+	}
+}
@@ -2,12 +2,11 @@ package handlers
 
 import (
 	"kns-indexer/models"
+	"kns-indexer/store"
 	"log/slog"
 	"strconv"
 
 	"github.com/gofiber/fiber/v3"
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type GetOwnerUsernamesSuccessResponseData struct {
@@ -27,11 +26,12 @@ type GetOwnerUsernamesSuccessResponse = models.SuccessResponse[GetOwnerUsernames
 // @Param        limit      query     int     false  "Number of records per page"                                      default(100)  minimum(1)    maximum(100)
 // @Param        offset     query     int     false  "Offset for pagination (starts from 0)"                           default(0)    minimum(0)
 // @Param        sortOrder  query     string  false  "Sort order by timestamp: asc or desc"                            default(desc) enums(asc,desc)
+// @Param        records    query     bool    false  "Include the text records and coin addresses of each username"  default(false)
 // @Success      200        {object}  GetOwnerUsernamesSuccessResponse                                      "Successfully retrieved usernames"
 // @Failure      422        {object}  models.FailureResponse                                           "Invalid query parameters"
 // @Failure      500        {object}  models.FailureResponse                                           "Internal server error"
 // @Router       /api/usernames/owner/{owner} [get]
-func NewGetOwnerUsernamesHandler(pool *pgxpool.Pool) fiber.Handler {
+func NewGetOwnerUsernamesHandler(db store.Store) fiber.Handler {
 	return func(ctx fiber.Ctx) error {
 		limitStr := ctx.Query("limit", "100")
 		limit, err := strconv.Atoi(limitStr)
@@ -56,41 +56,17 @@ func NewGetOwnerUsernamesHandler(pool *pgxpool.Pool) fiber.Handler {
 			)
 		}
 
-		var total uint
-
-		conn, err := pool.Acquire(ctx.Context())
-		if err != nil {
-			slog.Error("failed to acquire connection", "error", err)
-			return ctx.Status(fiber.StatusInternalServerError).JSON(
-				models.FailureResponse{Status: "error", Error: "internal server error"},
-			)
-		}
-		defer conn.Release()
-
 		owner := ctx.Params("owner")
 
-		if err = conn.QueryRow(ctx.Context(), "SELECT COUNT(*) FROM username WHERE owner = $1;", owner).Scan(&total); err != nil {
-			slog.Error("failed to total usernames", "error", err)
-			return ctx.Status(fiber.StatusInternalServerError).JSON(
-				models.FailureResponse{Status: "error", Error: "internal server error"},
-			)
-		}
-
-		rows, err := conn.Query(
-			ctx.Context(),
-			"SELECT username, address, owner, cid, is_primary, timestamp FROM username WHERE owner = $1 ORDER BY timestamp "+sortOrder+" LIMIT $2 OFFSET $3;",
-			owner, limit, offset,
-		)
+		usernames, total, err := db.Usernames(ctx.Context(), owner, sortOrder == "desc", limit, offset)
 		if err != nil {
 			slog.Error("failed to get usernames", "owner", owner, "error", err)
 			return ctx.Status(fiber.StatusInternalServerError).JSON(
 				models.FailureResponse{Status: "error", Error: "internal server error"},
 			)
 		}
-
-		usernames, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.Username])
-		if err != nil {
-			slog.Error("failed to parse usernames", "error", err)
+		if err = attachRecords(ctx, db, usernames); err != nil {
+			slog.Error("failed to get records", "owner", owner, "error", err)
 			return ctx.Status(fiber.StatusInternalServerError).JSON(
 				models.FailureResponse{Status: "error", Error: "internal server error"},
 			)
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"kns-indexer/models"
+	"kns-indexer/store"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+type GetPendingActionsSuccessResponse = models.SuccessResponse[[]models.PendingAction]
+
+// NewGetPendingActionsHandler godoc
+// @Summary      Get pending actions
+// @Description  Returns KNS actions from vote staples that are not final yet. They are not reflected in usernames until final and are dropped if they never become final
+// @Tags         pending
+// @Accept       json
+// @Produce      json
+// @Param        account  query     string  false  "Filter by account that issued the action"
+// @Success      200      {object}  GetPendingActionsSuccessResponse
+// @Failure      500      {object}  models.FailureResponse
+// @Router       /api/pending-actions [get]
+func NewGetPendingActionsHandler(db store.Store) fiber.Handler {
+	return func(ctx fiber.Ctx) error {
+		account := ctx.Query("account")
+
+		pendingActions, err := db.PendingActions(ctx.Context(), account)
+		if err != nil {
+			slog.Error("failed to get pending actions", "error", err)
+			return ctx.Status(fiber.StatusInternalServerError).JSON(
+				models.FailureResponse{Status: "error", Error: "internal server error"},
+			)
+		}
+
+		return ctx.JSON(GetPendingActionsSuccessResponse{Status: "ok", Data: pendingActions})
+	}
+}
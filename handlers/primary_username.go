@@ -3,11 +3,10 @@ package handlers
 import (
 	"errors"
 	"kns-indexer/models"
+	"kns-indexer/store"
 	"log/slog"
 
 	"github.com/gofiber/fiber/v3"
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type GetPrimaryUsernameSuccessResponse = models.SuccessResponse[models.Username]
@@ -19,23 +18,17 @@ type GetPrimaryUsernameSuccessResponse = models.SuccessResponse[models.Username]
 // @Accept       json
 // @Produce      json
 // @Param        owner  path  string  true  "Owner"
+// @Param        records   query  bool  false  "Include the text records and coin addresses of the username"  default(false)
 // @Success      200  {object}  GetPrimaryUsernameSuccessResponse
 // @Failure      404  {object}  models.FailureResponse
 // @Failure      500  {object}  models.FailureResponse
 // @Router       /api/primary-username/{owner} [get]
-func NewGetPrimaryUsernameHandler(pool *pgxpool.Pool) fiber.Handler {
+func NewGetPrimaryUsernameHandler(db store.Store) fiber.Handler {
 	return func(ctx fiber.Ctx) error {
 		owner := ctx.Params("owner")
 
-		var u models.Username
-
-		err := pool.QueryRow(
-			ctx.Context(),
-			"SELECT username, address, cid, is_primary, timestamp FROM username WHERE owner = $1 AND is_primary = true;",
-			owner,
-		).Scan(&u.Username, &u.Address, &u.CID, &u.IsPrimary, &u.Timestamp)
-
-		if errors.Is(err, pgx.ErrNoRows) {
+		u, err := db.PrimaryUsername(ctx.Context(), owner)
+		if errors.Is(err, store.ErrNotFound) {
 			return ctx.Status(fiber.StatusNotFound).JSON(
 				models.FailureResponse{Status: "error", Error: "no primary username set"},
 			)
@@ -46,8 +39,14 @@ func NewGetPrimaryUsernameHandler(pool *pgxpool.Pool) fiber.Handler {
 			)
 		}
 
-		u.Owner = owner
+		usernames := []models.Username{u}
+		if err = attachRecords(ctx, db, usernames); err != nil {
+			slog.Error("failed to get records", "owner", owner, "error", err)
+			return ctx.Status(fiber.StatusInternalServerError).JSON(
+				models.FailureResponse{Status: "error", Error: "internal server error"},
+			)
+		}
 
-		return ctx.JSON(GetPrimaryUsernameSuccessResponse{Status: "ok", Data: u})
+		return ctx.JSON(GetPrimaryUsernameSuccessResponse{Status: "ok", Data: usernames[0]})
 	}
 }
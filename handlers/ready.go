@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"kns-indexer/indexer"
+	"kns-indexer/models"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+type GetReadySuccessResponse = models.SuccessResponse[models.Health]
+
+// NewGetReadyHandler godoc
+// @Summary      Readiness probe
+// @Description  Returns 200 while the indexer is healthy and 503 once it failed INDEXER_MAX_FAILURES times in a row, so orchestrators can restart it instead of serving stale data
+// @Tags         status
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  GetReadySuccessResponse
+// @Failure      503  {object}  models.FailureResponse
+// @Router       /api/ready [get]
+func NewGetReadyHandler(ix *indexer.Indexer) fiber.Handler {
+	return func(ctx fiber.Ctx) error {
+		if !ix.Ready() {
+			health := ix.Status().Health
+			return ctx.Status(fiber.StatusServiceUnavailable).JSON(
+				models.FailureResponse{Status: "error", Error: "indexer is failing: " + health.LastError},
+			)
+		}
+		return ctx.JSON(GetReadySuccessResponse{Status: "ok", Data: ix.Status().Health})
+	}
+}
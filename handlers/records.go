@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"errors"
+	"kns-indexer/models"
+	"kns-indexer/store"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+type GetRecordsSuccessResponse = models.SuccessResponse[map[string]string]
+
+// NewGetRecordsHandler godoc
+// @Summary      Get username records
+// @Description  Returns the text records set on a username by key
+// @Tags         username
+// @Accept       json
+// @Produce      json
+// @Param        username  path  string  true  "Username or subname like blog.alice"
+// @Success      200  {object}  GetRecordsSuccessResponse
+// @Failure      404  {object}  models.FailureResponse
+// @Failure      500  {object}  models.FailureResponse
+// @Router       /api/usernames/{username}/records [get]
+func NewGetRecordsHandler(db store.Store) fiber.Handler {
+	return func(ctx fiber.Ctx) error {
+		username := normalizeName(ctx.Params("username"))
+
+		_, err := db.Username(ctx.Context(), username)
+		if errors.Is(err, store.ErrNotFound) {
+			return ctx.Status(fiber.StatusNotFound).JSON(
+				models.FailureResponse{Status: "error", Error: "username not found"},
+			)
+		} else if err != nil {
+			slog.Error("failed to get username", "username", username, "error", err)
+			return ctx.Status(fiber.StatusInternalServerError).JSON(
+				models.FailureResponse{Status: "error", Error: "internal server error"},
+			)
+		}
+
+		records, err := db.Records(ctx.Context(), username)
+		if err != nil {
+			slog.Error("failed to get records", "username", username, "error", err)
+			return ctx.Status(fiber.StatusInternalServerError).JSON(
+				models.FailureResponse{Status: "error", Error: "internal server error"},
+			)
+		}
+
+		data := records[username]
+		if data == nil {
+			data = map[string]string{}
+		}
+		return ctx.JSON(GetRecordsSuccessResponse{Status: "ok", Data: data})
+	}
+}
+
+// attachRecords fills in the records and coin addresses of the usernames when the request asks for them with
+// ?records=true.
+func attachRecords(ctx fiber.Ctx, db store.Store, usernames []models.Username) error {
+	if ctx.Query("records") != "true" {
+		return nil
+	}
+	return store.AttachRecords(ctx.Context(), db, usernames)
+}
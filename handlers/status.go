@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"kns-indexer/indexer"
+	"kns-indexer/models"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+type GetStatusSuccessResponse = models.SuccessResponse[models.Status]
+
+// NewGetStatusHandler godoc
+// @Summary      Get indexer status
+// @Description  Returns sync progress of the indexer, agreement of the upstream nodes history is cross-checked between and the replica currently running the indexer
+// @Tags         status
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  GetStatusSuccessResponse
+// @Router       /api/status [get]
+func NewGetStatusHandler(ix *indexer.Indexer) fiber.Handler {
+	return func(ctx fiber.Ctx) error {
+		return ctx.JSON(GetStatusSuccessResponse{Status: "ok", Data: ix.Status()})
+	}
+}
@@ -2,13 +2,14 @@ package handlers
 
 import (
 	"errors"
+	"kns-indexer/kns/protocol"
 	"kns-indexer/models"
+	"kns-indexer/store"
 	"log/slog"
+	"net/url"
 	"strings"
 
 	"github.com/gofiber/fiber/v3"
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type GetUsernameSuccessResponse = models.SuccessResponse[models.Username]
@@ -19,24 +20,18 @@ type GetUsernameSuccessResponse = models.SuccessResponse[models.Username]
 // @Tags         username
 // @Accept       json
 // @Produce      json
-// @Param        username  path  string  true  "Username"
+// @Param        username  path  string  true  "Username or subname like blog.alice"
+// @Param        records   query  bool  false  "Include the text records and coin addresses of the username"  default(false)
 // @Success      200  {object}  GetUsernameSuccessResponse
 // @Failure      404  {object}  models.FailureResponse
 // @Failure      500  {object}  models.FailureResponse
 // @Router       /api/usernames/{username} [get]
-func NewGetUsernameHandler(pool *pgxpool.Pool) fiber.Handler {
+func NewGetUsernameHandler(db store.Store) fiber.Handler {
 	return func(ctx fiber.Ctx) error {
-		username := ctx.Params("username")
+		username := normalizeName(ctx.Params("username"))
 
-		var u models.Username
-
-		err := pool.QueryRow(
-			ctx.Context(),
-			"SELECT address, owner, cid, is_primary, timestamp FROM username WHERE username = $1;",
-			strings.ToLower(username),
-		).Scan(&u.Address, &u.Owner, &u.CID, &u.IsPrimary, &u.Timestamp)
-
-		if errors.Is(err, pgx.ErrNoRows) {
+		u, err := db.Username(ctx.Context(), username)
+		if errors.Is(err, store.ErrNotFound) {
 			return ctx.Status(fiber.StatusNotFound).JSON(
 				models.FailureResponse{Status: "error", Error: "username not found"},
 			)
@@ -47,8 +42,28 @@ func NewGetUsernameHandler(pool *pgxpool.Pool) fiber.Handler {
 			)
 		}
 
-		u.Username = username
+		usernames := []models.Username{u}
+		if err = attachRecords(ctx, db, usernames); err != nil {
+			slog.Error("failed to get records", "username", username, "error", err)
+			return ctx.Status(fiber.StatusInternalServerError).JSON(
+				models.FailureResponse{Status: "error", Error: "internal server error"},
+			)
+		}
 
-		return ctx.JSON(GetUsernameSuccessResponse{Status: "ok", Data: u})
+		return ctx.JSON(GetUsernameSuccessResponse{Status: "ok", Data: usernames[0]})
+	}
+}
+
+// normalizeName returns the username a name in a request stands for. Names can be percent-encoded or in their ASCII
+// form and are normalized like inscribed ones, names that are not valid are only lower-cased.
+func normalizeName(name string) string {
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	if unicode, err := protocol.ToUnicode(name); err == nil {
+		if normalized, err := protocol.ParseName(unicode); err == nil {
+			return normalized
+		}
 	}
+	return strings.ToLower(name)
 }
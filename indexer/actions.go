@@ -0,0 +1,207 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"kns-indexer/kns/protocol"
+	"kns-indexer/store"
+	"slices"
+)
+
+const (
+	ActionInscribe       = "inscribe"
+	ActionTransfer       = "transfer"
+	ActionSetPrimaryName = "set_primary_name"
+	ActionSetCid         = "set_cid"
+	ActionSetRecord      = "set_record"
+	ActionSetAddress     = "set_address"
+
+	ActionClearPrimaryName = "clear_primary_name"
+	ActionClearCid         = "clear_cid"
+	ActionClearRecord      = "clear_record"
+
+	ActionAssignSubname = "assign_subname"
+)
+
+// Actions decodes the KNS actions of a block according to the rules. Each fee payment pays for the first inscription
+// it covers only.
+func (r *Rules) Actions(block Block, lastBlockOperations []Operation) []store.Action {
+	var (
+		actions      []store.Action
+		usedPayments = map[*Operation]bool{}
+	)
+	for position := range block.Operations {
+		if action, ok := r.action(block, position, lastBlockOperations, usedPayments); ok {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+// Action decodes the KNS action of the block operation at the position, if any, with the fee payments used by the
+// operations before it.
+func (r *Rules) Action(block Block, position int, lastBlockOperations []Operation) (store.Action, bool) {
+	for _, action := range r.Actions(block, lastBlockOperations) {
+		if action.Position == position {
+			return action, true
+		}
+	}
+	return store.Action{}, false
+}
+
+func (r *Rules) action(
+	block Block, position int, lastBlockOperations []Operation, usedPayments map[*Operation]bool,
+) (store.Action, bool) {
+	operation := block.Operations[position]
+
+	action := store.Action{
+		BlockHash: block.Hash,
+		Position:  position,
+		Account:   block.Account,
+		Timestamp: block.Date,
+	}
+
+	if r.IsInscribeInstruction(operation, block.Account, block.Operations, lastBlockOperations, usedPayments) {
+		action.Type = ActionInscribe
+		action.Token = block.Account
+		action.Username, _ = r.parseName(operation.Description)
+		action.Owner = block.Signer
+		if r.Names && operation.Description != action.Username {
+			action.Value = operation.Description
+		}
+	} else if r.IsSetPrimaryNameOrCidInstruction(operation) {
+		command, _ := protocol.ParseMemo(*operation.Extra)
+		if command != nil && !slices.Contains(r.Commands, command.Name()) {
+			command = nil
+		}
+		switch command := command.(type) {
+		case protocol.SetPrimaryName:
+			action.Type = ActionSetPrimaryName
+			action.Token = command.Token
+		case protocol.SetCID:
+			action.Type = ActionSetCid
+			action.Token, action.CID = command.Token, command.CID
+		case protocol.SetRecord:
+			action.Type = ActionSetRecord
+			action.Token, action.Key, action.Value = command.Token, command.Key, command.Value
+		case protocol.SetAddress:
+			action.Type = ActionSetAddress
+			action.Token, action.Key, action.Value = command.Token, command.Coin, command.Address
+		case protocol.ClearPrimaryName:
+			action.Type = ActionClearPrimaryName
+			action.Token = command.Token
+		case protocol.ClearCID:
+			action.Type = ActionClearCid
+			action.Token = command.Token
+		case protocol.ClearRecord:
+			action.Type = ActionClearRecord
+			action.Token, action.Key = command.Token, command.Key
+		case protocol.AssignSubname:
+			action.Type = ActionAssignSubname
+			action.Token, action.Owner = command.Token, command.Owner
+		default:
+			if !r.IsTransferInstruction(operation) {
+				return store.Action{}, false
+			}
+			action.Type = ActionTransfer
+			action.Token = operation.Token
+			action.Owner = operation.To
+		}
+		if r.MemoAsToken && action.Type != ActionTransfer {
+			if action.Type == ActionSetCid {
+				action.CID = action.Token
+			}
+			action.Token = *operation.Extra
+		}
+	} else if r.DirectTransfers && r.IsTransferInstruction(operation) && operation.To != r.BurnAddress {
+		action.Type = ActionTransfer
+		action.Token = operation.Token
+		action.Owner = operation.To
+	} else {
+		return store.Action{}, false
+	}
+
+	return action, true
+}
+
+// applyAction applies the action inside the transaction and records it in the event history if it changed the
+// state, returning it with the affected username.
+func applyAction(ctx context.Context, tx store.Tx, action store.Action) (store.Action, bool, error) {
+	var (
+		applied bool
+		err     error
+	)
+
+	switch action.Type {
+	case ActionInscribe:
+		if parent := protocol.Parent(action.Username); parent != "" {
+			applied, err = tx.InsertSubname(
+				ctx, action.Username, action.Value, parent, action.Token, action.Owner, action.Timestamp,
+			)
+		} else {
+			applied, err = tx.InsertUsername(ctx, action.Username, action.Value, action.Token, action.Owner, action.Timestamp)
+		}
+	case ActionSetPrimaryName:
+		action.Username, err = tx.SetPrimaryName(ctx, action.Token, action.Account)
+		applied = action.Username != ""
+	case ActionSetCid:
+		action.Username, err = tx.SetCid(ctx, action.Token, action.Account, action.CID)
+		applied = action.Username != ""
+	case ActionSetRecord:
+		action.Username, err = tx.SetRecord(ctx, action.Token, action.Account, action.Key, action.Value)
+		applied = action.Username != ""
+	case ActionSetAddress:
+		action.Username, err = tx.SetAddress(ctx, action.Token, action.Account, action.Key, action.Value)
+		applied = action.Username != ""
+	case ActionClearPrimaryName:
+		action.Username, err = tx.ClearPrimaryName(ctx, action.Token, action.Account)
+		applied = action.Username != ""
+	case ActionClearCid:
+		action.Username, err = tx.ClearCid(ctx, action.Token, action.Account)
+		applied = action.Username != ""
+	case ActionClearRecord:
+		action.Username, err = tx.ClearRecord(ctx, action.Token, action.Account, action.Key)
+		applied = action.Username != ""
+	case ActionAssignSubname:
+		action.Username, err = tx.AssignSubname(ctx, action.Token, action.Account, action.Owner)
+		applied = action.Username != ""
+	case ActionTransfer:
+		action.Username, err = tx.TransferUsername(ctx, action.Token, action.Account, action.Owner)
+		applied = action.Username != ""
+	}
+
+	if err != nil || !applied {
+		return action, false, err
+	}
+	if err = tx.RecordEvent(ctx, action); err != nil {
+		return action, false, err
+	}
+	return action, true, nil
+}
+
+// describe returns the log line of an applied action.
+func describe(action store.Action) string {
+	switch action.Type {
+	case ActionInscribe:
+		return fmt.Sprintf("%v inscribed username %v", action.Owner, action.Username)
+	case ActionSetPrimaryName:
+		return fmt.Sprintf("%v set primary name %v", action.Account, action.Username)
+	case ActionSetCid:
+		return fmt.Sprintf("%v set CID %v to %v", action.Account, action.CID, action.Username)
+	case ActionSetRecord:
+		return fmt.Sprintf("%v set record %v of %v to %q", action.Account, action.Key, action.Username, action.Value)
+	case ActionSetAddress:
+		return fmt.Sprintf("%v set %v address of %v to %v", action.Account, action.Key, action.Username, action.Value)
+	case ActionClearPrimaryName:
+		return fmt.Sprintf("%v cleared primary name %v", action.Account, action.Username)
+	case ActionClearCid:
+		return fmt.Sprintf("%v cleared CID of %v", action.Account, action.Username)
+	case ActionClearRecord:
+		return fmt.Sprintf("%v cleared record %v of %v", action.Account, action.Key, action.Username)
+	case ActionAssignSubname:
+		return fmt.Sprintf("%v assigned subname %v to %v", action.Account, action.Username, action.Owner)
+	case ActionTransfer:
+		return fmt.Sprintf("%v transferred username %v to %v", action.Account, action.Username, action.Owner)
+	}
+	return fmt.Sprintf("%v applied %v to %v", action.Account, action.Type, action.Username)
+}
@@ -0,0 +1,77 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"kns-indexer/store"
+	"log/slog"
+)
+
+// backfill applies up to indexer.backfill_pages pages in one bulk transaction while the indexer is more than a page
+// behind the chain head. The pages are fetched before the transaction begins so it is only open for the write.
+func (ix *Indexer) backfill(ctx context.Context, db store.Bulk, c cursor) (cursor, error) {
+	type fetchedPage struct {
+		metadata map[string]any
+		history  map[string]any
+	}
+	var fetched []fetchedPage
+	for page := c.page; len(fetched) < ix.cfg.Indexer.BackfillPages; page++ {
+		pageMetadata, err := ix.FetchPageMetadata(ctx, page)
+		if err != nil {
+			return c, fmt.Errorf("failed to fetch page metadata of page %d: %w", page, err)
+		}
+
+		history, err := ix.FetchAgreedHistory(ctx, page, pageMetadata)
+		if err != nil {
+			return c, fmt.Errorf("failed to fetch ledger history of page %d: %w", page, err)
+		}
+		fetched = append(fetched, fetchedPage{pageMetadata, history})
+
+		// the head page goes through the per-page path
+		if page+1 >= totalPages(pageMetadata) {
+			break
+		}
+	}
+
+	transaction, err := db.BeginBulk(ctx)
+	if err != nil {
+		return c, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer transaction.Rollback(context.Background())
+
+	var (
+		next    = c
+		applied []store.Action
+		pages   int
+	)
+	for _, page := range fetched {
+		pageNext, pageApplied, err := ix.applyPage(ctx, transaction, next, page.metadata, page.history)
+		if err != nil {
+			return c, fmt.Errorf("failed to apply page %d: %w", next.page, err)
+		}
+		applied = append(applied, pageApplied...)
+		pages++
+
+		advanced := pageNext.page != next.page
+		next = pageNext
+		next.totalPages = totalPages(page.metadata)
+
+		// the head page and pages with pending blocks go through the per-page path
+		if !advanced || !next.behind() {
+			break
+		}
+	}
+
+	if err = transaction.Commit(ctx); err != nil {
+		return c, fmt.Errorf("failed to commit backfill of pages %d-%d: %w", c.page, next.page, err)
+	}
+
+	for _, action := range applied {
+		slog.Debug(describe(action))
+	}
+	ix.publish(applied)
+
+	slog.Info("Backfilled", "pages", pages, "page", next.page)
+
+	return next, nil
+}
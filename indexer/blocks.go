@@ -1,18 +1,63 @@
 package indexer
 
 import (
+	"errors"
+	"kns-indexer/store"
 	"sort"
 )
 
-func sortedBlocks(history map[string]any) []map[string]any {
-	var blocks []map[string]any
-	for _, h := range history["history"].([]any) {
-		for _, b := range h.(map[string]any)["voteStaple"].(map[string]any)["blocks"].([]any) {
-			blocks = append(blocks, b.(map[string]any))
+type stapledBlock struct {
+	raw   map[string]any
+	block Block
+	final bool
+	// verifyErr is set when local verification of the vote staple failed
+	verifyErr error
+	// deadLetters are the operations of the block that failed decoding
+	deadLetters []store.DeadLetter
+}
+
+// sortedBlocks returns the blocks of the history page ordered by date together with the vote staples and blocks
+// that could not be decoded.
+func (ix *Indexer) sortedBlocks(history map[string]any) ([]stapledBlock, []store.DeadLetter) {
+	var (
+		blocks      []stapledBlock
+		deadLetters []store.DeadLetter
+	)
+
+	historyItems, _ := history["history"].([]any)
+	for _, h := range historyItems {
+		item, _ := h.(map[string]any)
+		voteStaple, _ := item["voteStaple"].(map[string]any)
+		rawBlocks, ok := voteStaple["blocks"].([]any)
+		if !ok {
+			deadLetters = append(deadLetters, store.DeadLetter{Stage: StageStaple, Err: errors.New("malformed vote staple"), Raw: h})
+			continue
+		}
+
+		final := ix.IsFinal(voteStaple)
+		var verifyErr error
+		if ix.cfg.Indexer.VerifySignatures {
+			verifyErr = ix.verifyStaple(voteStaple)
+		}
+
+		for _, b := range rawBlocks {
+			raw, _ := b.(map[string]any)
+			block, blockDeadLetters, err := decodeBlock(b)
+			if err != nil {
+				hash, _ := raw["$hash"].(string)
+				deadLetters = append(deadLetters, store.DeadLetter{
+					Stage: StageBlock, BlockHash: hash, Err: err, Raw: b, Context: map[string]any{"voteStaple": voteStaple},
+				})
+				continue
+			}
+			blocks = append(blocks, stapledBlock{
+				raw: raw, block: block, final: final, verifyErr: verifyErr, deadLetters: blockDeadLetters,
+			})
 		}
 	}
-	sort.Slice(blocks, func(i, j int) bool {
-		return blocks[i]["date"].(string) < blocks[j]["date"].(string)
+
+	sort.SliceStable(blocks, func(i, j int) bool {
+		return blocks[i].block.Date.Before(blocks[j].block.Date)
 	})
-	return blocks
+	return blocks, deadLetters
 }
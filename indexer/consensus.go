@@ -0,0 +1,144 @@
+package indexer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kns-indexer/metrics"
+	"kns-indexer/models"
+	"log/slog"
+	"time"
+)
+
+var (
+	ErrNoConsensus = errors.New("no quorum of nodes agrees on history")
+
+	consensusRounds        = metrics.NewCounter("kns_consensus_rounds_total", "History pages fetched from all nodes")
+	consensusDisagreements = metrics.NewCounter("kns_consensus_disagreements_total", "History pages nodes disagreed on, by whether quorum was still met")
+	sourceErrors           = metrics.NewCounter("kns_source_errors_total", "Failed history fetches by node")
+	sourceDissents         = metrics.NewCounter("kns_source_dissents_total", "History pages a node returned outside the quorum by node")
+)
+
+// FetchAgreedHistory fetches the history page from every node and returns it only when at least keeta.quorum nodes
+// return the same page, votes included. It returns as soon as a quorum agrees, canceling the fetches from the nodes
+// that did not respond yet.
+func (ix *Indexer) FetchAgreedHistory(
+	ctx context.Context, page int, pageMetadata map[string]any,
+) (map[string]any, error) {
+	type result struct {
+		source      int
+		history     map[string]any
+		fingerprint string
+		err         error
+	}
+
+	baseURLs := ix.cfg.Keeta.BaseURLs
+	fetchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// buffered for every node, so the fetches left behind once a quorum agrees do not block
+	responses := make(chan result, len(baseURLs))
+	for i, baseURL := range baseURLs {
+		go func() {
+			r := result{source: i}
+			r.history, r.err = ix.FetchLedgerHistory(fetchCtx, baseURL, pageMetadata)
+			if r.err == nil {
+				r.fingerprint, r.err = historyFingerprint(r.history)
+			}
+			responses <- r
+		}()
+	}
+
+	// nil for the nodes that did not respond before the quorum agreed
+	results := make([]*result, len(baseURLs))
+	agreed := map[string]int{}
+	var best string
+	for received := 0; received < len(baseURLs) && agreed[best] < ix.cfg.Keeta.Quorum; received++ {
+		r := <-responses
+		results[r.source] = &r
+		if r.err != nil {
+			continue
+		}
+		agreed[r.fingerprint]++
+		if agreed[r.fingerprint] > agreed[best] {
+			best = r.fingerprint
+		}
+	}
+	cancel()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	consensusRounds.Inc()
+	quorumMet := agreed[best] >= ix.cfg.Keeta.Quorum
+
+	now := time.Now()
+	sources := make([]models.Source, len(baseURLs))
+	fingerprints := map[string]string{}
+	for i, r := range results {
+		if r == nil {
+			sources[i] = models.Source{URL: baseURLs[i], Error: "no response before the quorum agreed"}
+			continue
+		}
+		sources[i] = models.Source{URL: baseURLs[i], Fingerprint: r.fingerprint, LastFetchedAt: &now}
+		if r.err != nil {
+			sources[i].Error = r.err.Error()
+			sourceErrors.Inc("source", baseURLs[i])
+			slog.Error("failed to fetch ledger history", "source", baseURLs[i], "error", r.err)
+			continue
+		}
+		fingerprints[baseURLs[i]] = r.fingerprint
+		sources[i].InQuorum = quorumMet && r.fingerprint == best
+		if r.fingerprint != best {
+			sourceDissents.Inc("source", baseURLs[i])
+		}
+	}
+
+	disagreed := len(agreed) > 1
+	if disagreed {
+		consensusDisagreements.Inc("quorum_met", fmt.Sprint(quorumMet))
+		slog.Warn("nodes disagree on ledger history", "page", page, "quorumMet", quorumMet, "fingerprints", fingerprints)
+	}
+
+	ix.updateStatus(func(s *models.Status) {
+		s.Consensus.Sources = sources
+		if quorumMet {
+			s.Consensus.LastAgreedAt = &now
+		}
+		if disagreed {
+			s.Consensus.Disagreements++
+			s.Consensus.LastDisagreement = &models.Disagreement{
+				Page: page, Timestamp: now, QuorumMet: quorumMet, Fingerprints: fingerprints,
+			}
+		}
+	})
+
+	if !quorumMet {
+		return nil, fmt.Errorf("%w: %d of %d required", ErrNoConsensus, agreed[best], ix.cfg.Keeta.Quorum)
+	}
+
+	for _, r := range results {
+		if r != nil && r.err == nil && r.fingerprint == best {
+			return r.history, nil
+		}
+	}
+	return nil, ErrNoConsensus
+}
+
+// historyFingerprint hashes the whole history page, the votes of every vote staple included, as JSON with sorted
+// keys. Malformed history items are hashed as well, so nodes also have to agree on them before they are dead-lettered.
+func historyFingerprint(history map[string]any) (string, error) {
+	if _, ok := history["history"].([]any); !ok {
+		return "", errors.New("malformed history")
+	}
+
+	data, err := json.Marshal(history)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
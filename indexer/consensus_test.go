@@ -0,0 +1,137 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"kns-indexer/config"
+	"kns-indexer/devnet"
+	"kns-indexer/testutil"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+// firstPage is the metadata of the first history page of a simulated ledger.
+var firstPage = map[string]any{"startBlocksHash": "0"}
+
+// startNodes serves the test history from two nodes and, from a third one, the same history with a vote missing.
+func startNodes(t *testing.T) []*testutil.Server {
+	t.Helper()
+
+	dissent := slices.Clone(testHistory)
+	dissent[0] = map[string]any{"voteStaple": map[string]any{
+		"blocks": []map[string]any{block("U1", 1, userA, userA, createIdentifier(tokenA))},
+		"votes":  devnet.Votes(len(devnet.Representatives)-1, "U1"),
+	}}
+
+	return []*testutil.Server{
+		testutil.NewServer(t, testHistory...), testutil.NewServer(t, testHistory...), testutil.NewServer(t, dissent...),
+	}
+}
+
+func newConsensusIndexer(t *testing.T, quorum int, servers []*testutil.Server) *Indexer {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.Keeta.BaseURLs, cfg.Keeta.Quorum = nil, quorum
+	for _, server := range servers {
+		cfg.Keeta.BaseURLs = append(cfg.Keeta.BaseURLs, server.URL)
+	}
+	cfg.Indexer.PageLimit = 2
+	cfg.Indexer.Representatives = devnet.Representatives
+	cfg.Resolve()
+	ix, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ix
+}
+
+func TestFetchAgreedHistory(t *testing.T) {
+	servers := startNodes(t)
+	ix := newConsensusIndexer(t, 2, servers)
+	ctx := context.Background()
+
+	// the dissenting node responds before the quorum agrees
+	servers[1].Delay(100 * time.Millisecond)
+
+	history, err := ix.FetchAgreedHistory(ctx, 1, firstPage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ix.FetchLedgerHistory(ctx, servers[0].URL, firstPage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(history, want) {
+		t.Errorf("agreed on %v, want %v", history, want)
+	}
+
+	consensus := ix.Status().Consensus
+	inQuorum := []bool{}
+	for _, source := range consensus.Sources {
+		inQuorum = append(inQuorum, source.InQuorum)
+	}
+	if !reflect.DeepEqual(inQuorum, []bool{true, true, false}) {
+		t.Errorf("sources in quorum %v, want the two agreeing ones", inQuorum)
+	}
+	if consensus.Disagreements != 1 || consensus.LastDisagreement == nil || !consensus.LastDisagreement.QuorumMet {
+		t.Errorf("disagreement on missing vote not recorded: %+v", consensus)
+	}
+}
+
+func TestFetchAgreedHistoryWithoutQuorum(t *testing.T) {
+	ix := newConsensusIndexer(t, 3, startNodes(t))
+	ctx := context.Background()
+
+	if _, err := ix.FetchAgreedHistory(ctx, 1, firstPage); !errors.Is(err, ErrNoConsensus) {
+		t.Fatalf("error %v, want ErrNoConsensus", err)
+	}
+	if consensus := ix.Status().Consensus; consensus.LastAgreedAt != nil || consensus.LastDisagreement.QuorumMet {
+		t.Errorf("quorum recorded as met: %+v", consensus)
+	}
+}
+
+func TestFetchAgreedHistoryWithFailingSource(t *testing.T) {
+	servers := startNodes(t)[:2]
+	ix := newConsensusIndexer(t, 2, servers)
+	ctx := context.Background()
+
+	servers[1].Fail(1)
+	if _, err := ix.FetchAgreedHistory(ctx, 1, firstPage); !errors.Is(err, ErrNoConsensus) {
+		t.Fatalf("error %v, want ErrNoConsensus", err)
+	}
+	if source := ix.Status().Consensus.Sources[1]; source.Error == "" || source.InQuorum {
+		t.Errorf("failing source %+v, want an error outside the quorum", source)
+	}
+
+	if _, err := ix.FetchAgreedHistory(ctx, 1, firstPage); err != nil {
+		t.Fatalf("quorum after the source recovered: %v", err)
+	}
+}
+
+func TestFetchAgreedHistoryWithHangingSource(t *testing.T) {
+	servers := startNodes(t)
+	ix := newConsensusIndexer(t, 2, servers)
+	servers[2].Delay(time.Hour)
+
+	start := time.Now()
+	if _, err := ix.FetchAgreedHistory(context.Background(), 1, firstPage); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("agreed after %v, want the hanging node not waited for", elapsed)
+	}
+	if source := ix.Status().Consensus.Sources[2]; source.Error == "" || source.InQuorum {
+		t.Errorf("hanging source %+v, want it recorded as not responding", source)
+	}
+
+	// without a quorum a hanging node holds the fetch until the context is done
+	servers[1].Delay(time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := ix.FetchAgreedHistory(ctx, 1, firstPage); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error %v, want the fetch canceled", err)
+	}
+}
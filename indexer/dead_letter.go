@@ -0,0 +1,202 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kns-indexer/store"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// ReplayDeadLetters retries decoding of every dead letter not replayed yet and applies the actions of the ones that
+// decode now and whose vote staple is verified and final. Actions are applied in the chain order of their blocks,
+// after the state the indexer has already committed, so a replayed action that conflicts with later history loses
+// the same way it would when applied late on-chain.
+func (ix *Indexer) ReplayDeadLetters(ctx context.Context, db store.Store) (replayed int, failed int, err error) {
+	deadLetters, err := db.UnreplayedDeadLetters(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	type replay struct {
+		id      int64
+		date    time.Time
+		actions []store.Action
+	}
+	var replays []replay
+
+	for _, deadLetter := range deadLetters {
+		actions, date, err := ix.replayActions(deadLetter.Stage, deadLetter.Position, deadLetter.Raw, deadLetter.Context)
+		if err != nil {
+			slog.Warn("Dead letter still fails", "id", deadLetter.ID, "stage", deadLetter.Stage, "error", err)
+			if err = db.SetDeadLetterError(ctx, deadLetter.ID, err.Error()); err != nil {
+				return replayed, failed, err
+			}
+			failed++
+			continue
+		}
+		replays = append(replays, replay{id: deadLetter.ID, date: date, actions: actions})
+	}
+
+	sort.SliceStable(replays, func(i, j int) bool {
+		return replays[i].date.Before(replays[j].date)
+	})
+	for _, r := range replays {
+		if err = ix.replayDeadLetter(ctx, db, r.id, r.actions); err != nil {
+			return replayed, failed, err
+		}
+		replayed++
+	}
+
+	return replayed, failed, nil
+}
+
+func (ix *Indexer) replayDeadLetter(ctx context.Context, db store.Store, id int64, actions []store.Action) error {
+	transaction, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer transaction.Rollback(context.Background())
+
+	var applied []store.Action
+	for _, action := range actions {
+		action, ok, err := applyAction(ctx, transaction, action)
+		if err != nil {
+			return err
+		}
+		if ok {
+			applied = append(applied, action)
+		}
+	}
+	if err = transaction.MarkDeadLetterReplayed(ctx, id); err != nil {
+		return err
+	}
+	if err = transaction.Commit(ctx); err != nil {
+		return err
+	}
+
+	for _, action := range applied {
+		slog.Info(describe(action))
+	}
+	ix.publish(applied)
+	return nil
+}
+
+// replayActions decodes the dead letter again and returns its actions and the date of its first block. Blocks of
+// dead-lettered vote staples and blocks are only replayed when their vote staple passes the checks of syncing.
+func (ix *Indexer) replayActions(
+	stage string, position *int, raw, replayContext json.RawMessage,
+) ([]store.Action, time.Time, error) {
+	var voteStaple map[string]any
+
+	switch stage {
+	case StageStaple:
+		var item map[string]any
+		if err := json.Unmarshal(raw, &item); err != nil {
+			return nil, time.Time{}, err
+		}
+		voteStaple, _ = item["voteStaple"].(map[string]any)
+		if _, ok := voteStaple["blocks"].([]any); !ok {
+			return nil, time.Time{}, fmt.Errorf("malformed vote staple")
+		}
+	case StageBlock:
+		var blockContext struct {
+			VoteStaple map[string]any `json:"voteStaple"`
+		}
+		if err := json.Unmarshal(replayContext, &blockContext); err != nil {
+			return nil, time.Time{}, err
+		}
+		if blockContext.VoteStaple == nil {
+			return nil, time.Time{}, fmt.Errorf("vote staple of the block unknown")
+		}
+		// only the dead-lettered block is replayed, the other blocks of the vote staple were synced
+		var block any
+		if err := json.Unmarshal(raw, &block); err != nil {
+			return nil, time.Time{}, err
+		}
+		if err := ix.admitStaple(blockContext.VoteStaple); err != nil {
+			return nil, time.Time{}, err
+		}
+		return ix.replayBlocks([]any{block})
+	case StageOperation:
+		var operationContext struct {
+			Block              any         `json:"block"`
+			PreviousOperations []Operation `json:"previousOperations"`
+		}
+		if err := json.Unmarshal(replayContext, &operationContext); err != nil {
+			return nil, time.Time{}, err
+		}
+		block, deadLetters, err := decodeBlock(operationContext.Block)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		for _, deadLetter := range deadLetters {
+			if *deadLetter.Position == *position {
+				return nil, block.Date, deadLetter.Err
+			}
+		}
+		// the block was verified and final when it was synced
+		if rules := ix.RulesAt(block.Date); rules != nil {
+			if action, ok := rules.Action(block, *position, operationContext.PreviousOperations); ok {
+				return []store.Action{action}, block.Date, nil
+			}
+		}
+		return nil, block.Date, nil
+	default:
+		return nil, time.Time{}, fmt.Errorf("unknown stage %v", stage)
+	}
+
+	if err := ix.admitStaple(voteStaple); err != nil {
+		return nil, time.Time{}, err
+	}
+	return ix.replayBlocks(voteStaple["blocks"].([]any))
+}
+
+// admitStaple returns why the blocks of the vote staple would not be applied when synced: failed verification or
+// missing finality.
+func (ix *Indexer) admitStaple(voteStaple map[string]any) error {
+	if ix.cfg.Indexer.VerifySignatures {
+		if err := ix.verifyStaple(voteStaple); err != nil {
+			return err
+		}
+	}
+	if !ix.IsFinal(voteStaple) {
+		return errors.New("vote staple is not final")
+	}
+	return nil
+}
+
+// replayBlocks decodes the blocks and returns their actions in date order and the date of the first one.
+func (ix *Indexer) replayBlocks(rawBlocks []any) ([]store.Action, time.Time, error) {
+	blocks := make([]Block, len(rawBlocks))
+	for i, b := range rawBlocks {
+		block, _, err := decodeBlock(b)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		blocks[i] = block
+	}
+	sort.SliceStable(blocks, func(i, j int) bool {
+		return blocks[i].Date.Before(blocks[j].Date)
+	})
+
+	// the block an inscription links to is not known for dead-lettered blocks, only blocks replayed together link
+	var (
+		actions             []store.Action
+		date                time.Time
+		lastBlockOperations []Operation
+	)
+	for i, block := range blocks {
+		if i == 0 {
+			date = block.Date
+		}
+		if rules := ix.RulesAt(block.Date); rules != nil {
+			actions = append(actions, rules.Actions(block, lastBlockOperations)...)
+		}
+		lastBlockOperations = block.Operations
+	}
+	return actions, date, nil
+}
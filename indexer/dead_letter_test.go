@@ -0,0 +1,71 @@
+package indexer
+
+import (
+	"context"
+	"kns-indexer/devnet"
+	"kns-indexer/store"
+	"testing"
+)
+
+func TestReplayDeadLetters(t *testing.T) {
+	ix := startFakeNode(t)
+	db := store.NewMemory()
+	ctx := context.Background()
+
+	late := staple(
+		block("U2", 3, userB, userB, createIdentifier(tokenB)), block("T2", 4, tokenB, userB, setInfo("alice")),
+	)
+	early := staple(
+		block("U1", 1, userA, userA, createIdentifier(tokenA)), block("T1", 2, tokenA, userA, setInfo("alice")),
+	)
+	pending := staple(
+		block("U3", 7, userC, userC, createIdentifier(tokenC)), block("T3", 8, tokenC, userC, setInfo("carol")),
+	)
+	pending["voteStaple"].(map[string]any)["votes"] = devnet.Votes(1, "U3", "T3")
+
+	// dead letters of history that decodes now, the later inscription of alice dead-lettered first
+	transaction, err := db.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, deadLetter := range []store.DeadLetter{
+		{Stage: StageStaple, Err: errInjected, Raw: late},
+		{Stage: StageStaple, Err: errInjected, Raw: early},
+		{Stage: StageStaple, Err: errInjected, Raw: pending},
+		{
+			Stage: StageBlock, BlockHash: "T4", Err: errInjected, Raw: block("T4", 9, tokenC, userC, setInfo("dave")),
+			Context: map[string]any{"voteStaple": pending["voteStaple"]},
+		},
+		// dead-lettered before blocks kept their vote staple
+		{Stage: StageBlock, BlockHash: "T5", Err: errInjected, Raw: block("T5", 10, tokenC, userC, setInfo("erin"))},
+	} {
+		if err = transaction.InsertDeadLetter(ctx, deadLetter); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = transaction.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed, failed, err := ix.ReplayDeadLetters(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed != 2 || failed != 3 {
+		t.Errorf("replayed %d and failed %d, want the 2 final vote staples replayed", replayed, failed)
+	}
+
+	s := takeSnapshot(t, db)
+	if len(s.usernames) != 1 || s.usernames[0].Username != "alice" || s.usernames[0].Owner != userA {
+		t.Errorf("usernames %+v, want alice inscribed first on chain by %v", s.usernames, userA)
+	}
+	if len(s.deadLetters) != 3 {
+		t.Errorf("dead letters %+v, want the pending vote staple and blocks left", s.deadLetters)
+	}
+
+	// a final vote staple failing verification is not replayed either
+	ix.cfg.Indexer.VerifySignatures = true
+	if replayed, _, err = ix.ReplayDeadLetters(ctx, db); err != nil || replayed != 0 {
+		t.Errorf("replayed %d unverified dead letters: %v", replayed, err)
+	}
+}
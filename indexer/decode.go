@@ -0,0 +1,108 @@
+package indexer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kns-indexer/store"
+	"time"
+)
+
+const (
+	StageStaple    = "decode_staple"
+	StageBlock     = "decode_block"
+	StageOperation = "decode_operation"
+)
+
+const OperationTypeInvalid = -1
+
+type Block struct {
+	Hash          string            `json:"$hash"`
+	Date          time.Time         `json:"date"`
+	Account       string            `json:"account"`
+	Signer        string            `json:"signer"`
+	RawOperations []json.RawMessage `json:"operations"`
+
+	// Operations has an OperationTypeInvalid operation in place of every operation that failed decoding.
+	Operations []Operation `json:"-"`
+}
+
+type Operation struct {
+	Type        int     `json:"type"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Identifier  string  `json:"identifier"`
+	To          string  `json:"to"`
+	Token       string  `json:"token"`
+	Amount      string  `json:"amount"`
+	Extra       *string `json:"extra"`
+}
+
+// decodeBlock decodes the block and its operations. A block error means the whole block is unusable, while
+// operations failing decoding are returned as dead letters and replaced by invalid operations.
+func decodeBlock(raw any) (Block, []store.DeadLetter, error) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return Block{}, nil, err
+	}
+
+	var block Block
+	if err = json.Unmarshal(data, &block); err != nil {
+		return Block{}, nil, err
+	}
+	if block.Hash == "" {
+		return Block{}, nil, errors.New("missing $hash")
+	}
+	if block.Account == "" {
+		return Block{}, nil, errors.New("missing account")
+	}
+	if block.Date.IsZero() {
+		return Block{}, nil, errors.New("missing date")
+	}
+	if block.Signer == "" {
+		block.Signer = block.Account
+	}
+
+	var deadLetters []store.DeadLetter
+
+	block.Operations = make([]Operation, len(block.RawOperations))
+	for position, rawOperation := range block.RawOperations {
+		operation, err := decodeOperation(rawOperation)
+		if err != nil {
+			deadLetters = append(deadLetters, store.DeadLetter{
+				Stage:     StageOperation,
+				BlockHash: block.Hash,
+				Position:  &position,
+				Err:       err,
+				Raw:       rawOperation,
+				Context:   map[string]any{"block": raw},
+			})
+			operation = Operation{Type: OperationTypeInvalid}
+		}
+		block.Operations[position] = operation
+	}
+
+	return block, deadLetters, nil
+}
+
+func decodeOperation(raw json.RawMessage) (Operation, error) {
+	operation := Operation{Type: OperationTypeInvalid}
+	if err := json.Unmarshal(raw, &operation); err != nil {
+		return Operation{}, err
+	}
+
+	switch operation.Type {
+	case OperationTypeInvalid:
+		return Operation{}, errors.New("missing type")
+	case OperationTypeSend:
+		if operation.To == "" || operation.Token == "" || operation.Amount == "" {
+			return Operation{}, fmt.Errorf("send operation should have to, token and amount")
+		}
+	case OperationTypeCreateIdentifier:
+		if operation.Identifier == "" {
+			return Operation{}, fmt.Errorf("create identifier operation should have identifier")
+		}
+	}
+
+	return operation, nil
+}
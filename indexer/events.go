@@ -0,0 +1,41 @@
+package indexer
+
+import (
+	"kns-indexer/store"
+	"maps"
+	"slices"
+)
+
+// Subscribe calls f with every action that changed the index once it is committed, in commit order and on the
+// goroutine running the indexer, so a slow f holds the indexer up. It returns a function unsubscribing f.
+func (ix *Indexer) Subscribe(f func(store.Action)) (unsubscribe func()) {
+	ix.subscribers.Lock()
+	defer ix.subscribers.Unlock()
+
+	id := ix.subscribers.next
+	ix.subscribers.next++
+	ix.subscribers.callbacks[id] = f
+
+	return func() {
+		ix.subscribers.Lock()
+		defer ix.subscribers.Unlock()
+		delete(ix.subscribers.callbacks, id)
+	}
+}
+
+// publish passes the committed actions to the subscribers.
+func (ix *Indexer) publish(actions []store.Action) {
+	if len(actions) == 0 {
+		return
+	}
+
+	ix.subscribers.RLock()
+	callbacks := slices.Collect(maps.Values(ix.subscribers.callbacks))
+	ix.subscribers.RUnlock()
+
+	for _, action := range actions {
+		for _, f := range callbacks {
+			f(action)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package indexer
+
+import (
+	"fmt"
+	"kns-indexer/config"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FeeSchedule describes the registration fee an inscription has to pay in the base token to the treasury. The fee
+// of a username is the amount of the first tier whose MaxLength is greater than or equal to the username length;
+// usernames longer than every tier are free.
+type FeeSchedule struct {
+	Treasury  string
+	BaseToken string
+	Tiers     []FeeTier
+}
+
+type FeeTier struct {
+	MaxLength int
+	Amount    *big.Int
+}
+
+func (f *FeeSchedule) FeeFor(username string) *big.Int {
+	length := len([]rune(username))
+	for _, tier := range f.Tiers {
+		if length <= tier.MaxLength {
+			return tier.Amount
+		}
+	}
+	return new(big.Int)
+}
+
+// IsFeePaid reports whether one of the operations not used yet sends at least the username fee in the base token to
+// the treasury, and marks that payment used, if used is not nil, so it pays for a single inscription.
+func (f *FeeSchedule) IsFeePaid(username string, used map[*Operation]bool, operations ...[]Operation) bool {
+	fee := f.FeeFor(username)
+	if fee.Sign() == 0 {
+		return true
+	}
+
+	for _, ops := range operations {
+		for i := range ops {
+			op := &ops[i]
+			if used[op] || op.Type != OperationTypeSend || op.To != f.Treasury || op.Token != f.BaseToken {
+				continue
+			}
+			if amount, ok := parseAmount(op.Amount); ok && amount.Cmp(fee) >= 0 {
+				if used != nil {
+					used[op] = true
+				}
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func parseAmount(s string) (*big.Int, bool) {
+	if hex, isHex := strings.CutPrefix(s, "0x"); isHex {
+		return new(big.Int).SetString(hex, 16)
+	}
+	return new(big.Int).SetString(s, 10)
+}
+
+// feeRuleSets returns the rule sets enforcing the configured registration fee from its activation on: a version
+// derived from the one active then, followed by the later versions with the fee added. It returns the rule sets
+// unchanged when fees are not configured.
+func feeRuleSets(ruleSets []*Rules, fee config.Fee) ([]*Rules, error) {
+	treasury := fee.TreasuryAddress
+	if treasury == "" {
+		return ruleSets, nil
+	}
+
+	activatedAt, err := time.Parse(time.RFC3339, fee.ActivatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("fee.activated_at should be RFC 3339 timestamp: %w", err)
+	}
+
+	baseToken := fee.BaseToken
+	if baseToken == "" {
+		return nil, fmt.Errorf("fee.base_token is required when fee.treasury_address is set")
+	}
+
+	tiers, err := parseFeeTiers(fee.Tiers)
+	if err != nil {
+		return nil, err
+	}
+
+	if !activatedAt.After(ruleSets[0].ActivatedAt) {
+		return nil, fmt.Errorf("fee.activated_at should be after activation of protocol version %d", ruleSets[0].Version)
+	}
+
+	// active is the index of the version active when the fee activates
+	active := 0
+	for active+1 < len(ruleSets) && !ruleSets[active+1].ActivatedAt.After(activatedAt) {
+		active++
+	}
+	schedule := &FeeSchedule{Treasury: treasury, BaseToken: baseToken, Tiers: tiers}
+
+	result := slices.Clone(ruleSets[:active+1])
+	for i, base := range ruleSets[active:] {
+		if i == 0 && base.ActivatedAt.Equal(activatedAt) {
+			// the version activating with the fee is replaced
+			result = result[:active]
+		}
+		rules := *base
+		rules.ActivatedAt = latest(rules.ActivatedAt, activatedAt)
+		rules.Fee = schedule
+		result = append(result, &rules)
+	}
+	return result, nil
+}
+
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// parseFeeTiers parses "maxLength:amount" pairs separated by commas, e.g. "3:1000000,5:100000,32:1000".
+func parseFeeTiers(s string) ([]FeeTier, error) {
+	var tiers []FeeTier
+	for _, pair := range strings.Split(s, ",") {
+		maxLengthStr, amountStr, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok {
+			return nil, fmt.Errorf("fee.tiers entry %q should be maxLength:amount", pair)
+		}
+		maxLength, err := strconv.Atoi(maxLengthStr)
+		if err != nil || maxLength < 1 {
+			return nil, fmt.Errorf("fee.tiers entry %q should have positive max length", pair)
+		}
+		amount, ok := new(big.Int).SetString(amountStr, 10)
+		if !ok || amount.Sign() < 0 {
+			return nil, fmt.Errorf("fee.tiers entry %q should have non-negative integer amount", pair)
+		}
+		tiers = append(tiers, FeeTier{MaxLength: maxLength, Amount: amount})
+	}
+	slices.SortFunc(tiers, func(a, b FeeTier) int { return a.MaxLength - b.MaxLength })
+	return tiers, nil
+}
@@ -0,0 +1,19 @@
+package indexer
+
+// IsFinal reports whether votes of indexer.finality_quorum distinct trusted representatives are signed by them and
+// cover every block of the vote staple. Flags the node adds to votes, like $permanent, are not signed and ignored.
+func (ix *Indexer) IsFinal(voteStaple map[string]any) bool {
+	blockHashes := stapleBlockHashes(voteStaple)
+	votes, _ := voteStaple["votes"].([]any)
+
+	issuers := map[string]struct{}{}
+	for _, voteRaw := range votes {
+		vote, ok := voteRaw.(map[string]any)
+		if !ok || ix.verifyVote(vote, blockHashes) != nil {
+			continue
+		}
+		issuers[vote["issuer"].(string)] = struct{}{}
+	}
+
+	return len(issuers) > 0 && len(issuers) >= ix.cfg.Indexer.FinalityQuorum
+}
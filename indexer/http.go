@@ -1,42 +1,62 @@
 package indexer
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
+	"time"
 )
 
-var client = &http.Client{}
+// requestTimeout bounds every request to a node or Keetools, so a node that hangs fails like one that is down.
+const requestTimeout = 30 * time.Second
 
-func FetchPageMetadata(page int) map[string]any {
+var client = &http.Client{Timeout: requestTimeout}
+
+func (ix *Indexer) FetchPageMetadata(ctx context.Context, page int) (map[string]any, error) {
 	values := url.Values{
-		"limit":     {strconv.Itoa(TransactionsPageLimit)},
+		"limit":     {strconv.Itoa(ix.cfg.Indexer.PageLimit)},
 		"page":      {strconv.Itoa(page)},
 		"sortOrder": {"asc"},
-		"dateFrom":  {LaunchDate},
+		"dateFrom":  {ix.cfg.Indexer.LaunchDate},
 	}
 
-	resp, _ := client.Get(KeetoolsBaseURL + "/api/staples/metadata?" + values.Encode())
-	defer resp.Body.Close()
-
-	var result map[string]any
-	json.NewDecoder(resp.Body).Decode(&result)
-	return result
+	return fetchJSON(ctx, ix.cfg.Keeta.KeetoolsBaseURL+"/api/staples/metadata?"+values.Encode())
 }
 
-func FetchLedgerHistory(pageMetadata map[string]any) map[string]any {
+func (ix *Indexer) FetchLedgerHistory(
+	ctx context.Context, baseURL string, pageMetadata map[string]any,
+) (map[string]any, error) {
 	values := url.Values{
-		"limit": {strconv.Itoa(TransactionsPageLimit)},
+		"limit": {strconv.Itoa(ix.cfg.Indexer.PageLimit)},
 	}
-	if pageMetadata["startBlocksHash"] != nil {
-		values.Set("start", pageMetadata["startBlocksHash"].(string))
+	if startBlocksHash, ok := pageMetadata["startBlocksHash"].(string); ok {
+		values.Set("start", startBlocksHash)
 	}
 
-	resp, _ := client.Get(KeetaBaseURL + "/api/node/ledger/history?" + values.Encode())
+	return fetchJSON(ctx, baseURL+"/api/node/ledger/history?"+values.Encode())
+}
+
+func fetchJSON(ctx context.Context, url string) (map[string]any, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %v from %v", resp.Status, url)
+	}
+
 	var result map[string]any
-	json.NewDecoder(resp.Body).Decode(&result)
-	return result
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response from %v: %w", url, err)
+	}
+	return result, nil
 }
@@ -3,157 +3,361 @@ package indexer
 import (
 	"context"
 	"fmt"
+	"kns-indexer/config"
+	"kns-indexer/models"
+	"kns-indexer/store"
 	"log/slog"
-	"strings"
+	"slices"
+	"sync"
 	"time"
-
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func Run(pool *pgxpool.Pool) {
+// Indexer indexes the KNS history the configured nodes agree on into a store. Every Indexer has its own
+// configuration, rule sets, status and subscribers, so a process can run several of them.
+type Indexer struct {
+	cfg config.Config
+	// ruleSets are RuleSets with the configured activations and registration fee
+	ruleSets []*Rules
+
+	status struct {
+		sync.RWMutex
+		models.Status
+	}
+	subscribers struct {
+		sync.RWMutex
+		next      int
+		callbacks map[int]func(store.Action)
+	}
+}
+
+// New returns an indexer with the configuration, which has to be resolved and valid.
+func New(cfg config.Config) (*Indexer, error) {
+	ruleSets, err := activatedRuleSets(RuleSets, cfg.Indexer.Activations)
+	if err != nil {
+		return nil, fmt.Errorf("invalid indexer.activations: %w", err)
+	}
+	if ruleSets, err = feeRuleSets(slices.Clone(ruleSets), cfg.Fee); err != nil {
+		return nil, fmt.Errorf("invalid registration fee configuration: %w", err)
+	}
+
+	ix := &Indexer{cfg: cfg, ruleSets: ruleSets}
+	ix.subscribers.callbacks = map[int]func(store.Action){}
+	return ix, nil
+}
+
+type cursor struct {
+	page                int
+	lastBlockTimestamp  *time.Time
+	lastBlockHash       *string
+	lastBlockOperations []Operation
+	// first time each not yet final block was seen, to roll it back once it stays pending for too long and to apply
+	// it late when it turns final after that
+	pendingSince map[string]time.Time
+	// pendingBlocks is the number of blocks of pendingSince that are kept pending and not rolled back
+	pendingBlocks int
+	// totalPages is the number of pages at the last fetch, zero before the first one
+	totalPages int
+	// until is the hash of the block after which nothing is applied, nil to follow the chain head
+	until *string
+}
+
+// behind reports whether pages after the current one are known to exist.
+func (c cursor) behind() bool {
+	return c.page < c.totalPages
+}
+
+// passed reports whether the block is at or before the last processed one.
+func (c cursor) passed(block Block) bool {
+	return c.lastBlockTimestamp != nil && c.lastBlockHash != nil &&
+		(block.Date.Before(*c.lastBlockTimestamp) || block.Hash == *c.lastBlockHash)
+}
+
+// reached reports whether the cursor is at the until block.
+func (c cursor) reached() bool {
+	return c.until != nil && c.lastBlockHash != nil && *c.lastBlockHash == *c.until
+}
+
+// Run indexes the history from the committed cursor until the context is done or a batch fails. A failed batch is
+// rolled back, so running again resumes from the last committed one.
+func (ix *Indexer) Run(ctx context.Context, db store.Store) error {
+	c, err := ix.loadCursor(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	for {
+		page := c.page
+		if bulk, ok := db.(store.Bulk); ok && ix.cfg.Indexer.BackfillPages > 1 && c.behind() {
+			c, err = ix.backfill(ctx, bulk, c)
+		} else {
+			c, err = ix.syncPage(ctx, db, c)
+		}
+		if err != nil {
+			return err
+		}
+
+		ix.recordSuccess()
+
+		// catching up goes on immediately, the head and pages waiting for finality are polled
+		if c.page != page && c.behind() {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(ix.cfg.Indexer.PollInterval):
+		}
+	}
+}
+
+func (ix *Indexer) loadCursor(ctx context.Context, db store.Store) (cursor, error) {
 	var (
-		page                int
-		lastBlockTimestamp  *time.Time
-		lastBlockHash       *string
-		lastBlockOperations []any
+		c   cursor
+		err error
 	)
+	if c.page, c.lastBlockTimestamp, c.lastBlockHash, err = db.LoadCursor(ctx); err != nil {
+		return cursor{}, fmt.Errorf("failed to fetch settings: %w", err)
+	}
 
-	pool.QueryRow(
-		context.Background(), "SELECT page, last_block_timestamp, last_block_hash FROM settings;",
-	).Scan(&page, &lastBlockTimestamp, &lastBlockHash)
+	if c.pendingSince, err = db.PendingBlocks(ctx); err != nil {
+		return c, err
+	}
 
-	slog.Debug("Fetched settings", "page", page, "lastBlockTimestamp", lastBlockTimestamp, "lastBlockHash", lastBlockHash)
+	slog.Debug("Fetched settings", "page", c.page, "lastBlockTimestamp", c.lastBlockTimestamp, "lastBlockHash", c.lastBlockHash)
 
-	for {
-		pageMetadata := FetchPageMetadata(page)
+	ix.updateStatus(func(s *models.Status) {
+		s.Page = c.page
+		s.LastBlockHash, s.LastBlockTimestamp = c.lastBlockHash, c.lastBlockTimestamp
+	})
+
+	return c, nil
+}
+
+// syncPage applies the blocks of the current page that follow the cursor in a single transaction and returns the
+// cursor after it. On error nothing is committed and the cursor passed in is still the committed one.
+func (ix *Indexer) syncPage(ctx context.Context, db store.Store, c cursor) (cursor, error) {
+	pageMetadata, err := ix.FetchPageMetadata(ctx, c.page)
+	if err != nil {
+		return c, fmt.Errorf("failed to fetch page metadata of page %d: %w", c.page, err)
+	}
+
+	slog.Debug("Fetched", "pageMetadata", pageMetadata)
+
+	history, err := ix.FetchAgreedHistory(ctx, c.page, pageMetadata)
+	if err != nil {
+		return c, fmt.Errorf("failed to fetch ledger history of page %d: %w", c.page, err)
+	}
+
+	transaction, err := db.Begin(ctx)
+	if err != nil {
+		return c, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	// rolls back everything applied so far when the batch panics or fails, no-op after commit
+	defer transaction.Rollback(context.Background())
 
-		slog.Debug("Fetched", "pageMetadata", pageMetadata)
+	next, applied, err := ix.applyPage(ctx, transaction, c, pageMetadata, history)
+	if err != nil {
+		return c, fmt.Errorf("failed to apply page %d: %w", c.page, err)
+	}
+	next.totalPages = totalPages(pageMetadata)
+
+	if err = transaction.Commit(ctx); err != nil {
+		return c, fmt.Errorf("failed to commit page %d: %w", c.page, err)
+	}
 
-		history := FetchLedgerHistory(pageMetadata)
+	for _, action := range applied {
+		slog.Debug(describe(action))
+	}
+	ix.publish(applied)
 
-		var postCommitLogs []string
+	ix.updateStatus(func(s *models.Status) {
+		s.Page = next.page
+		s.LastBlockHash, s.LastBlockTimestamp = next.lastBlockHash, next.lastBlockTimestamp
+		s.PendingBlocks = next.pendingBlocks
+	})
 
-		transaction, _ := pool.Begin(context.Background())
+	slog.Debug("Committed settings", "page", next.page, "last_block_hash", next.lastBlockHash, "pending_blocks", next.pendingBlocks)
 
-		for _, block := range sortedBlocks(history) {
-			blockTimestamp, _ := time.Parse(time.RFC3339Nano, block["date"].(string))
+	return next, nil
+}
 
-			// skip already processed blocks
-			if lastBlockTimestamp != nil && lastBlockHash != nil && (blockTimestamp.Before(*lastBlockTimestamp) || block["$hash"].(string) == *lastBlockHash) {
-				slog.Debug(fmt.Sprintf("Skipping block %v: older or equal to last processed", block["$hash"]))
+// applyPage applies the history page to the transaction and returns the cursor to commit with it and the actions
+// that changed the state.
+func (ix *Indexer) applyPage(
+	ctx context.Context, transaction store.Tx, c cursor, pageMetadata map[string]any, history map[string]any,
+) (cursor, []store.Action, error) {
+	var (
+		applied         []store.Action
+		pendingActions  []store.Action
+		pendingSince    = map[string]time.Time{}
+		pendingBlocks   int
+		pendingPrevious = c.lastBlockOperations
+		// pageOperations are the operations of the block before the current one on the page
+		pageOperations []Operation
+	)
+
+	blocks, deadLetters := ix.sortedBlocks(history)
+
+	for _, deadLetter := range deadLetters {
+		if err := insertDeadLetter(ctx, transaction, deadLetter); err != nil {
+			return c, nil, err
+		}
+	}
+
+	for _, stapled := range blocks {
+		if c.reached() {
+			break
+		}
+
+		block := stapled.block
+		blockHash := block.Hash
+		blockTimestamp := block.Date
+		previousOperations := pageOperations
+		pageOperations = block.Operations
+
+		firstSeen, seen := c.pendingSince[blockHash]
+		if !seen {
+			firstSeen = time.Now()
+		}
+		timedOut := time.Since(firstSeen) > ix.cfg.Indexer.PendingTimeout
+
+		if c.passed(block) {
+			// a block rolled back for not being final in time is applied late once it is, out of order like a
+			// replayed dead letter
+			if seen && stapled.verifyErr == nil {
+				if !stapled.final {
+					pendingSince[blockHash] = firstSeen
+					continue
+				}
+				if rules := ix.RulesAt(blockTimestamp); rules != nil {
+					slog.Warn(fmt.Sprintf("Applying block %v late: final after it was rolled back", blockHash))
+					blockApplied, err := applyBlock(ctx, transaction, stapled, rules, previousOperations)
+					if err != nil {
+						return c, nil, err
+					}
+					applied = append(applied, blockApplied...)
+				}
 				continue
 			}
+			slog.Debug(fmt.Sprintf("Skipping block %v: older or equal to last processed", blockHash))
+			continue
+		}
 
-			slog.Debug(fmt.Sprintf("Processing block %v at %v", block["$hash"], blockTimestamp))
-
-			operations := block["operations"].([]any)
-
-			for _, operationRaw := range operations {
-				operation := operationRaw.(map[string]any)
-
-				if IsInscribeInstruction(operation, block["account"].(string), lastBlockOperations) {
-					username := strings.ToLower(operation["description"].(string))
-					commandTag, _ := transaction.Exec(
-						context.Background(),
-						"INSERT INTO username(username, address, owner, timestamp) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING;",
-						username,
-						block["account"],
-						block["signer"],
-						blockTimestamp,
-					)
-					if commandTag.RowsAffected() == 1 {
-						postCommitLogs = append(
-							postCommitLogs,
-							fmt.Sprintf("%v inscribed username %v", block["signer"], username),
-						)
-					}
-				} else if IsSetPrimaryNameOrCidInstruction(operation) {
-					if match := SetPrimaryNamePattern.FindStringSubmatch(operation["extra"].(string)); match != nil {
-						tokenAddress := match[0]
-
-						var username string
-						transaction.QueryRow(
-							context.Background(),
-							"UPDATE username SET is_primary = TRUE WHERE address = $1 AND owner = $2 RETURNING username;",
-							tokenAddress,
-							block["account"],
-						).Scan(&username)
-
-						if username != "" {
-							transaction.Exec(
-								context.Background(),
-								"UPDATE username SET is_primary = FALSE WHERE address != $1 AND owner = $2;",
-								tokenAddress,
-								block["account"],
-							)
-							postCommitLogs = append(
-								postCommitLogs,
-								fmt.Sprintf("%v set primary name %v", block["account"], username),
-							)
-						}
-					} else if match = SetCidPattern.FindStringSubmatch(operation["extra"].(string)); match != nil {
-						tokenAddress, cid := match[0], match[1]
-
-						var username string
-						transaction.QueryRow(
-							context.Background(),
-							"UPDATE username SET cid = $1 WHERE address = $2 AND owner = $3 RETURNING username;",
-							cid,
-							tokenAddress,
-							block["account"],
-						).Scan(&username)
-
-						if username != "" {
-							postCommitLogs = append(
-								postCommitLogs,
-								fmt.Sprintf("%v set CID %v to %v", block["account"], cid, username),
-							)
-						}
-					} else if IsTransferInstruction(operation) {
-						var username string
-						transaction.QueryRow(
-							context.Background(),
-							"UPDATE username SET owner = $1 WHERE address = $2 AND owner = $3 RETURNING username;",
-							operation["to"],
-							operation["token"],
-							block["account"],
-						).Scan(&username)
-						if username != "" {
-							postCommitLogs = append(
-								postCommitLogs,
-								fmt.Sprintf("%v transferred username %v to %v", block["account"], username, operation["to"]),
-							)
-						}
-					}
+		// blocks failing verification are never applied, also not after the indexer restarts
+		if stapled.verifyErr != nil {
+			slog.Warn(fmt.Sprintf("Quarantining block %v: %v", blockHash, stapled.verifyErr))
+			if err := transaction.QuarantineBlock(ctx, blockHash, stapled.verifyErr.Error(), stapled.raw, blockTimestamp); err != nil {
+				return c, nil, err
+			}
+			if pendingBlocks == 0 {
+				c.lastBlockTimestamp, c.lastBlockHash = &blockTimestamp, &blockHash
+			}
+			continue
+		}
+
+		rules := ix.RulesAt(blockTimestamp)
+
+		// blocks after the first not yet final one stay pending to keep them applied in order, every block that is not
+		// final in time is rolled back
+		if !stapled.final || pendingBlocks > 0 {
+			pendingSince[blockHash] = firstSeen
+			if !stapled.final && timedOut {
+				slog.Warn(fmt.Sprintf("Rolling back block %v: not final after %v", blockHash, ix.cfg.Indexer.PendingTimeout))
+				if pendingBlocks == 0 {
+					c.lastBlockTimestamp, c.lastBlockHash = &blockTimestamp, &blockHash
 				}
+				continue
+			}
+			pendingBlocks++
 
-				lastBlockHashString := block["$hash"].(string)
+			slog.Debug(fmt.Sprintf("Keeping block %v at %v pending", blockHash, blockTimestamp))
 
-				lastBlockTimestamp = &blockTimestamp
-				lastBlockHash = &lastBlockHashString
-				lastBlockOperations = operations
+			if rules != nil {
+				pendingActions = append(pendingActions, rules.Actions(block, pendingPrevious)...)
 			}
+			pendingPrevious = block.Operations
+			continue
 		}
 
-		if page != int(pageMetadata["totalPages"].(float64)) {
-			page++
+		slog.Debug(fmt.Sprintf("Processing block %v at %v", blockHash, blockTimestamp))
+
+		if rules == nil {
+			slog.Debug(fmt.Sprintf("Skipping block %v: predates protocol activation", blockHash))
+			continue
+		}
+
+		blockApplied, err := applyBlock(ctx, transaction, stapled, rules, c.lastBlockOperations)
+		if err != nil {
+			return c, nil, err
+		}
+		applied = append(applied, blockApplied...)
+
+		c.lastBlockTimestamp, c.lastBlockHash = &blockTimestamp, &blockHash
+		c.lastBlockOperations = block.Operations
+		pendingPrevious = c.lastBlockOperations
+	}
+
+	c.pendingSince, c.pendingBlocks = pendingSince, pendingBlocks
+
+	// the page is re-fetched until its pending blocks are final or rolled back, rolled back blocks are watched until
+	// the page is left
+	if pendingBlocks == 0 && !c.reached() && c.page < totalPages(pageMetadata) {
+		c.page++
+	}
+
+	if err := transaction.ReplacePendingActions(ctx, pendingActions, pendingSince); err != nil {
+		return c, nil, err
+	}
+
+	if err := transaction.SaveCursor(ctx, c.page, c.lastBlockTimestamp, c.lastBlockHash); err != nil {
+		return c, nil, err
+	}
+
+	return c, applied, nil
+}
+
+// applyBlock dead-letters the operations of the block that failed decoding and applies its actions, linking
+// inscriptions to the operations of the block before it, and returns the actions that changed the state.
+func applyBlock(
+	ctx context.Context, transaction store.Tx, stapled stapledBlock, rules *Rules, previousOperations []Operation,
+) ([]store.Action, error) {
+	for _, deadLetter := range stapled.deadLetters {
+		deadLetter.Context["previousOperations"] = previousOperations
+		if err := insertDeadLetter(ctx, transaction, deadLetter); err != nil {
+			return nil, err
 		}
+	}
 
-		transaction.Exec(
-			context.Background(),
-			"UPDATE settings SET page = $1, last_block_timestamp = $2, last_block_hash = $3;",
-			page,
-			lastBlockTimestamp,
-			lastBlockHash,
-		)
-		transaction.Commit(context.Background())
-
-		for _, postCommitLog := range postCommitLogs {
-			slog.Debug(postCommitLog)
+	var applied []store.Action
+	for _, action := range rules.Actions(stapled.block, previousOperations) {
+		action, ok, err := applyAction(ctx, transaction, action)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply %v of block %v: %w", action.Type, stapled.block.Hash, err)
+		}
+		if ok {
+			applied = append(applied, action)
 		}
+	}
+	return applied, nil
+}
 
-		slog.Debug("Committed settings", "page", page, "last_block_hash", lastBlockHash)
+func insertDeadLetter(ctx context.Context, transaction store.Tx, deadLetter store.DeadLetter) error {
+	slog.Warn(
+		"Dead-lettering history item",
+		"stage", deadLetter.Stage, "block", deadLetter.BlockHash, "position", deadLetterPosition(deadLetter), "error", deadLetter.Err,
+	)
+	return transaction.InsertDeadLetter(ctx, deadLetter)
+}
 
-		time.Sleep(time.Second)
+// deadLetterPosition returns the position of the dead-lettered operation, nil for vote staples and blocks.
+func deadLetterPosition(deadLetter store.DeadLetter) any {
+	if deadLetter.Position == nil {
+		return nil
 	}
+	return *deadLetter.Position
+}
+
+func totalPages(pageMetadata map[string]any) int {
+	totalPages, _ := pageMetadata["totalPages"].(float64)
+	return int(totalPages)
 }
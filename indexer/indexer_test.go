@@ -0,0 +1,675 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kns-indexer/config"
+	"kns-indexer/devnet"
+	"kns-indexer/kns/protocol"
+	"kns-indexer/models"
+	"kns-indexer/store"
+	"kns-indexer/testutil"
+	"math/big"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+var errInjected = errors.New("injected failure")
+
+// faultyDB is an in-memory store whose failAt-th transaction call fails. With commitLost the failing Commit persists
+// the transaction before failing, like a commit whose acknowledgement is lost.
+type faultyDB struct {
+	*store.Memory
+	calls      int
+	failAt     int
+	commitLost bool
+}
+
+func newFaultyDB(failAt int, commitLost bool) *faultyDB {
+	return &faultyDB{Memory: store.NewMemory(), failAt: failAt, commitLost: commitLost}
+}
+
+func (db *faultyDB) step() error {
+	db.calls++
+	if db.calls == db.failAt {
+		return errInjected
+	}
+	return nil
+}
+
+func (db *faultyDB) Begin(ctx context.Context) (store.Tx, error) {
+	if err := db.step(); err != nil {
+		return nil, err
+	}
+	tx, err := db.Memory.Begin(ctx)
+	return &faultyTx{Tx: tx, db: db}, err
+}
+
+// BeginBulk begins a transaction like Begin, bulk transactions only differ in how PostgreSQL writes them.
+func (db *faultyDB) BeginBulk(ctx context.Context) (store.Tx, error) {
+	return db.Begin(ctx)
+}
+
+type faultyTx struct {
+	store.Tx
+	db *faultyDB
+}
+
+func (t *faultyTx) InsertUsername(
+	ctx context.Context, username, display, address, owner string, timestamp time.Time,
+) (bool, error) {
+	if err := t.db.step(); err != nil {
+		return false, err
+	}
+	return t.Tx.InsertUsername(ctx, username, display, address, owner, timestamp)
+}
+
+func (t *faultyTx) SetPrimaryName(ctx context.Context, address, owner string) (string, error) {
+	if err := t.db.step(); err != nil {
+		return "", err
+	}
+	return t.Tx.SetPrimaryName(ctx, address, owner)
+}
+
+func (t *faultyTx) SetCid(ctx context.Context, address, owner, cid string) (string, error) {
+	if err := t.db.step(); err != nil {
+		return "", err
+	}
+	return t.Tx.SetCid(ctx, address, owner, cid)
+}
+
+func (t *faultyTx) TransferUsername(ctx context.Context, address, from, to string) (string, error) {
+	if err := t.db.step(); err != nil {
+		return "", err
+	}
+	return t.Tx.TransferUsername(ctx, address, from, to)
+}
+
+func (t *faultyTx) RecordEvent(ctx context.Context, action store.Action) error {
+	if err := t.db.step(); err != nil {
+		return err
+	}
+	return t.Tx.RecordEvent(ctx, action)
+}
+
+func (t *faultyTx) InsertDeadLetter(ctx context.Context, deadLetter store.DeadLetter) error {
+	if err := t.db.step(); err != nil {
+		return err
+	}
+	return t.Tx.InsertDeadLetter(ctx, deadLetter)
+}
+
+func (t *faultyTx) QuarantineBlock(ctx context.Context, blockHash, reason string, raw any, timestamp time.Time) error {
+	if err := t.db.step(); err != nil {
+		return err
+	}
+	return t.Tx.QuarantineBlock(ctx, blockHash, reason, raw, timestamp)
+}
+
+func (t *faultyTx) ReplacePendingActions(ctx context.Context, actions []store.Action, firstSeen map[string]time.Time) error {
+	if err := t.db.step(); err != nil {
+		return err
+	}
+	return t.Tx.ReplacePendingActions(ctx, actions, firstSeen)
+}
+
+func (t *faultyTx) SaveCursor(ctx context.Context, page int, lastBlockTimestamp *time.Time, lastBlockHash *string) error {
+	if err := t.db.step(); err != nil {
+		return err
+	}
+	return t.Tx.SaveCursor(ctx, page, lastBlockTimestamp, lastBlockHash)
+}
+
+func (t *faultyTx) Commit(ctx context.Context) error {
+	err := t.db.step()
+	if err == nil || t.db.commitLost {
+		if commitErr := t.Tx.Commit(ctx); commitErr != nil {
+			return commitErr
+		}
+	}
+	return err
+}
+
+// snapshot is the committed state of a store.
+type snapshot struct {
+	usernames   []models.Username
+	events      []string
+	deadLetters []store.StoredDeadLetter
+	page        int
+	lastHash    string
+}
+
+func takeSnapshot(t *testing.T, db store.Store) snapshot {
+	t.Helper()
+
+	ctx := context.Background()
+	var (
+		s   snapshot
+		err error
+	)
+	if s.usernames, err = db.AllUsernames(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range s.usernames {
+		events, err := db.Events(ctx, u.Username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, event := range events {
+			s.events = append(s.events, event.Type+" "+event.Username+" to "+event.Owner)
+		}
+	}
+	if s.deadLetters, err = db.UnreplayedDeadLetters(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var lastHash *string
+	if s.page, _, lastHash, err = db.LoadCursor(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if lastHash != nil {
+		s.lastHash = *lastHash
+	}
+	return s
+}
+
+const (
+	userA    = "keeta_usera"
+	userB    = "keeta_userb"
+	userC    = "keeta_userc"
+	tokenA   = "keeta_tokena"
+	tokenB   = "keeta_tokenb"
+	tokenC   = "keeta_tokenc"
+	lastHash = "T3"
+)
+
+func block(hash string, minute int, account, signer string, operations ...map[string]any) map[string]any {
+	return map[string]any{
+		"$hash":      hash,
+		"date":       time.Date(2025, 12, 3, 0, minute, 0, 0, time.UTC).Format(time.RFC3339Nano),
+		"account":    account,
+		"signer":     signer,
+		"operations": operations,
+	}
+}
+
+func staple(blocks ...map[string]any) map[string]any {
+	var hashes []string
+	for _, block := range blocks {
+		hashes = append(hashes, block["$hash"].(string))
+	}
+	return map[string]any{
+		"voteStaple": map[string]any{"blocks": blocks, "votes": devnet.Votes(len(devnet.Representatives), hashes...)},
+	}
+}
+
+func createIdentifier(token string) map[string]any {
+	return map[string]any{"type": OperationTypeCreateIdentifier, "identifier": token}
+}
+
+func setInfo(username string) map[string]any {
+	return map[string]any{"type": OperationTypeSetInfo, "name": "KNS", "description": username}
+}
+
+// testHistory inscribes alice, bob and carol, transfers alice and contains a malformed operation.
+var testHistory = []any{
+	staple(block("U1", 1, userA, userA, createIdentifier(tokenA))),
+	staple(block("T1", 2, tokenA, userA, setInfo("Alice"))),
+	staple(block("U2", 3, userB, userB, createIdentifier(tokenB))),
+	staple(block("T2", 4, tokenB, userB, setInfo("bob"))),
+	staple(block("S1", 5, userA, userA, map[string]any{
+		"type": OperationTypeSend, "to": RuleSets[0].BurnAddress, "token": tokenA, "amount": "0x1", "extra": "burn",
+	})),
+	staple(block("X1", 6, userB, userB, map[string]any{"type": OperationTypeSend, "to": 5})),
+	staple(block("U3", 7, userC, userC, createIdentifier(tokenC))),
+	staple(block(lastHash, 8, tokenC, userC, setInfo("carol"))),
+}
+
+// startFakeNode serves the test history in pages of two vote staples and returns an indexer following it.
+func startFakeNode(t *testing.T) *Indexer {
+	t.Helper()
+
+	server := testutil.NewServer(t, testHistory...)
+
+	cfg := config.Default()
+	cfg.Keeta.BaseURL, cfg.Keeta.BaseURLs, cfg.Keeta.Quorum = server.URL, []string{server.URL}, 1
+	cfg.Keeta.KeetoolsBaseURL = server.URL
+	cfg.Indexer.PageLimit = 2
+	cfg.Indexer.Representatives = devnet.Representatives
+	cfg.Resolve()
+	ix, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ix
+}
+
+// syncAll syncs until the last block is committed, backfilling pages behind the head with bulk, and reloading the
+// committed cursor after every failed batch like the supervisor does.
+func syncAll(t *testing.T, ix *Indexer, db *faultyDB, bulk bool) (failures int) {
+	t.Helper()
+
+	ctx := context.Background()
+	c, err := ix.loadCursor(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 20 {
+		if c.lastBlockHash != nil && *c.lastBlockHash == lastHash {
+			return failures
+		}
+		var next cursor
+		if bulk && c.behind() {
+			next, err = ix.backfill(ctx, db, c)
+		} else {
+			next, err = ix.syncPage(ctx, db, c)
+		}
+		if err != nil {
+			if !errors.Is(err, errInjected) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			failures++
+			if c, err = ix.loadCursor(ctx, db); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		c = next
+	}
+
+	t.Fatal("indexer did not reach the last block")
+	return failures
+}
+
+func TestSyncIsAtomic(t *testing.T) {
+	for _, bulk := range []bool{false, true} {
+		t.Run(fmt.Sprintf("bulk=%v", bulk), func(t *testing.T) { testSyncIsAtomic(t, bulk) })
+	}
+}
+
+func testSyncIsAtomic(t *testing.T, bulk bool) {
+	ix := startFakeNode(t)
+
+	clean := newFaultyDB(0, false)
+	syncAll(t, ix, clean, bulk)
+	want := takeSnapshot(t, clean)
+
+	wantEvents := []string{
+		"inscribe alice to " + userA, "transfer alice to " + RuleSets[0].BurnAddress, "inscribe bob to " + userB,
+		"inscribe carol to " + userC,
+	}
+	if !reflect.DeepEqual(want.events, wantEvents) {
+		t.Fatalf("events %v, want %v", want.events, wantEvents)
+	}
+	if len(want.deadLetters) != 1 {
+		t.Fatalf("dead letters %v, want the malformed operation", want.deadLetters)
+	}
+
+	for _, commitLost := range []bool{false, true} {
+		for failAt := 1; failAt <= clean.calls; failAt++ {
+			t.Run(fmt.Sprintf("failAt=%d/commitLost=%v", failAt, commitLost), func(t *testing.T) {
+				db := newFaultyDB(failAt, commitLost)
+				if failures := syncAll(t, ix, db, bulk); failures != 1 {
+					t.Fatalf("failures %d, want 1", failures)
+				}
+
+				got := takeSnapshot(t, db)
+				if !reflect.DeepEqual(got.usernames, want.usernames) {
+					t.Errorf("usernames %v, want %v", got.usernames, want.usernames)
+				}
+				if !reflect.DeepEqual(got.events, want.events) {
+					t.Errorf("events %v, want %v", got.events, want.events)
+				}
+				if !reflect.DeepEqual(got.deadLetters, want.deadLetters) {
+					t.Errorf("dead letters %v, want %v", got.deadLetters, want.deadLetters)
+				}
+				if got.page != want.page || got.lastHash != want.lastHash {
+					t.Errorf("cursor %d/%v, want %d/%v", got.page, got.lastHash, want.page, want.lastHash)
+				}
+			})
+		}
+	}
+}
+
+// TestBackfillFetchesBeforeBeginning checks a backfill whose pages cannot be fetched never begins a transaction.
+func TestBackfillFetchesBeforeBeginning(t *testing.T) {
+	ix := startFakeNode(t)
+	db := newFaultyDB(0, false)
+	c, err := ix.loadCursor(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = ix.backfill(ctx, db, c); !errors.Is(err, context.Canceled) {
+		t.Fatalf("error %v, want context.Canceled", err)
+	}
+	if db.calls != 0 {
+		t.Errorf("%d transaction calls, want none", db.calls)
+	}
+}
+
+func TestReplayStopsAtBlock(t *testing.T) {
+	ix := startFakeNode(t)
+
+	for until, want := range map[string][]string{"T1": {"alice"}, "T2": {"alice", "bob"}, lastHash: {"alice", "bob", "carol"}} {
+		usernames, err := ix.Replay(context.Background(), &until)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, username := range usernames {
+			got = append(got, username.Username)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("replay until %v: usernames %v, want %v", until, got, want)
+		}
+	}
+}
+
+// TestPendingBlocks follows blocks that are not final yet through a restart of the indexer before every sync: kept
+// pending with the final blocks after them, rolled back once they time out and applied late once they turn final.
+func TestPendingBlocks(t *testing.T) {
+	server := testutil.NewServer(t)
+
+	cfg := config.Default()
+	cfg.Keeta.BaseURL, cfg.Keeta.BaseURLs, cfg.Keeta.Quorum = server.URL, []string{server.URL}, 1
+	cfg.Keeta.KeetoolsBaseURL = server.URL
+	cfg.Indexer.Representatives = devnet.Representatives
+	cfg.Resolve()
+	ix, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	db := store.NewMemory()
+
+	sync := func() {
+		t.Helper()
+		c, err := ix.loadCursor(ctx, db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = ix.syncPage(ctx, db, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// expire makes the blocks first seen longer than the pending timeout ago
+	expire := func(hashes ...string) {
+		t.Helper()
+		firstSeen, err := db.PendingBlocks(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, hash := range hashes {
+			firstSeen[hash] = time.Now().Add(-2 * cfg.Indexer.PendingTimeout)
+		}
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = tx.ReplacePendingActions(ctx, nil, firstSeen); err != nil {
+			t.Fatal(err)
+		}
+		if err = tx.Commit(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(step string, wantOwners map[string]string, wantPending []string) {
+		t.Helper()
+		usernames, err := db.AllUsernames(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		owners := map[string]string{}
+		for _, u := range usernames {
+			owners[u.Username] = u.Owner
+		}
+		actions, err := db.PendingActions(ctx, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		pending := []string{}
+		for _, action := range actions {
+			pending = append(pending, *action.Username)
+		}
+		if !reflect.DeepEqual(owners, wantOwners) || !reflect.DeepEqual(pending, wantPending) {
+			t.Fatalf("%v: owners %v and pending %v, want %v and %v", step, owners, pending, wantOwners, wantPending)
+		}
+	}
+
+	server.Inscribe(userA, tokenA, "alice")
+	bobCreated := server.PendingBlock(userB, userB, devnet.CreateIdentifier(tokenB))
+	bobNamed := server.PendingBlock(tokenB, userB, devnet.SetInfo("KNS", "bob"))
+	server.Inscribe(userC, tokenC, "carol")
+
+	sync()
+	check("pending", map[string]string{"alice": userA}, []string{"bob", "carol"})
+	firstSeen, err := db.PendingBlocks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(firstSeen) != 4 {
+		t.Fatalf("pending blocks %v, want bob's and the final carol's held behind them", firstSeen)
+	}
+
+	sync()
+	if again, err := db.PendingBlocks(ctx); err != nil || !reflect.DeepEqual(again, firstSeen) {
+		t.Fatalf("pending blocks %v %v after a restart, want first seen kept %v", again, err, firstSeen)
+	}
+
+	// a block behind another pending one times out too
+	expire(bobNamed)
+	sync()
+	check("rolled back behind a pending block", map[string]string{"alice": userA}, []string{"carol"})
+
+	server.Finalize(bobCreated)
+	sync()
+	check("rolled back", map[string]string{"alice": userA, "carol": userC}, []string{})
+
+	server.Finalize(bobNamed)
+	sync()
+	check("final after the rollback", map[string]string{"alice": userA, "bob": userB, "carol": userC}, []string{})
+
+	sync()
+	if events, err := db.Events(ctx, "bob"); err != nil || len(events) != 1 {
+		t.Fatalf("bob events %+v %v, want the late inscription once", events, err)
+	}
+	if firstSeen, err = db.PendingBlocks(ctx); err != nil || len(firstSeen) != 0 {
+		t.Fatalf("pending blocks %v %v, want none", firstSeen, err)
+	}
+}
+
+// TestProtocolVectors checks that the rules recognize exactly the valid usernames, or names with subnames, and the
+// valid memos of their commands in the conformance vectors.
+func TestProtocolVectors(t *testing.T) {
+	vectors, err := protocol.LoadVectors()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rules := range RuleSets {
+		names := vectors.Usernames
+		if rules.Names {
+			names = vectors.Names
+		}
+		for _, vector := range names {
+			operation := Operation{Type: OperationTypeSetInfo, Name: rules.TokenName, Description: vector.Description}
+			got := rules.IsInscribeInstruction(operation, tokenA, nil, []Operation{{
+				Type: OperationTypeCreateIdentifier, Identifier: tokenA,
+			}}, nil)
+			if want := vector.Error == ""; got != want {
+				t.Errorf("v%d inscribes %q: %v, want %v", rules.Version, vector.Description, got, want)
+			}
+		}
+
+		for _, vector := range vectors.Memos {
+			memo := vector.Memo
+			// an amount other than the transfer amount keeps invalid memos from being transfers
+			block := Block{Hash: "B", Account: userA, Operations: []Operation{{
+				Type: OperationTypeSend, To: rules.BurnAddress, Token: tokenA, Amount: "0x2", Extra: &memo,
+			}}}
+			action, ok := rules.Action(block, 0, nil)
+			if vector.Error != "" || !slices.Contains(rules.Commands, vector.Command["command"]) {
+				if ok {
+					t.Errorf("v%d accepts %q as %v", rules.Version, memo, action.Type)
+				}
+			} else if !ok || action.Type != vector.Command["command"] {
+				t.Errorf("v%d: %q is %v, want %v", rules.Version, memo, action.Type, vector.Command["command"])
+			}
+		}
+	}
+}
+
+func TestRulesAt(t *testing.T) {
+	ix, err := New(config.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1, v2 := RuleSets[0], RuleSets[1]
+
+	for timestamp, want := range map[time.Time]*Rules{
+		v1.ActivatedAt.Add(-time.Nanosecond): nil,
+		v1.ActivatedAt:                       v1,
+		v1.ActivatedAt.Add(time.Hour):        v1,
+		v2.ActivatedAt.Add(-time.Nanosecond): v1,
+		v2.ActivatedAt:                       v2,
+		v2.ActivatedAt.AddDate(1, 0, 0):      v2,
+	} {
+		if got := ix.RulesAt(timestamp); got != want {
+			t.Errorf("rules at %v: %+v, want %+v", timestamp, got, want)
+		}
+	}
+}
+
+func TestActivatedRuleSets(t *testing.T) {
+	v1, v2 := RuleSets[0], RuleSets[1]
+
+	cfg := config.Default()
+	cfg.Indexer.Activations = "2=" + v1.ActivatedAt.Add(time.Hour).Format(time.RFC3339)
+	ix, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ix.RulesAt(v1.ActivatedAt.Add(time.Hour)); got.Version != 2 {
+		t.Errorf("rules after the moved activation are v%d, want v2", got.Version)
+	}
+	if got := ix.RulesAt(v1.ActivatedAt); got != v1 {
+		t.Errorf("rules at the activation of v1 are %+v, want v1", got)
+	}
+	if !v2.ActivatedAt.Equal(time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("moving an activation changed RuleSets: v2 activates at %v", v2.ActivatedAt)
+	}
+
+	for _, activations := range []string{
+		"2",
+		"x=2026-01-01T00:00:00Z",
+		"2=2026-01-01",
+		"3=2026-01-01T00:00:00Z",
+		"1=" + v2.ActivatedAt.Add(time.Hour).Format(time.RFC3339),
+	} {
+		cfg.Indexer.Activations = activations
+		if _, err := New(cfg); err == nil {
+			t.Errorf("activations %q accepted", activations)
+		}
+	}
+}
+
+func TestFeeRuleSets(t *testing.T) {
+	fee := config.Fee{TreasuryAddress: "keeta_treasury", BaseToken: "keeta_base", Tiers: "3:100"}
+	v1, v2 := RuleSets[0], RuleSets[1]
+	between := v1.ActivatedAt.Add(time.Hour)
+
+	for activatedAt, want := range map[time.Time][]struct {
+		version     int
+		activatedAt time.Time
+		fee         bool
+	}{
+		between:        {{1, v1.ActivatedAt, false}, {1, between, true}, {2, v2.ActivatedAt, true}},
+		v2.ActivatedAt: {{1, v1.ActivatedAt, false}, {2, v2.ActivatedAt, true}},
+		v2.ActivatedAt.Add(time.Hour): {
+			{1, v1.ActivatedAt, false}, {2, v2.ActivatedAt, false}, {2, v2.ActivatedAt.Add(time.Hour), true},
+		},
+	} {
+		fee.ActivatedAt = activatedAt.Format(time.RFC3339)
+		ruleSets, err := feeRuleSets(RuleSets, fee)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ruleSets) != len(want) {
+			t.Fatalf("fee at %v: %d rule sets, want %d", activatedAt, len(ruleSets), len(want))
+		}
+		for i, rules := range ruleSets {
+			if rules.Version != want[i].version || !rules.ActivatedAt.Equal(want[i].activatedAt) || (rules.Fee != nil) != want[i].fee {
+				t.Errorf(
+					"fee at %v: rule set %d is v%d at %v with fee %v, want %+v",
+					activatedAt, i, rules.Version, rules.ActivatedAt, rules.Fee != nil, want[i],
+				)
+			}
+		}
+	}
+
+	fee.ActivatedAt = v1.ActivatedAt.Format(time.RFC3339)
+	if _, err := feeRuleSets(RuleSets, fee); err == nil {
+		t.Fatal("fee activated with protocol version 1 accepted")
+	}
+}
+
+func TestSubnamesPayNoFee(t *testing.T) {
+	rules := *RuleSets[1]
+	rules.Fee = &FeeSchedule{Treasury: "keeta_treasury", BaseToken: "keeta_base", Tiers: []FeeTier{{32, big.NewInt(100)}}}
+	created := []Operation{{Type: OperationTypeCreateIdentifier, Identifier: tokenA}}
+
+	for description, want := range map[string]bool{"alice": false, "blog.alice": true} {
+		operation := Operation{Type: OperationTypeSetInfo, Name: rules.TokenName, Description: description}
+		if got := rules.IsInscribeInstruction(operation, tokenA, nil, created, nil); got != want {
+			t.Errorf("inscribes %q without fee: %v, want %v", description, got, want)
+		}
+	}
+}
+
+func TestPaymentPaysForOneInscription(t *testing.T) {
+	rules := *RuleSets[1]
+	rules.Fee = &FeeSchedule{Treasury: "keeta_treasury", BaseToken: "keeta_base", Tiers: []FeeTier{{32, big.NewInt(100)}}}
+	created := []Operation{
+		{Type: OperationTypeCreateIdentifier, Identifier: tokenA},
+		{Type: OperationTypeSend, To: "keeta_treasury", Token: "keeta_base", Amount: "100"},
+	}
+	block := Block{Hash: "B", Account: tokenA, Signer: userA, Operations: []Operation{
+		{Type: OperationTypeSetInfo, Name: rules.TokenName, Description: "alice"},
+		{Type: OperationTypeSetInfo, Name: rules.TokenName, Description: "bob"},
+	}}
+
+	actions := rules.Actions(block, created)
+	if len(actions) != 1 || actions[0].Username != "alice" {
+		t.Fatalf("one payment inscribes %+v, want alice only", actions)
+	}
+	if _, ok := rules.Action(block, 1, created); ok {
+		t.Error("the second inscription is paid by the payment of the first")
+	}
+
+	block.Operations = append(block.Operations, Operation{
+		Type: OperationTypeSend, To: "keeta_treasury", Token: "keeta_base", Amount: "0x64",
+	})
+	if actions := rules.Actions(block, created); len(actions) != 2 {
+		t.Errorf("two payments inscribe %+v, want alice and bob", actions)
+	}
+}
+
+func TestDirectTransfers(t *testing.T) {
+	block := Block{Hash: "B", Account: userA, Signer: userA, Operations: []Operation{
+		{Type: OperationTypeSend, To: userB, Token: tokenA, Amount: "0x1"},
+	}}
+	if action, ok := RuleSets[0].Action(block, 0, nil); ok {
+		t.Errorf("version 1 decodes a send to %v as %+v, want no action", userB, action)
+	}
+	action, ok := RuleSets[1].Action(block, 0, nil)
+	if !ok || action.Type != ActionTransfer || action.Token != tokenA || action.Owner != userB {
+		t.Errorf("version 2 decodes a send to %v as %+v, want a transfer of %v", userB, action, tokenA)
+	}
+}
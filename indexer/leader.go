@@ -0,0 +1,220 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kns-indexer/metrics"
+	"kns-indexer/models"
+	"kns-indexer/store"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// leaderLockKey is the advisory lock only the replica campaigning for or holding the leadership holds.
+const leaderLockKey = 4_657_483_920_118
+
+var isLeader = metrics.NewGauge("kns_indexer_leader", "Whether this replica holds the leadership and runs the indexer")
+
+// Lead campaigns for the leadership until the context is done and supervises the indexer and runs the duties, e.g.
+// relaying the outbox, while this replica holds it. Duties run until the context passed to them is done. The leader
+// holds a session advisory lock and renews its lease in the leader table. When it dies its lock is
+// released and another replica takes over once the lease expired; when it can not renew the lease it stops indexing
+// before the lease expires.
+func (ix *Indexer) Lead(ctx context.Context, db *store.Postgres, duties ...func(ctx context.Context)) {
+	for ctx.Err() == nil {
+		if err := ix.lead(ctx, db, duties); err != nil && ctx.Err() == nil {
+			slog.Error("Leadership lost, campaigning again", "error", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(ix.cfg.Indexer.LeaderLease / 3):
+			}
+		}
+	}
+}
+
+// lead campaigns on a dedicated connection and holds the leadership until it is lost or the context is done.
+func (ix *Indexer) lead(ctx context.Context, db *store.Postgres, duties []func(ctx context.Context)) error {
+	pooled, err := db.Pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// closing the connection releases the advisory lock even when unlocking fails
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	term, err := ix.campaign(ctx, db, conn)
+	if err != nil {
+		return err
+	}
+	slog.Info("Acquired leadership", "instanceId", ix.cfg.Indexer.InstanceID, "term", term.Number)
+	isLeader.Set(1)
+	defer isLeader.Set(0)
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	supervised := make(chan struct{})
+	go func() {
+		defer close(supervised)
+		var wg sync.WaitGroup
+		for _, duty := range duties {
+			wg.Go(func() { duty(leaderCtx) })
+		}
+		ix.Supervise(leaderCtx, db.WithTerm(term))
+		wg.Wait()
+	}()
+
+	err = ix.hold(leaderCtx, conn, term)
+	cancel()
+	<-supervised
+
+	// a graceful stop hands the leadership over without waiting for the lease to expire
+	if _, resignErr := conn.Exec(
+		context.Background(),
+		"UPDATE leader SET holder = NULL, lease_expires_at = NOW() WHERE id = 1 AND holder = $1 AND term = $2;",
+		term.Holder,
+		term.Number,
+	); resignErr != nil {
+		slog.Warn("failed to resign leadership", "error", resignErr)
+	}
+	ix.updateStatus(func(s *models.Status) { s.Leader.IsLeader = false })
+
+	return err
+}
+
+// campaign waits until this replica holds the advisory lock and the lease of the previous leader expired, then starts
+// a new term.
+func (ix *Indexer) campaign(ctx context.Context, db *store.Postgres, conn *pgx.Conn) (*store.Term, error) {
+	locked := false
+	for {
+		if !locked {
+			if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1);", leaderLockKey).Scan(&locked); err != nil {
+				return nil, err
+			}
+		}
+
+		if locked {
+			var number int64
+			err := conn.QueryRow(
+				ctx,
+				`UPDATE leader SET
+					holder = $1,
+					term = term + 1,
+					acquired_at = NOW(),
+					renewed_at = NOW(),
+					lease_expires_at = NOW() + make_interval(secs => $2)
+				WHERE id = 1 AND (holder IS NULL OR lease_expires_at < NOW())
+				RETURNING term;`,
+				ix.cfg.Indexer.InstanceID,
+				ix.cfg.Indexer.LeaderLease.Seconds(),
+			).Scan(&number)
+			if err == nil {
+				term := &store.Term{Holder: ix.cfg.Indexer.InstanceID, Number: number}
+				if err = ix.refreshLeaderStatus(ctx, conn); err != nil {
+					return nil, err
+				}
+				return term, nil
+			} else if !errors.Is(err, pgx.ErrNoRows) {
+				return nil, err
+			}
+		}
+
+		if err := ix.refreshFollowerStatus(ctx, db, conn); err != nil {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(ix.cfg.Indexer.LeaderLease / 3):
+		}
+	}
+}
+
+// hold renews the lease every third of it until the context is done or the lease can not be renewed in time.
+func (ix *Indexer) hold(ctx context.Context, conn *pgx.Conn, term *store.Term) error {
+	ticker := time.NewTicker(ix.cfg.Indexer.LeaderLease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		renewCtx, cancel := context.WithTimeout(ctx, ix.cfg.Indexer.LeaderLease/3)
+		commandTag, err := conn.Exec(
+			renewCtx,
+			`UPDATE leader SET renewed_at = NOW(), lease_expires_at = NOW() + make_interval(secs => $3)
+			WHERE id = 1 AND holder = $1 AND term = $2 AND lease_expires_at > NOW();`,
+			term.Holder,
+			term.Number,
+			ix.cfg.Indexer.LeaderLease.Seconds(),
+		)
+		cancel()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to renew lease of term %d: %w", term.Number, err)
+		}
+		if commandTag.RowsAffected() == 0 {
+			return fmt.Errorf("%w: term %d expired", store.ErrNotLeader, term.Number)
+		}
+
+		if err = ix.refreshLeaderStatus(ctx, conn); err != nil && ctx.Err() == nil {
+			slog.Warn("failed to refresh leader status", "error", err)
+		}
+	}
+}
+
+// Follow shows the leader and its progress in the status until the context is done, for replicas that serve the API
+// without campaigning for the leadership.
+func (ix *Indexer) Follow(ctx context.Context, db *store.Postgres) {
+	for {
+		if err := ix.refreshFollowerStatus(ctx, db, db.Pool); err != nil && ctx.Err() == nil {
+			slog.Warn("failed to refresh leader status", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(ix.cfg.Indexer.LeaderLease / 3):
+		}
+	}
+}
+
+// querier is a connection or pool the leader row is read through.
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// refreshFollowerStatus shows the leader and its progress instead of the progress of this replica.
+func (ix *Indexer) refreshFollowerStatus(ctx context.Context, db *store.Postgres, q querier) error {
+	if err := ix.refreshLeaderStatus(ctx, q); err != nil {
+		return err
+	}
+	page, lastBlockTimestamp, lastBlockHash, err := db.LoadCursor(ctx)
+	if err != nil {
+		return err
+	}
+	ix.updateStatus(func(s *models.Status) {
+		s.Page, s.LastBlockTimestamp, s.LastBlockHash = page, lastBlockTimestamp, lastBlockHash
+	})
+	return nil
+}
+
+func (ix *Indexer) refreshLeaderStatus(ctx context.Context, q querier) error {
+	leader := models.Leader{InstanceID: ix.cfg.Indexer.InstanceID}
+	if err := q.QueryRow(
+		ctx, "SELECT holder, term, lease_expires_at FROM leader WHERE id = 1;",
+	).Scan(&leader.Holder, &leader.Term, &leader.LeaseExpiresAt); err != nil {
+		return err
+	}
+	leader.IsLeader = leader.Holder != nil && *leader.Holder == ix.cfg.Indexer.InstanceID
+	ix.updateStatus(func(s *models.Status) { s.Leader = leader })
+	return nil
+}
@@ -0,0 +1,153 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"kns-indexer/store"
+	"os"
+	"testing"
+	"time"
+)
+
+const testLease = 600 * time.Millisecond
+
+// startLeading opens the test database with nobody holding the leadership and lets the indexer lead until the test
+// ends. It returns the context of the duty once the indexer holds the leadership.
+func startLeading(t *testing.T) (*Indexer, *store.Postgres, context.Context) {
+	t.Helper()
+
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	db, err := store.OpenPostgres(ctx, databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Reset(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Pool.Exec(ctx, "UPDATE leader SET holder = NULL, lease_expires_at = NULL WHERE id = 1;"); err != nil {
+		t.Fatal(err)
+	}
+
+	ix := startFakeNode(t)
+	ix.cfg.Indexer.InstanceID = "replica-a"
+	ix.cfg.Indexer.LeaderLease = testLease
+
+	duties := make(chan context.Context, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ix.Lead(ctx, db, func(ctx context.Context) {
+			duties <- ctx
+			<-ctx.Done()
+		})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		db.Close()
+	})
+
+	select {
+	case duty := <-duties:
+		return ix, db, duty
+	case <-time.After(5 * time.Second):
+		t.Fatal("leadership not acquired")
+		return nil, nil, nil
+	}
+}
+
+func leaderRow(t *testing.T, db *store.Postgres) (holder *string, term int64, leaseExpiresAt time.Time) {
+	t.Helper()
+	if err := db.Pool.QueryRow(
+		context.Background(), "SELECT holder, term, lease_expires_at FROM leader WHERE id = 1;",
+	).Scan(&holder, &term, &leaseExpiresAt); err != nil {
+		t.Fatal(err)
+	}
+	return holder, term, leaseExpiresAt
+}
+
+func TestLeadRenewsLease(t *testing.T) {
+	ix, db, duty := startLeading(t)
+
+	_, term, leaseExpiresAt := leaderRow(t, db)
+	time.Sleep(2 * testLease)
+
+	holder, renewedTerm, renewedLeaseExpiresAt := leaderRow(t, db)
+	if holder == nil || *holder != "replica-a" || renewedTerm != term || !renewedLeaseExpiresAt.After(leaseExpiresAt) {
+		t.Errorf("leader %v of term %d until %v, want the lease of term %d renewed", holder, renewedTerm,
+			renewedLeaseExpiresAt, term)
+	}
+	if duty.Err() != nil || !ix.Status().Leader.IsLeader {
+		t.Error("leadership lost while renewing the lease")
+	}
+}
+
+func TestFollowShowsLeader(t *testing.T) {
+	leader, db, _ := startLeading(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	follower := startFakeNode(t)
+	follower.cfg.Indexer.InstanceID = "replica-b"
+	follower.cfg.Indexer.LeaderLease = testLease
+	go follower.Follow(ctx, db)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status := follower.Status()
+		if holder := status.Leader.Holder; holder != nil && *holder == "replica-a" {
+			if status.Leader.IsLeader || status.Leader.Term != leader.Status().Leader.Term {
+				t.Errorf("follower shows leader %+v, want replica-a in the term of the leader", status.Leader)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("follower shows leader %+v, want replica-a", status.Leader)
+		}
+		time.Sleep(testLease / 6)
+	}
+}
+
+func TestLeadStopsAfterTermLost(t *testing.T) {
+	_, db, duty := startLeading(t)
+	ctx := context.Background()
+
+	_, term, _ := leaderRow(t, db)
+	// another replica took over, e.g. after this one could not reach the database for longer than the lease
+	if _, err := db.Pool.Exec(
+		ctx,
+		`UPDATE leader SET holder = 'replica-b', term = term + 1, lease_expires_at = NOW() + INTERVAL '1 minute'
+		WHERE id = 1;`,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.WithTerm(&store.Term{Holder: "replica-a", Number: term}).Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback(ctx)
+	if err = tx.RecordEvent(ctx, store.Action{Type: "inscribe", BlockHash: "B1", Username: "alice", Timestamp: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Commit(ctx); !errors.Is(err, store.ErrNotLeader) {
+		t.Errorf("commit of the lost term error %v, want ErrNotLeader", err)
+	}
+
+	select {
+	case <-duty.Done():
+	case <-time.After(2 * testLease):
+		t.Fatal("duties still running after the term was lost")
+	}
+	if holder, _, _ := leaderRow(t, db); holder == nil || *holder != "replica-b" {
+		t.Errorf("leader %v, want replica-b to keep the leadership", holder)
+	}
+}
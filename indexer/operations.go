@@ -1,30 +1,47 @@
 package indexer
 
 import (
+	"kns-indexer/kns/protocol"
 	"slices"
-	"strings"
 )
 
-func IsInscribeInstruction(
-	operation map[string]any,
+// IsInscribeInstruction reports whether the operation inscribes a name, paying its fee with a payment of the block or
+// the last block not in usedPayments. The payment is added to usedPayments.
+func (r *Rules) IsInscribeInstruction(
+	operation Operation,
 	tokenAccount string,
-	lastBlockOperations []any,
+	blockOperations []Operation,
+	lastBlockOperations []Operation,
+	usedPayments map[*Operation]bool,
 ) bool {
-	return int(operation["type"].(float64)) == OperationTypeSetInfo &&
-		operation["name"] == TokenName &&
-		UsernamePattern.MatchString(strings.ToLower(operation["description"].(string))) &&
-		slices.ContainsFunc(lastBlockOperations, func(opRaw any) bool {
-			op := opRaw.(map[string]any)
-			return int(op["type"].(float64)) == OperationTypeCreateIdentifier && op["identifier"] == tokenAccount
-		})
+	if operation.Type != OperationTypeSetInfo || operation.Name != r.TokenName {
+		return false
+	}
+
+	username, err := r.parseName(operation.Description)
+
+	return err == nil &&
+		slices.ContainsFunc(lastBlockOperations, func(op Operation) bool {
+			return op.Type == OperationTypeCreateIdentifier && op.Identifier == tokenAccount
+		}) &&
+		(r.Fee == nil || protocol.Parent(username) != "" ||
+			r.Fee.IsFeePaid(username, usedPayments, blockOperations, lastBlockOperations))
+}
+
+// parseName returns the username or name the token description inscribes.
+func (r *Rules) parseName(description string) (string, error) {
+	if r.Names {
+		return protocol.ParseName(description)
+	}
+	return protocol.ParseUsername(description)
 }
 
-func IsTransferInstruction(operation map[string]any) bool {
-	return int(operation["type"].(float64)) == OperationTypeSend && operation["amount"] == "0x1"
+func (r *Rules) IsTransferInstruction(operation Operation) bool {
+	return operation.Type == OperationTypeSend && operation.Amount == r.TransferAmount
 }
 
-func IsSetPrimaryNameOrCidInstruction(operation map[string]any) bool {
-	return int(operation["type"].(float64)) == OperationTypeSend &&
-		operation["to"] == BurnAddress &&
-		operation["extra"] != nil
+func (r *Rules) IsSetPrimaryNameOrCidInstruction(operation Operation) bool {
+	return operation.Type == OperationTypeSend &&
+		operation.To == r.BurnAddress &&
+		operation.Extra != nil
 }
@@ -0,0 +1,44 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kns-indexer/models"
+	"kns-indexer/store"
+)
+
+var ErrReplayIncomplete = errors.New("replay stopped before the requested block")
+
+// Replay indexes the history from the start into memory up to and including the block with the given hash, the
+// whole final history when until is nil, and returns the resulting usernames with their records. Dead letters are not
+// replayed.
+func (ix *Indexer) Replay(ctx context.Context, until *string) ([]models.Username, error) {
+	db := store.NewMemory()
+	c, err := ix.loadCursor(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	c.until = until
+
+	for !c.reached() {
+		page := c.page
+		if c, err = ix.syncPage(ctx, db, c); err != nil {
+			return nil, err
+		}
+
+		// the page only stays the same at the chain head or at blocks that are not final yet
+		if c.page == page && !c.reached() {
+			if until != nil {
+				return nil, fmt.Errorf("%w: stopped at page %d", ErrReplayIncomplete, c.page)
+			}
+			break
+		}
+	}
+
+	usernames, err := db.AllUsernames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return usernames, store.AttachRecords(ctx, db, usernames)
+}
@@ -0,0 +1,126 @@
+package indexer
+
+import (
+	"fmt"
+	"kns-indexer/kns/protocol"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rules is one version of the KNS protocol. A version applies to every block whose timestamp is at or after
+// ActivatedAt and before the ActivatedAt of the next version, so reindexing always replays a block with the rules
+// that were in force when it was produced. A version that has activated must never be edited: changes go into a new
+// version appended to RuleSets with an activation timestamp in the future. A version that has not activated yet may
+// still change until it does.
+type Rules struct {
+	// Version is the protocol version, versions enforcing the registration fee keep the number of the one they
+	// derive from.
+	Version     int
+	ActivatedAt time.Time
+
+	TokenName      string
+	BurnAddress    string
+	TransferAmount string
+
+	// Commands are the memo commands of kns/protocol the version accepts, other memos are not commands.
+	Commands []string
+	// MemoAsToken reproduces version 1, which took the whole memo as the token of set_primary_name and set_cid
+	// commands, and the token as the CID, so they never matched a username.
+	MemoAsToken bool
+	// Names inscribes the Unicode names of protocol.ParseName instead of ASCII usernames, kept in the form they were
+	// inscribed in for display, and lets the owner of a name inscribe subnames under it, like blog.alice under alice,
+	// which pay no registration fee.
+	Names bool
+	// DirectTransfers takes a send of a username token to an account other than the burn address as a transfer of the
+	// username to it, while version 1 only took the sends to the burn address without a command as transfers.
+	DirectTransfers bool
+
+	// Fee is nil when inscriptions are free.
+	Fee *FeeSchedule
+}
+
+// RuleSets lists every protocol version ordered by activation timestamp. An Indexer adds the registration fee it is
+// configured with from the activation of the fee on.
+var RuleSets = []*Rules{
+	{
+		Version:     1,
+		ActivatedAt: time.Date(2025, 12, 2, 0, 0, 0, 0, time.UTC),
+
+		TokenName:      "KNS",
+		BurnAddress:    "keeta_aeaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaazpi2nodu",
+		TransferAmount: "0x1",
+
+		Commands:    []string{protocol.CommandSetPrimaryName, protocol.CommandSetCID},
+		MemoAsToken: true,
+	},
+	{
+		Version:     2,
+		ActivatedAt: time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC),
+
+		TokenName:      "KNS",
+		BurnAddress:    "keeta_aeaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaazpi2nodu",
+		TransferAmount: "0x1",
+
+		Commands: []string{
+			protocol.CommandSetPrimaryName, protocol.CommandSetCID, protocol.CommandSetRecord, protocol.CommandSetAddress,
+			protocol.CommandClearPrimaryName, protocol.CommandClearCID, protocol.CommandClearRecord,
+			protocol.CommandAssignSubname,
+		},
+		Names:           true,
+		DirectTransfers: true,
+	},
+}
+
+// activatedRuleSets returns the rule sets with the activation timestamps moved by activations, version=timestamp
+// pairs separated by commas, which have to keep the versions in order. It returns the rule sets unchanged when
+// activations is empty.
+func activatedRuleSets(ruleSets []*Rules, activations string) ([]*Rules, error) {
+	if activations == "" {
+		return ruleSets, nil
+	}
+
+	result := slices.Clone(ruleSets)
+	for _, pair := range strings.Split(activations, ",") {
+		versionStr, activatedAtStr, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("activation %q should be version=timestamp", pair)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("activation %q: invalid version: %w", pair, err)
+		}
+		activatedAt, err := time.Parse(time.RFC3339, activatedAtStr)
+		if err != nil {
+			return nil, fmt.Errorf("activation %q should be RFC 3339 timestamp: %w", pair, err)
+		}
+
+		i := slices.IndexFunc(result, func(rules *Rules) bool { return rules.Version == version })
+		if i < 0 {
+			return nil, fmt.Errorf("activation %q: unknown protocol version %d", pair, version)
+		}
+		rules := *result[i]
+		rules.ActivatedAt = activatedAt
+		result[i] = &rules
+	}
+
+	for i := 1; i < len(result); i++ {
+		if result[i].ActivatedAt.Before(result[i-1].ActivatedAt) {
+			return nil, fmt.Errorf(
+				"protocol version %d should not activate before version %d", result[i].Version, result[i-1].Version,
+			)
+		}
+	}
+	return result, nil
+}
+
+// RulesAt returns the rules active at the given block timestamp or nil if the timestamp predates the protocol.
+func (ix *Indexer) RulesAt(timestamp time.Time) *Rules {
+	for i := len(ix.ruleSets) - 1; i >= 0; i-- {
+		if !timestamp.Before(ix.ruleSets[i].ActivatedAt) {
+			return ix.ruleSets[i]
+		}
+	}
+	return nil
+}
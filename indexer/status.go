@@ -0,0 +1,30 @@
+package indexer
+
+import (
+	"kns-indexer/models"
+	"maps"
+	"slices"
+)
+
+// Status returns a snapshot of the indexer state.
+func (ix *Indexer) Status() models.Status {
+	ix.status.RLock()
+	defer ix.status.RUnlock()
+
+	snapshot := ix.status.Status
+	snapshot.Health.Ready = snapshot.Health.ConsecutiveFailures < ix.cfg.Indexer.MaxFailures
+	snapshot.Consensus.Quorum = ix.cfg.Keeta.Quorum
+	snapshot.Consensus.Sources = slices.Clone(ix.status.Consensus.Sources)
+	if ix.status.Consensus.LastDisagreement != nil {
+		disagreement := *ix.status.Consensus.LastDisagreement
+		disagreement.Fingerprints = maps.Clone(disagreement.Fingerprints)
+		snapshot.Consensus.LastDisagreement = &disagreement
+	}
+	return snapshot
+}
+
+func (ix *Indexer) updateStatus(update func(s *models.Status)) {
+	ix.status.Lock()
+	defer ix.status.Unlock()
+	update(&ix.status.Status)
+}
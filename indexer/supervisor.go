@@ -0,0 +1,109 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kns-indexer/metrics"
+	"kns-indexer/models"
+	"kns-indexer/store"
+	"log/slog"
+	"runtime/debug"
+	"strconv"
+	"time"
+)
+
+var (
+	minRestartBackoff = time.Second
+	maxRestartBackoff = time.Minute
+
+	indexerFailures = metrics.NewCounter("kns_indexer_failures_total", "Failed indexer runs, by whether the run panicked")
+	indexerReady    = metrics.NewGauge("kns_indexer_ready", "Whether the indexer has fewer than the maximum consecutive failures")
+)
+
+// Supervise runs the indexer until the context is done, restarting it with exponential backoff from the last
+// committed batch whenever it fails or panics.
+func (ix *Indexer) Supervise(ctx context.Context, db store.Store) {
+	indexerReady.Set(1)
+
+	backoff := minRestartBackoff
+	for {
+		err := ix.runRecovered(ctx, db)
+		if ctx.Err() != nil {
+			return
+		}
+
+		failures := ix.recordFailure(err)
+		// a run that committed batches before failing starts the backoff over
+		if failures == 1 {
+			backoff = minRestartBackoff
+		}
+
+		slog.Error("Indexer failed, restarting", "error", err, "consecutiveFailures", failures, "backoff", backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxRestartBackoff)
+	}
+}
+
+func (ix *Indexer) runRecovered(ctx context.Context, db store.Store) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &panicError{value: r, stack: debug.Stack()}
+		}
+	}()
+	return ix.Run(ctx, db)
+}
+
+type panicError struct {
+	value any
+	stack []byte
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("panic: %v\n%s", e.value, e.stack)
+}
+
+// Ready reports whether the indexer has fewer than indexer.max_failures failed runs in a row.
+func (ix *Indexer) Ready() bool {
+	ix.status.RLock()
+	defer ix.status.RUnlock()
+	return ix.status.Health.ConsecutiveFailures < ix.cfg.Indexer.MaxFailures
+}
+
+func (ix *Indexer) recordSuccess() {
+	now := time.Now()
+	ix.updateStatus(func(s *models.Status) {
+		s.Health.ConsecutiveFailures = 0
+		s.Health.LastSuccessAt = &now
+	})
+	indexerReady.Set(1)
+}
+
+func (ix *Indexer) recordFailure(err error) int {
+	lastError := err.Error()
+	var pe *panicError
+	panicked := errors.As(err, &pe)
+	if panicked {
+		lastError = fmt.Sprintf("panic: %v", pe.value)
+	}
+	indexerFailures.Inc("panic", strconv.FormatBool(panicked))
+
+	now := time.Now()
+	var failures int
+	ix.updateStatus(func(s *models.Status) {
+		s.Health.ConsecutiveFailures++
+		s.Health.Restarts++
+		s.Health.LastFailureAt = &now
+		s.Health.LastError = lastError
+		failures = s.Health.ConsecutiveFailures
+	})
+	if failures >= ix.cfg.Indexer.MaxFailures {
+		indexerReady.Set(0)
+	}
+	return failures
+}
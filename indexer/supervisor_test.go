@@ -0,0 +1,76 @@
+package indexer
+
+import (
+	"context"
+	"kns-indexer/store"
+	"strings"
+	"testing"
+	"time"
+)
+
+// panickyDB is an in-memory store whose first panics runs panic loading the cursor. Every run sends whether the
+// indexer was ready when it started.
+type panickyDB struct {
+	*store.Memory
+	panics int
+	runs   chan bool
+	ix     *Indexer
+}
+
+func (db *panickyDB) LoadCursor(ctx context.Context) (int, *time.Time, *string, error) {
+	db.runs <- db.ix.Ready()
+	if db.panics > 0 {
+		db.panics--
+		panic("store unavailable")
+	}
+	return db.Memory.LoadCursor(ctx)
+}
+
+func TestSupervise(t *testing.T) {
+	minBackoff, maxBackoff := minRestartBackoff, maxRestartBackoff
+	minRestartBackoff, maxRestartBackoff = 10*time.Millisecond, 40*time.Millisecond
+	t.Cleanup(func() { minRestartBackoff, maxRestartBackoff = minBackoff, maxBackoff })
+
+	ix := startFakeNode(t)
+	ix.cfg.Indexer.MaxFailures = 3
+	db := &panickyDB{Memory: store.NewMemory(), panics: 5, runs: make(chan bool, 6), ix: ix}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ix.Supervise(ctx, db)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// the runs restart after doubling backoffs up to the maximum, the instance not ready after 3 failures
+	wantBackoffs := []time.Duration{0, 10, 20, 40, 40, 40}
+	wantReady := []bool{true, true, true, false, false, false}
+	last := time.Now()
+	for run := range wantBackoffs {
+		ready := <-db.runs
+		now := time.Now()
+		if backoff := wantBackoffs[run] * time.Millisecond; now.Sub(last) < backoff {
+			t.Errorf("run %d restarted after %v, want a backoff of %v", run, now.Sub(last), backoff)
+		}
+		if ready != wantReady[run] {
+			t.Errorf("run %d started ready %v, want %v", run, ready, wantReady[run])
+		}
+		last = now
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !ix.Ready() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	health := ix.Status().Health
+	if !health.Ready || health.ConsecutiveFailures != 0 || health.LastSuccessAt == nil {
+		t.Errorf("health %+v, want ready again after a committed batch", health)
+	}
+	if health.Restarts != 5 || !strings.HasPrefix(health.LastError, "panic: store unavailable") {
+		t.Errorf("health %+v, want the 5 recovered panics recorded", health)
+	}
+}
@@ -0,0 +1,170 @@
+package indexer
+
+import (
+	"crypto/sha3"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"kns-indexer/keeta"
+	"math/big"
+	"slices"
+	"strings"
+)
+
+// verifyStaple checks the hash and signer signature of every block, that the block is the one it signed, and that
+// every vote is signed by one of the trusted representatives and covers all the blocks of the vote staple.
+func (ix *Indexer) verifyStaple(voteStaple map[string]any) error {
+	blocks, _ := voteStaple["blocks"].([]any)
+	for _, blockRaw := range blocks {
+		block, _ := blockRaw.(map[string]any)
+		signer := block["signer"]
+		if signer == nil {
+			signer = block["account"]
+		}
+		binary, err := verifySigned(block, signer)
+		if err == nil {
+			err = verifyBlock(block, binary)
+		}
+		if err != nil {
+			return fmt.Errorf("block %v: %w", block["$hash"], err)
+		}
+	}
+
+	votes, _ := voteStaple["votes"].([]any)
+	if len(votes) == 0 {
+		return fmt.Errorf("no votes")
+	}
+	blockHashes := stapleBlockHashes(voteStaple)
+	for _, voteRaw := range votes {
+		vote, ok := voteRaw.(map[string]any)
+		if !ok {
+			return fmt.Errorf("malformed vote")
+		}
+		if err := ix.verifyVote(vote, blockHashes); err != nil {
+			return fmt.Errorf("vote %v: %w", vote["$hash"], err)
+		}
+	}
+
+	return nil
+}
+
+// verifyVote checks that the vote is signed by one of the trusted representatives, that it is the vote they signed,
+// and that it covers all the blocks.
+func (ix *Indexer) verifyVote(vote map[string]any, blockHashes []string) error {
+	issuer, _ := vote["issuer"].(string)
+	if !slices.Contains(ix.cfg.Indexer.Representatives, issuer) {
+		return fmt.Errorf("issuer %v is not a trusted representative", vote["issuer"])
+	}
+	binary, err := verifySigned(vote, issuer)
+	if err != nil {
+		return err
+	}
+
+	signed, err := keeta.ParseVote(binary)
+	if err != nil {
+		return err
+	}
+	votedBlocks, _ := vote["blocks"].([]any)
+	if signed.Issuer != issuer || !slices.EqualFunc(votedBlocks, signed.Blocks, func(h any, signed string) bool {
+		s, ok := h.(string)
+		return ok && strings.EqualFold(s, signed)
+	}) {
+		return fmt.Errorf("differs from the signed vote")
+	}
+
+	for _, blockHash := range blockHashes {
+		if !slices.ContainsFunc(signed.Blocks, func(h string) bool { return strings.EqualFold(h, blockHash) }) {
+			return fmt.Errorf("does not cover block %v", blockHash)
+		}
+	}
+	return nil
+}
+
+// verifyBlock checks that the fields of the block the indexer applies are the ones of its signed binary form.
+func verifyBlock(raw map[string]any, binary []byte) error {
+	signed, err := keeta.ParseBlock(binary)
+	if err != nil {
+		return err
+	}
+	block, _, err := decodeBlock(raw)
+	if err != nil {
+		return err
+	}
+
+	if !block.Date.Equal(signed.Date) || block.Account != signed.Account || block.Signer != signed.Signer {
+		return fmt.Errorf("differs from the signed block")
+	}
+	if len(block.Operations) != len(signed.Operations) {
+		return fmt.Errorf("has %d operations, the signed block %d", len(block.Operations), len(signed.Operations))
+	}
+	for position, operation := range block.Operations {
+		if !operation.matches(signed.Operations[position]) {
+			return fmt.Errorf("operation %d differs from the signed block", position)
+		}
+	}
+	return nil
+}
+
+// matches reports whether the operation is the signed one. A missing amount is zero and a missing extra empty.
+func (o Operation) matches(signed keeta.Operation) bool {
+	amount, ok := new(big.Int), true
+	if o.Amount != "" {
+		amount, ok = amount.SetString(o.Amount, 0)
+	}
+	signedAmount := signed.Amount
+	if signedAmount == nil {
+		signedAmount = new(big.Int)
+	}
+	var extra string
+	if o.Extra != nil {
+		extra = *o.Extra
+	}
+
+	return ok && o.Type == signed.Type && o.To == signed.To && o.Token == signed.Token &&
+		amount.Cmp(signedAmount) == 0 && extra == signed.External && o.Name == signed.Name &&
+		o.Description == signed.Description && o.Identifier == signed.Identifier
+}
+
+// stapleBlockHashes returns the claimed hashes of the blocks of the vote staple.
+func stapleBlockHashes(voteStaple map[string]any) []string {
+	var blockHashes []string
+	blocks, _ := voteStaple["blocks"].([]any)
+	for _, blockRaw := range blocks {
+		block, _ := blockRaw.(map[string]any)
+		blockHash, _ := block["$hash"].(string)
+		blockHashes = append(blockHashes, blockHash)
+	}
+	return blockHashes
+}
+
+// verifySigned checks that "$hash" is SHA3-256 of "$binary", the base64 encoded signed data, and that "signature"
+// is the signature of the hash by the signer account. It returns the signed data.
+func verifySigned(object map[string]any, signer any) ([]byte, error) {
+	binaryStr, _ := object["$binary"].(string)
+	binary, err := base64.StdEncoding.DecodeString(binaryStr)
+	if err != nil || len(binary) == 0 {
+		return nil, fmt.Errorf("missing or malformed $binary")
+	}
+
+	hash := sha3.Sum256(binary)
+	if claimed, _ := object["$hash"].(string); !strings.EqualFold(claimed, hex.EncodeToString(hash[:])) {
+		return nil, fmt.Errorf("hash mismatch: claimed %v, computed %X", object["$hash"], hash)
+	}
+
+	signerAddress, _ := signer.(string)
+	account, err := keeta.ParseAccount(signerAddress)
+	if err != nil {
+		return nil, fmt.Errorf("signer %v: %w", signer, err)
+	}
+
+	signatureStr, _ := object["signature"].(string)
+	signature, err := hex.DecodeString(signatureStr)
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature")
+	}
+
+	if err = account.Verify(hash[:], signature); err != nil {
+		return nil, fmt.Errorf("signer %v: %w", signerAddress, err)
+	}
+	return binary, nil
+}
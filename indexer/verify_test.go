@@ -0,0 +1,258 @@
+package indexer
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha3"
+	"encoding"
+	"encoding/base64"
+	"encoding/hex"
+	"kns-indexer/config"
+	"kns-indexer/devnet"
+	"kns-indexer/keeta"
+	"maps"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testKey returns the deterministic ed25519 key of the name and its account address.
+func testKey(name string) (ed25519.PrivateKey, string) {
+	seed := sha256.Sum256([]byte(name))
+	privateKey := ed25519.NewKeyFromSeed(seed[:])
+	account := keeta.Account{Algorithm: keeta.KeyAlgorithmED25519, PublicKey: privateKey.Public().(ed25519.PublicKey)}
+	return privateKey, account.String()
+}
+
+// sign sets "$binary", "$hash" and "signature" of the object to the binary form of the block or vote signed by the
+// key.
+func sign(object map[string]any, content encoding.BinaryMarshaler, privateKey ed25519.PrivateKey) map[string]any {
+	data, err := content.MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+	hash := sha3.Sum256(data)
+	object["$binary"] = base64.StdEncoding.EncodeToString(data)
+	object["$hash"] = strings.ToUpper(hex.EncodeToString(hash[:]))
+	object["signature"] = hex.EncodeToString(ed25519.Sign(privateKey, hash[:]))
+	return object
+}
+
+// signedBlock returns the block of the account with the operations signed by the key of the signer.
+func signedBlock(
+	date time.Time, account, signer string, signerKey ed25519.PrivateKey, operations ...keeta.Operation,
+) map[string]any {
+	block := map[string]any{"date": date.Format(time.RFC3339Nano), "account": account, "signer": signer}
+	rawOperations := []any{}
+	for _, operation := range operations {
+		rawOperation := map[string]any{"type": operation.Type}
+		for key, value := range map[string]string{
+			"to": operation.To, "token": operation.Token, "extra": operation.External, "name": operation.Name,
+			"description": operation.Description, "identifier": operation.Identifier,
+		} {
+			if value != "" {
+				rawOperation[key] = value
+			}
+		}
+		if operation.Amount != nil {
+			rawOperation["amount"] = "0x" + operation.Amount.Text(16)
+		}
+		rawOperations = append(rawOperations, rawOperation)
+	}
+	block["operations"] = rawOperations
+	return sign(block, keeta.Block{Date: date, Account: account, Signer: signer, Operations: operations}, signerKey)
+}
+
+// signedVote returns the vote of the representative on the blocks signed by their key.
+func signedVote(representative string, representativeKey ed25519.PrivateKey, blockHashes ...string) map[string]any {
+	blocks := []any{}
+	for _, blockHash := range blockHashes {
+		blocks = append(blocks, blockHash)
+	}
+	return sign(
+		map[string]any{"issuer": representative, "blocks": blocks},
+		keeta.Vote{Issuer: representative, Blocks: blockHashes},
+		representativeKey,
+	)
+}
+
+func TestVerifyStaple(t *testing.T) {
+	signerKey, signer := testKey("signer")
+	representativeKey, representative := testKey("representative")
+	strangerKey, stranger := testKey("stranger")
+
+	cfg := config.Default()
+	cfg.Indexer.Representatives = []string{representative}
+	ix, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := time.Date(2025, 12, 3, 10, 0, 0, 123_000_000, time.UTC)
+	newStaple := func() (map[string]any, []map[string]any) {
+		blocks := []map[string]any{
+			signedBlock(
+				date, signer, signer, signerKey, keeta.Operation{Type: OperationTypeCreateIdentifier, Identifier: tokenA},
+			),
+			signedBlock(date, tokenA, signer, signerKey, keeta.Operation{
+				Type: OperationTypeSend, To: stranger, Token: tokenA, Amount: big.NewInt(1), External: "transfer",
+			}),
+		}
+		delete(blocks[0], "signer")
+		vote := signedVote(representative, representativeKey, blocks[0]["$hash"].(string), blocks[1]["$hash"].(string))
+		vote["blocks"].([]any)[1] = strings.ToLower(blocks[1]["$hash"].(string))
+		return map[string]any{"blocks": []any{blocks[0], blocks[1]}, "votes": []any{vote}}, blocks
+	}
+
+	voteStaple, _ := newStaple()
+	if err := ix.verifyStaple(voteStaple); err != nil {
+		t.Fatalf("valid vote staple: %v", err)
+	}
+
+	for name, test := range map[string]struct {
+		tamper func(voteStaple map[string]any, blocks []map[string]any, vote map[string]any)
+		want   string
+	}{
+		"block hash mismatch": {
+			tamper: func(_ map[string]any, blocks []map[string]any, _ map[string]any) {
+				blocks[1]["$binary"] = blocks[0]["$binary"]
+			},
+			want: "hash mismatch",
+		},
+		"signed block with other operations": {
+			tamper: func(_ map[string]any, blocks []map[string]any, _ map[string]any) {
+				blocks[1]["operations"].([]any)[0].(map[string]any)["to"] = stranger + "x"
+			},
+			want: "operation 0 differs from the signed block",
+		},
+		"signed block with another amount": {
+			tamper: func(_ map[string]any, blocks []map[string]any, _ map[string]any) {
+				blocks[1]["operations"].([]any)[0].(map[string]any)["amount"] = "0x2"
+			},
+			want: "operation 0 differs from the signed block",
+		},
+		"signed block with an operation added": {
+			tamper: func(_ map[string]any, blocks []map[string]any, _ map[string]any) {
+				blocks[1]["operations"] = append(blocks[1]["operations"].([]any), map[string]any{"type": 2})
+			},
+			want: "has 2 operations",
+		},
+		"signed block of another account": {
+			tamper: func(_ map[string]any, blocks []map[string]any, _ map[string]any) {
+				blocks[1]["account"] = tokenB
+			},
+			want: "differs from the signed block",
+		},
+		"signed vote on other blocks": {
+			tamper: func(_ map[string]any, blocks []map[string]any, vote map[string]any) {
+				vote["blocks"] = []any{blocks[0]["$hash"], blocks[1]["$hash"], "B3"}
+			},
+			want: "differs from the signed vote",
+		},
+		"vote hash mismatch": {
+			tamper: func(_ map[string]any, _ []map[string]any, vote map[string]any) {
+				vote["$hash"] = strings.Repeat("0", 64)
+			},
+			want: "hash mismatch",
+		},
+		"block signed by another key": {
+			tamper: func(_ map[string]any, blocks []map[string]any, _ map[string]any) {
+				sign(blocks[0], keeta.Block{Date: date, Account: signer, Signer: signer}, strangerKey)
+			},
+			want: "invalid signature",
+		},
+		"malformed vote signature": {
+			tamper: func(_ map[string]any, _ []map[string]any, vote map[string]any) {
+				vote["signature"] = "not hex"
+			},
+			want: "malformed signature",
+		},
+		"block missing from the votes": {
+			tamper: func(_ map[string]any, blocks []map[string]any, vote map[string]any) {
+				maps.Copy(vote, signedVote(representative, representativeKey, blocks[0]["$hash"].(string)))
+			},
+			want: "does not cover block",
+		},
+		"vote of an unknown issuer": {
+			tamper: func(_ map[string]any, blocks []map[string]any, vote map[string]any) {
+				maps.Copy(vote, signedVote(stranger, strangerKey, blocks[0]["$hash"].(string), blocks[1]["$hash"].(string)))
+			},
+			want: "not a trusted representative",
+		},
+		"no votes": {
+			tamper: func(voteStaple map[string]any, _ []map[string]any, _ map[string]any) {
+				voteStaple["votes"] = []any{}
+			},
+			want: "no votes",
+		},
+	} {
+		voteStaple, blocks := newStaple()
+		test.tamper(voteStaple, blocks, voteStaple["votes"].([]any)[0].(map[string]any))
+		if err := ix.verifyStaple(voteStaple); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%v: error %v, want %q", name, err, test.want)
+		}
+	}
+}
+
+func TestIsFinal(t *testing.T) {
+	cfg := config.Default()
+	cfg.Indexer.Representatives = devnet.Representatives
+	cfg.Resolve()
+	ix, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, stranger := testKey("stranger")
+	block := map[string]any{"$hash": "B1"}
+
+	for name, test := range map[string]struct {
+		votes func() []any
+		want  bool
+	}{
+		"all representatives": {votes: func() []any { return devnet.Votes(3, "B1") }, want: true},
+		"a majority":          {votes: func() []any { return devnet.Votes(2, "B1") }, want: true},
+		"one representative":  {votes: func() []any { return devnet.Votes(1, "B1") }, want: false},
+		"the same vote twice": {
+			votes: func() []any { return append(devnet.Votes(1, "B1"), devnet.Votes(1, "B1")...) },
+		},
+		"votes on other blocks": {votes: func() []any { return devnet.Votes(3, "B2") }},
+		"votes on other blocks claiming the block": {
+			votes: func() []any {
+				votes := devnet.Votes(3, "B2")
+				for _, vote := range votes {
+					vote.(map[string]any)["blocks"] = []any{"B1"}
+				}
+				return votes
+			},
+		},
+		"a tampered signature": {
+			votes: func() []any {
+				votes := devnet.Votes(2, "B1")
+				votes[1].(map[string]any)["signature"] = votes[0].(map[string]any)["signature"]
+				return votes
+			},
+		},
+		"permanent votes of an unknown issuer": {
+			votes: func() []any {
+				return []any{
+					map[string]any{"$permanent": true, "issuer": stranger},
+					map[string]any{"permanent": true, "issuer": stranger},
+				}
+			},
+		},
+		"a claimed issuer": {
+			votes: func() []any {
+				votes := devnet.Votes(2, "B1")
+				votes[1].(map[string]any)["issuer"] = devnet.Representatives[2]
+				return votes
+			},
+		},
+	} {
+		voteStaple := map[string]any{"blocks": []any{block}, "votes": test.votes()}
+		if got := ix.IsFinal(voteStaple); got != test.want {
+			t.Errorf("%v: final %v, want %v", name, got, test.want)
+		}
+	}
+}
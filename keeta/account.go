@@ -0,0 +1,81 @@
+package keeta
+
+import (
+	"bytes"
+	"crypto/sha3"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type KeyAlgorithm byte
+
+const (
+	KeyAlgorithmECDSASecp256k1 KeyAlgorithm = 0
+	KeyAlgorithmED25519        KeyAlgorithm = 1
+	KeyAlgorithmNetwork        KeyAlgorithm = 2
+	KeyAlgorithmToken          KeyAlgorithm = 3
+	KeyAlgorithmStorage        KeyAlgorithm = 4
+	KeyAlgorithmECDSASecp256r1 KeyAlgorithm = 6
+)
+
+const (
+	AddressPrefix  = "keeta_"
+	checksumLength = 5
+)
+
+var (
+	ErrInvalidAddress  = errors.New("invalid keeta address")
+	ErrInvalidChecksum = errors.New("invalid keeta address checksum")
+
+	encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+// Account is a Keeta account decoded from its address: the key algorithm followed by the public key, or by the
+// identifier for token, network and storage accounts.
+type Account struct {
+	Algorithm KeyAlgorithm
+	PublicKey []byte
+}
+
+// ParseAccount decodes "keeta_" followed by base32 of the algorithm byte, the public key and the first 5 bytes of
+// SHA3-256 of both as checksum.
+func ParseAccount(address string) (Account, error) {
+	encoded, ok := strings.CutPrefix(address, AddressPrefix)
+	if !ok {
+		return Account{}, ErrInvalidAddress
+	}
+
+	raw, err := encoding.DecodeString(strings.ToUpper(encoded))
+	if err != nil || len(raw) < 1+checksumLength+1 {
+		return Account{}, ErrInvalidAddress
+	}
+
+	body, checksum := raw[:len(raw)-checksumLength], raw[len(raw)-checksumLength:]
+	if expected := sha3.Sum256(body); !bytes.Equal(expected[:checksumLength], checksum) {
+		return Account{}, ErrInvalidChecksum
+	}
+
+	account := Account{Algorithm: KeyAlgorithm(body[0]), PublicKey: body[1:]}
+	if expected := account.Algorithm.keyLength(); expected != 0 && len(account.PublicKey) != expected {
+		return Account{}, fmt.Errorf("%w: key length %d for algorithm %d", ErrInvalidAddress, len(account.PublicKey), account.Algorithm)
+	}
+	return account, nil
+}
+
+func (a Account) String() string {
+	body := append([]byte{byte(a.Algorithm)}, a.PublicKey...)
+	checksum := sha3.Sum256(body)
+	return AddressPrefix + strings.ToLower(encoding.EncodeToString(append(body, checksum[:checksumLength]...)))
+}
+
+func (k KeyAlgorithm) keyLength() int {
+	switch k {
+	case KeyAlgorithmED25519, KeyAlgorithmNetwork, KeyAlgorithmToken, KeyAlgorithmStorage:
+		return 32
+	case KeyAlgorithmECDSASecp256k1, KeyAlgorithmECDSASecp256r1:
+		return 33
+	}
+	return 0
+}
@@ -0,0 +1,57 @@
+package keeta
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestParseAccount(t *testing.T) {
+	for _, test := range []struct {
+		address   string
+		algorithm KeyAlgorithm
+		publicKey string
+	}{
+		// the burn address, the ed25519 account of the all-zero key
+		{
+			"keeta_aeaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaazpi2nodu",
+			KeyAlgorithmED25519, "0000000000000000000000000000000000000000000000000000000000000000",
+		},
+		{
+			"keeta_anqdilpazdekdu4acw65fj7smltcp26wbrildkqtszqvverljpwpezmd44ssg",
+			KeyAlgorithmToken, "60342de0c8c8a1d38015bdd2a7f262e627ebd60c50b1aa1396615a922b4becf2",
+		},
+	} {
+		account, err := ParseAccount(test.address)
+		if err != nil {
+			t.Errorf("%v: %v", test.address, err)
+			continue
+		}
+		publicKey, _ := hex.DecodeString(test.publicKey)
+		if account.Algorithm != test.algorithm || !bytes.Equal(account.PublicKey, publicKey) {
+			t.Errorf("%v is %d %x, want %d %v", test.address, account.Algorithm, account.PublicKey, test.algorithm, test.publicKey)
+		}
+		if got := account.String(); got != test.address {
+			t.Errorf("%v formats as %v", test.address, got)
+		}
+	}
+}
+
+func TestParseAccountErrors(t *testing.T) {
+	for address, want := range map[string]error{
+		// the last checksum character of the burn address changed
+		"keeta_aeaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaazpi2noda": ErrInvalidChecksum,
+		// a key byte of the burn address changed
+		"keeta_aeaaaaaaaaaaaaaaaaaaaaaaaaaaaaaabaaaaaaaaaaaaaaaaaaaazpi2nodu": ErrInvalidChecksum,
+		"aeaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaazpi2nodu":       ErrInvalidAddress,
+		"keeta_aeaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaazpi2nod1": ErrInvalidAddress,
+		"keeta_aaaa": ErrInvalidAddress,
+		// a valid checksum over an ed25519 key one byte short
+		Account{Algorithm: KeyAlgorithmED25519, PublicKey: make([]byte, 31)}.String(): ErrInvalidAddress,
+	} {
+		if _, err := ParseAccount(address); !errors.Is(err, want) {
+			t.Errorf("%v: error %v, want %v", address, err, want)
+		}
+	}
+}
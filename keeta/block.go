@@ -0,0 +1,145 @@
+package keeta
+
+import (
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// dateLayout is GeneralizedTime in UTC with the fraction of a second, which encoding/asn1 does not write.
+const dateLayout = "20060102150405.999999999Z"
+
+var ErrMalformedBinary = errors.New("malformed binary")
+
+// Block is the content of a block its binary form holds, the data its hash and signature cover.
+type Block struct {
+	Date       time.Time
+	Account    string
+	Signer     string
+	Operations []Operation
+}
+
+// Operation is an operation of a block, the fields that do not apply to its type are empty.
+type Operation struct {
+	Type        int
+	To          string
+	Token       string
+	Amount      *big.Int
+	External    string
+	Name        string
+	Description string
+	Identifier  string
+}
+
+// Vote is the content of a vote its binary form holds: the representative issuing it and the hashes of the blocks it
+// votes for.
+type Vote struct {
+	Issuer string
+	Blocks []string
+}
+
+type blockASN1 struct {
+	Date       asn1.RawValue
+	Account    string `asn1:"utf8"`
+	Signer     string `asn1:"utf8"`
+	Operations []operationASN1
+}
+
+type operationASN1 struct {
+	Type        int
+	To          string `asn1:"utf8"`
+	Token       string `asn1:"utf8"`
+	Amount      *big.Int
+	External    string `asn1:"utf8"`
+	Name        string `asn1:"utf8"`
+	Description string `asn1:"utf8"`
+	Identifier  string `asn1:"utf8"`
+}
+
+type voteASN1 struct {
+	Issuer string `asn1:"utf8"`
+	// encoding/asn1 writes strings that are not printable as UTF8String, the tag does not apply to lists
+	Blocks []string
+}
+
+// MarshalBinary encodes the block as DER, a missing amount as zero.
+func (b Block) MarshalBinary() ([]byte, error) {
+	block := blockASN1{
+		Date: asn1.RawValue{
+			Class: asn1.ClassUniversal, Tag: asn1.TagGeneralizedTime, Bytes: []byte(b.Date.UTC().Format(dateLayout)),
+		},
+		Account:    b.Account,
+		Signer:     b.Signer,
+		Operations: []operationASN1{},
+	}
+	for _, operation := range b.Operations {
+		amount := operation.Amount
+		if amount == nil {
+			amount = new(big.Int)
+		}
+		block.Operations = append(block.Operations, operationASN1{
+			Type:        operation.Type,
+			To:          operation.To,
+			Token:       operation.Token,
+			Amount:      amount,
+			External:    operation.External,
+			Name:        operation.Name,
+			Description: operation.Description,
+			Identifier:  operation.Identifier,
+		})
+	}
+	return asn1.Marshal(block)
+}
+
+// ParseBlock decodes the DER binary form of a block.
+func ParseBlock(data []byte) (Block, error) {
+	var raw blockASN1
+	if err := unmarshal(data, &raw); err != nil {
+		return Block{}, err
+	}
+	if raw.Date.Class != asn1.ClassUniversal || raw.Date.Tag != asn1.TagGeneralizedTime {
+		return Block{}, fmt.Errorf("%w: date is not GeneralizedTime", ErrMalformedBinary)
+	}
+	date, err := time.Parse(dateLayout, string(raw.Date.Bytes))
+	if err != nil {
+		return Block{}, fmt.Errorf("%w: date: %w", ErrMalformedBinary, err)
+	}
+
+	block := Block{Date: date, Account: raw.Account, Signer: raw.Signer}
+	for _, operation := range raw.Operations {
+		block.Operations = append(block.Operations, Operation(operation))
+	}
+	return block, nil
+}
+
+// MarshalBinary encodes the vote as DER.
+func (v Vote) MarshalBinary() ([]byte, error) {
+	blocks := v.Blocks
+	if blocks == nil {
+		blocks = []string{}
+	}
+	return asn1.Marshal(voteASN1{Issuer: v.Issuer, Blocks: blocks})
+}
+
+// ParseVote decodes the DER binary form of a vote.
+func ParseVote(data []byte) (Vote, error) {
+	var raw voteASN1
+	if err := unmarshal(data, &raw); err != nil {
+		return Vote{}, err
+	}
+	return Vote(raw), nil
+}
+
+// unmarshal decodes data into v, rejecting trailing data.
+func unmarshal(data []byte, v any) error {
+	rest, err := asn1.Unmarshal(data, v)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrMalformedBinary, err)
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrMalformedBinary, len(rest))
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package keeta
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBlockBinary(t *testing.T) {
+	block := Block{
+		Date:    time.Date(2025, 12, 3, 10, 0, 0, 123_000_000, time.UTC),
+		Account: "keeta_account",
+		Signer:  "keeta_signer",
+		Operations: []Operation{
+			{Type: 4, Identifier: "keeta_token", Amount: new(big.Int)},
+			{Type: 0, To: "keeta_burn", Token: "keeta_token", Amount: big.NewInt(1), External: "transfer"},
+		},
+	}
+	data, err := block.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseBlock(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// amounts only compare by value, so the parsed block has to encode to the same binary
+	reencoded, err := parsed.MarshalBinary()
+	if err != nil || !bytes.Equal(reencoded, data) || !parsed.Date.Equal(block.Date) {
+		t.Errorf("parsed %+v, want %+v", parsed, block)
+	}
+
+	if _, err = ParseBlock(append(data, 0)); !errors.Is(err, ErrMalformedBinary) {
+		t.Errorf("trailing data error %v, want ErrMalformedBinary", err)
+	}
+	if _, err = ParseBlock(data[:len(data)-1]); !errors.Is(err, ErrMalformedBinary) {
+		t.Errorf("truncated block error %v, want ErrMalformedBinary", err)
+	}
+}
+
+func TestVoteBinary(t *testing.T) {
+	vote := Vote{Issuer: "keeta_representative", Blocks: []string{"A001", "A002"}}
+	data, err := vote.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseVote(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, vote) {
+		t.Errorf("parsed %+v, want %+v", parsed, vote)
+	}
+
+	// a block is not a vote
+	data, err = Block{Date: time.Now()}.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ParseVote(data); !errors.Is(err, ErrMalformedBinary) {
+		t.Errorf("block parsed as vote, error %v", err)
+	}
+}
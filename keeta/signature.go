@@ -0,0 +1,53 @@
+package keeta
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secp256k1ecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// Verify checks the signature of the hash by the account key. ECDSA signatures are the 64 bytes of r and s.
+func (a Account) Verify(hash, signature []byte) error {
+	switch a.Algorithm {
+	case KeyAlgorithmED25519:
+		if len(signature) != ed25519.SignatureSize || !ed25519.Verify(a.PublicKey, hash, signature) {
+			return ErrInvalidSignature
+		}
+	case KeyAlgorithmECDSASecp256k1:
+		publicKey, err := secp256k1.ParsePubKey(a.PublicKey)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+		}
+		if len(signature) != 64 {
+			return ErrInvalidSignature
+		}
+		var r, s secp256k1.ModNScalar
+		if r.SetByteSlice(signature[:32]) || s.SetByteSlice(signature[32:]) {
+			return ErrInvalidSignature
+		}
+		if !secp256k1ecdsa.NewSignature(&r, &s).Verify(hash, publicKey) {
+			return ErrInvalidSignature
+		}
+	case KeyAlgorithmECDSASecp256r1:
+		x, y := elliptic.UnmarshalCompressed(elliptic.P256(), a.PublicKey)
+		if x == nil || len(signature) != 64 {
+			return ErrInvalidSignature
+		}
+		publicKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(publicKey, hash, r, s) {
+			return ErrInvalidSignature
+		}
+	default:
+		return fmt.Errorf("%w: account algorithm %d cannot sign", ErrInvalidSignature, a.Algorithm)
+	}
+	return nil
+}
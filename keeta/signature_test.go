@@ -0,0 +1,85 @@
+package keeta
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secp256k1ecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+func mustDecode(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// verifyVector checks that the signature verifies and that it no longer does once a bit of it or of the hash flips.
+func verifyVector(t *testing.T, account Account, hash, signature []byte) {
+	t.Helper()
+
+	if err := account.Verify(hash, signature); err != nil {
+		t.Fatalf("valid signature: %v", err)
+	}
+
+	tampered := append([]byte(nil), signature...)
+	tampered[len(tampered)-1] ^= 1
+	if err := account.Verify(hash, tampered); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered signature error %v, want ErrInvalidSignature", err)
+	}
+	otherHash := sha256.Sum256(append([]byte("other "), hash...))
+	if err := account.Verify(otherHash[:], signature); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("signature of another hash error %v, want ErrInvalidSignature", err)
+	}
+	if err := account.Verify(hash, signature[:len(signature)-1]); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("truncated signature error %v, want ErrInvalidSignature", err)
+	}
+}
+
+// TestVerifyED25519 checks test 2 of RFC 8032 section 7.1.
+func TestVerifyED25519(t *testing.T) {
+	account := Account{
+		Algorithm: KeyAlgorithmED25519,
+		PublicKey: mustDecode(t, "3d4017c3e843895a92b70aa74d1b7ebc9c982ccf2ec4968cc0cd55f12af4660c"),
+	}
+	signature := mustDecode(t, "92a009a9f0d4cab8720e820b5f642540a2b27b5416503f8fb3762223ebdb69da"+
+		"085ac1e43e15996e458f3613d0f11d8c387b2eaeb4302aeeb00d291612bb0c00")
+	verifyVector(t, account, []byte{0x72}, signature)
+}
+
+// TestVerifySecp256r1 checks the P-256 SHA-256 "sample" signature of RFC 6979 appendix A.2.5.
+func TestVerifySecp256r1(t *testing.T) {
+	account := Account{
+		Algorithm: KeyAlgorithmECDSASecp256r1,
+		PublicKey: mustDecode(t, "0360fed4ba255a9d31c961eb74c6356d68c049b8923b61fa6ce669622e60f29fb6"),
+	}
+	hash := sha256.Sum256([]byte("sample"))
+	signature := mustDecode(t, "efd48b2aacb6a8fd1140dd9cd45e81d69d2c877b56aaf991c34d0ea84eaf3716"+
+		"f7cb1c942d657c41d436c7a1b6e29f65f3e900dbb9aff4064dc4ab2f843acda8")
+	verifyVector(t, account, hash[:], signature)
+}
+
+func TestVerifySecp256k1(t *testing.T) {
+	privateKey := secp256k1.PrivKeyFromBytes(mustDecode(t, "c9afa9d845ba75166b5c215767b1d6934e50c3db36e89b127b8a622b120f6721"))
+	account := Account{Algorithm: KeyAlgorithmECDSASecp256k1, PublicKey: privateKey.PubKey().SerializeCompressed()}
+
+	hash := sha256.Sum256([]byte("sample"))
+	sig := secp256k1ecdsa.Sign(privateKey, hash[:])
+	r, s := sig.R(), sig.S()
+	var signature [64]byte
+	r.PutBytesUnchecked(signature[:32])
+	s.PutBytesUnchecked(signature[32:])
+	verifyVector(t, account, hash[:], signature[:])
+}
+
+func TestVerifyNonSigningAccount(t *testing.T) {
+	account := Account{Algorithm: KeyAlgorithmToken, PublicKey: make([]byte, 32)}
+	if err := account.Verify(make([]byte, 32), make([]byte, 64)); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("token account signature error %v, want ErrInvalidSignature", err)
+	}
+}
@@ -0,0 +1,133 @@
+package kns
+
+import (
+	"kns-indexer/indexer"
+	"kns-indexer/store"
+	"time"
+)
+
+// Event is what every KNS event carries.
+type Event struct {
+	Username string
+	// Token is the address of the username token.
+	Token     string
+	BlockHash string
+	// Position is the index of the operation in the block.
+	Position  int
+	Timestamp time.Time
+}
+
+type NameInscribed struct {
+	Event
+	Owner string
+	// Display is the name as inscribed when it differs from the normalized Username.
+	Display string
+}
+
+type NameTransferred struct {
+	Event
+	From string
+	To   string
+}
+
+type CIDSet struct {
+	Event
+	Owner string
+	CID   string
+}
+
+type PrimarySet struct {
+	Event
+	Owner string
+}
+
+type RecordSet struct {
+	Event
+	Owner string
+	Key   string
+	Value string
+}
+
+type AddressSet struct {
+	Event
+	Owner   string
+	Coin    string
+	Address string
+}
+
+type PrimaryCleared struct {
+	Event
+	Owner string
+}
+
+type CIDCleared struct {
+	Event
+	Owner string
+}
+
+type RecordCleared struct {
+	Event
+	Owner string
+	Key   string
+}
+
+// SubnameAssigned is the owner of the parent name giving the subname to To.
+type SubnameAssigned struct {
+	Event
+	ParentOwner string
+	To          string
+}
+
+// dispatch passes the committed action to its callback.
+func (i *Indexer) dispatch(action store.Action) {
+	event := Event{
+		Username:  action.Username,
+		Token:     action.Token,
+		BlockHash: action.BlockHash,
+		Position:  action.Position,
+		Timestamp: action.Timestamp,
+	}
+
+	switch action.Type {
+	case indexer.ActionInscribe:
+		if i.cfg.OnNameInscribed != nil {
+			i.cfg.OnNameInscribed(NameInscribed{Event: event, Owner: action.Owner, Display: action.Value})
+		}
+	case indexer.ActionTransfer:
+		if i.cfg.OnNameTransferred != nil {
+			i.cfg.OnNameTransferred(NameTransferred{Event: event, From: action.Account, To: action.Owner})
+		}
+	case indexer.ActionSetCid:
+		if i.cfg.OnCIDSet != nil {
+			i.cfg.OnCIDSet(CIDSet{Event: event, Owner: action.Account, CID: action.CID})
+		}
+	case indexer.ActionSetPrimaryName:
+		if i.cfg.OnPrimarySet != nil {
+			i.cfg.OnPrimarySet(PrimarySet{Event: event, Owner: action.Account})
+		}
+	case indexer.ActionSetRecord:
+		if i.cfg.OnRecordSet != nil {
+			i.cfg.OnRecordSet(RecordSet{Event: event, Owner: action.Account, Key: action.Key, Value: action.Value})
+		}
+	case indexer.ActionSetAddress:
+		if i.cfg.OnAddressSet != nil {
+			i.cfg.OnAddressSet(AddressSet{Event: event, Owner: action.Account, Coin: action.Key, Address: action.Value})
+		}
+	case indexer.ActionClearPrimaryName:
+		if i.cfg.OnPrimaryCleared != nil {
+			i.cfg.OnPrimaryCleared(PrimaryCleared{Event: event, Owner: action.Account})
+		}
+	case indexer.ActionClearCid:
+		if i.cfg.OnCIDCleared != nil {
+			i.cfg.OnCIDCleared(CIDCleared{Event: event, Owner: action.Account})
+		}
+	case indexer.ActionClearRecord:
+		if i.cfg.OnRecordCleared != nil {
+			i.cfg.OnRecordCleared(RecordCleared{Event: event, Owner: action.Account, Key: action.Key})
+		}
+	case indexer.ActionAssignSubname:
+		if i.cfg.OnSubnameAssigned != nil {
+			i.cfg.OnSubnameAssigned(SubnameAssigned{Event: event, ParentOwner: action.Account, To: action.Owner})
+		}
+	}
+}
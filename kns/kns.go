@@ -0,0 +1,155 @@
+// Package kns embeds the KNS indexer in other Go programs, passing the committed KNS events to callbacks.
+package kns
+
+import (
+	"context"
+	"errors"
+	"kns-indexer/config"
+	"kns-indexer/indexer"
+	"kns-indexer/models"
+	"kns-indexer/store"
+	"sync"
+)
+
+var ErrStarted = errors.New("indexer already started")
+
+// Config configures an embedded indexer.
+type Config struct {
+	config.Config
+
+	// Store keeps the index instead of the store DatabaseURL points to. Stop does not close it.
+	Store store.Store
+
+	// The callbacks are called once the event is committed, in commit order and on the goroutine running the
+	// indexer, so a slow callback holds the indexer up.
+	OnNameInscribed   func(NameInscribed)
+	OnNameTransferred func(NameTransferred)
+	OnCIDSet          func(CIDSet)
+	OnPrimarySet      func(PrimarySet)
+	OnRecordSet       func(RecordSet)
+	OnAddressSet      func(AddressSet)
+	OnPrimaryCleared  func(PrimaryCleared)
+	OnCIDCleared      func(CIDCleared)
+	OnRecordCleared   func(RecordCleared)
+	OnSubnameAssigned func(SubnameAssigned)
+}
+
+// DefaultConfig returns the defaults of the kns-indexer command with an in-memory store. The Keeta and Keetools base
+// URLs and the trusted representatives still have to be set.
+func DefaultConfig() Config {
+	cfg := Config{Config: config.Default()}
+	cfg.DatabaseURL = "memory://"
+	return cfg
+}
+
+// Indexer is an embedded indexer.
+type Indexer struct {
+	cfg     Config
+	indexer *indexer.Indexer
+
+	// lifecycle serializes Start and Stop, mu guards the fields, so callbacks can read them while Stop waits for the
+	// indexer
+	lifecycle   sync.Mutex
+	mu          sync.Mutex
+	db          store.Store
+	cancel      context.CancelFunc
+	done        chan struct{}
+	unsubscribe func()
+}
+
+// New returns an indexer with the validated configuration.
+func New(cfg Config) (*Indexer, error) {
+	cfg.Resolve()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	ix, err := indexer.New(cfg.Config)
+	if err != nil {
+		return nil, err
+	}
+	return &Indexer{cfg: cfg, indexer: ix}, nil
+}
+
+// Start opens and migrates the store and indexes in the background until Stop is called or the context is done. On
+// PostgreSQL it only indexes while it holds the leadership among the replicas sharing the database.
+func (i *Indexer) Start(ctx context.Context) error {
+	i.lifecycle.Lock()
+	defer i.lifecycle.Unlock()
+
+	if i.Store() != nil {
+		return ErrStarted
+	}
+
+	db := i.cfg.Store
+	if db == nil {
+		var err error
+		if db, err = store.Open(ctx, i.cfg.DatabaseURL); err != nil {
+			return err
+		}
+	}
+	if err := db.Migrate(ctx); err != nil {
+		if i.cfg.Store == nil {
+			db.Close()
+		}
+		return err
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	i.mu.Lock()
+	i.db, i.cancel, i.done = db, cancel, done
+	i.unsubscribe = i.indexer.Subscribe(i.dispatch)
+	i.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		if pg, ok := db.(*store.Postgres); ok {
+			i.indexer.Lead(runCtx, pg)
+		} else {
+			i.indexer.Supervise(runCtx, db)
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops indexing, waiting for the batch in progress, and closes the store Start opened. Callbacks must not call
+// Start or Stop.
+func (i *Indexer) Stop() {
+	i.lifecycle.Lock()
+	defer i.lifecycle.Unlock()
+
+	i.mu.Lock()
+	db, cancel, done, unsubscribe := i.db, i.cancel, i.done, i.unsubscribe
+	i.mu.Unlock()
+	if done == nil {
+		return
+	}
+
+	cancel()
+	<-done
+	unsubscribe()
+	i.mu.Lock()
+	i.db, i.cancel, i.done, i.unsubscribe = nil, nil, nil, nil
+	i.mu.Unlock()
+	if i.cfg.Store == nil {
+		db.Close()
+	}
+}
+
+// Store returns the store of the started indexer to read the index from, nil before Start.
+func (i *Indexer) Store() store.Store {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.db
+}
+
+// Status returns the sync state of the indexer.
+func (i *Indexer) Status() models.Status {
+	return i.indexer.Status()
+}
+
+// Ready reports whether the indexer has fewer than the maximum failed runs in a row.
+func (i *Indexer) Ready() bool {
+	return i.indexer.Ready()
+}
@@ -0,0 +1,146 @@
+package kns
+
+import (
+	"context"
+	"errors"
+	"kns-indexer/devnet"
+	"kns-indexer/testutil"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIndexer(t *testing.T) {
+	ledger := testutil.NewScenario(time.Date(2025, 12, 3, 0, 0, 0, 0, time.UTC))
+	inscription := ledger.Inscribe("keeta_alice", "keeta_token", "alice")
+	ledger.Transfer("keeta_alice", "keeta_token", devnet.BurnAddress)
+	server := testutil.NewServer(t, ledger.History()...)
+
+	events := make(chan any, 10)
+	cfg := DefaultConfig()
+	cfg.Keeta.BaseURL, cfg.Keeta.KeetoolsBaseURL = server.URL, server.URL
+	cfg.Indexer.Representatives = devnet.Representatives
+	cfg.Indexer.PollInterval = 5 * time.Millisecond
+	cfg.OnNameInscribed = func(e NameInscribed) { events <- e }
+	cfg.OnNameTransferred = func(e NameTransferred) { events <- e }
+
+	i, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = i.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer i.Stop()
+
+	if err = i.Start(context.Background()); !errors.Is(err, ErrStarted) {
+		t.Errorf("second start error %v, want ErrStarted", err)
+	}
+
+	otherEvents := make(chan any, 10)
+	otherCfg := cfg
+	otherCfg.OnNameInscribed = func(e NameInscribed) { otherEvents <- e }
+	otherCfg.OnNameTransferred = func(e NameTransferred) { otherEvents <- e }
+	other, err := New(otherCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = other.Start(context.Background()); err != nil {
+		t.Fatalf("start of another indexer: %v", err)
+	}
+	defer other.Stop()
+
+	var got []any
+	for len(got) < 2 {
+		select {
+		case event := <-events:
+			got = append(got, event)
+		case <-time.After(10 * time.Second):
+			t.Fatalf("events %+v, want inscription and transfer", got)
+		}
+	}
+
+	want := NameInscribed{
+		Event: Event{
+			Username: "alice", Token: "keeta_token", BlockHash: inscription,
+			Timestamp: time.Date(2025, 12, 3, 0, 1, 0, 0, time.UTC),
+		},
+		Owner: "keeta_alice",
+	}
+	if !reflect.DeepEqual(got[0], want) {
+		t.Errorf("event %+v, want %+v", got[0], want)
+	}
+	if transferred, ok := got[1].(NameTransferred); !ok || transferred.From != "keeta_alice" || transferred.To != devnet.BurnAddress {
+		t.Errorf("event %+v, want alice transferred to the burn address", got[1])
+	}
+
+	if status := i.Status(); status.LastBlockHash == nil {
+		t.Errorf("status %+v, want the last block", status)
+	}
+	if u, err := i.Store().Username(context.Background(), "alice"); err != nil || u.Owner != devnet.BurnAddress {
+		t.Errorf("alice %+v %v, want owned by the burn address", u, err)
+	}
+
+	for range 2 {
+		select {
+		case <-otherEvents:
+		case <-time.After(10 * time.Second):
+			t.Fatal("the other indexer did not index the history")
+		}
+	}
+
+	i.Stop()
+	if err = i.Start(context.Background()); err != nil {
+		t.Fatalf("start after stop: %v", err)
+	}
+	i.Stop()
+}
+
+func TestStopWhileCallbackReadsStore(t *testing.T) {
+	ledger := testutil.NewScenario(time.Date(2025, 12, 3, 0, 0, 0, 0, time.UTC))
+	ledger.Inscribe("keeta_alice", "keeta_token", "alice")
+	server := testutil.NewServer(t, ledger.History()...)
+
+	called, stopping := make(chan struct{}), make(chan struct{})
+	cfg := DefaultConfig()
+	cfg.Keeta.BaseURL, cfg.Keeta.KeetoolsBaseURL = server.URL, server.URL
+	cfg.Indexer.Representatives = devnet.Representatives
+	cfg.Indexer.PollInterval = 5 * time.Millisecond
+
+	var i *Indexer
+	cfg.OnNameInscribed = func(NameInscribed) {
+		close(called)
+		<-stopping
+		// let Stop wait for the indexer before reading the store
+		time.Sleep(50 * time.Millisecond)
+		if i.Store() == nil {
+			t.Error("store gone while the indexer is stopping")
+		}
+	}
+
+	i, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = i.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-called:
+	case <-time.After(10 * time.Second):
+		t.Fatal("callback not called")
+	}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		i.Stop()
+	}()
+	close(stopping)
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop deadlocked with a callback reading the store")
+	}
+}
@@ -0,0 +1,226 @@
+package protocol
+
+import (
+	"crypto/sha256"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// Coin is a chain a username can resolve to an address on, identified by its lower case symbol and its SLIP-44
+// coin type as in ENSIP-9.
+type Coin struct {
+	Symbol string `json:"symbol"`
+	Type   uint32 `json:"type"`
+	// parse checks the address found at the offset of the input.
+	parse func(input, address string, offset int) error
+}
+
+// Coins are the coins of set_address.
+var Coins = []Coin{
+	{Symbol: "btc", Type: 0, parse: parseBitcoinAddressAt},
+	{Symbol: "eth", Type: 60, parse: parseEthereumAddressAt},
+	{Symbol: "sol", Type: 501, parse: parseSolanaAddressAt},
+}
+
+// LookupCoin returns the coin with the symbol or the decimal SLIP-44 coin type.
+func LookupCoin(coin string) (Coin, bool) {
+	for _, c := range Coins {
+		if coin == c.Symbol || coin == strconv.FormatUint(uint64(c.Type), 10) {
+			return c, true
+		}
+	}
+	return Coin{}, false
+}
+
+// ParseCoinAddress checks that the address is a valid address of the coin given by symbol.
+func ParseCoinAddress(coin, address string) error {
+	if err := parseCoinAt(coin, coin, 0); err != nil {
+		return err
+	}
+	c, _ := LookupCoin(coin)
+	return c.parse(address, address, 0)
+}
+
+// parseCoinAt checks that the coin found at the offset of the input is the symbol of one of the Coins.
+func parseCoinAt(input, coin string, offset int) error {
+	for _, c := range Coins {
+		if coin == c.Symbol {
+			return nil
+		}
+	}
+	return fail(ErrUnknownCoin, input, offset, "unknown coin %q", coin)
+}
+
+// parseCoinAddressAt checks the address found at the offset of the input against the coin before it.
+func parseCoinAddressAt(input, address string, offset int, previous []string) error {
+	c, _ := LookupCoin(previous[len(previous)-1])
+	return c.parse(input, address, offset)
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// base58Decode decodes the base58 text, returning the offset of the first invalid character if there is one.
+func base58Decode(text string) ([]byte, int) {
+	var decoded []byte
+	for i := 0; i < len(text); i++ {
+		carry := strings.IndexByte(base58Alphabet, text[i])
+		if carry < 0 {
+			return nil, i
+		}
+		for j := range decoded {
+			carry += 58 * int(decoded[j])
+			decoded[j] = byte(carry)
+			carry >>= 8
+		}
+		for ; carry > 0; carry >>= 8 {
+			decoded = append(decoded, byte(carry))
+		}
+	}
+	for i := 0; i < len(text) && text[i] == '1'; i++ {
+		decoded = append(decoded, 0)
+	}
+	for i, j := 0, len(decoded)-1; i < j; i, j = i+1, j-1 {
+		decoded[i], decoded[j] = decoded[j], decoded[i]
+	}
+	return decoded, -1
+}
+
+// parseBitcoinAddressAt checks that the address found at the offset of the input is a Bitcoin mainnet address: a
+// base58check P2PKH or P2SH address, or a bech32 segwit v0 or bech32m segwit v1+ address.
+func parseBitcoinAddressAt(input, address string, offset int) error {
+	if strings.HasPrefix(strings.ToLower(address), "bc1") {
+		return parseSegwitAddressAt(input, address, offset)
+	}
+
+	decoded, invalid := base58Decode(address)
+	if invalid >= 0 {
+		return fail(ErrInvalidCoinAddress, input, offset+invalid, "only base58 characters are allowed")
+	}
+	if len(decoded) != 25 || decoded[0] != 0x00 && decoded[0] != 0x05 {
+		return fail(ErrInvalidCoinAddress, input, offset, "not a P2PKH or P2SH address")
+	}
+	first := sha256.Sum256(decoded[:21])
+	if checksum := sha256.Sum256(first[:]); string(checksum[:4]) != string(decoded[21:]) {
+		return fail(ErrInvalidCoinAddress, input, offset, "checksum mismatch")
+	}
+	return nil
+}
+
+const (
+	bech32Charset   = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+	bech32Constant  = 1
+	bech32mConstant = 0x2bc830a3
+)
+
+func bech32Polymod(values []byte) uint32 {
+	generators := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	checksum := uint32(1)
+	for _, value := range values {
+		top := checksum >> 25
+		checksum = checksum&0x1ffffff<<5 ^ uint32(value)
+		for i, generator := range generators {
+			if top>>i&1 == 1 {
+				checksum ^= generator
+			}
+		}
+	}
+	return checksum
+}
+
+// parseSegwitAddressAt checks that the address found at the offset of the input is a bc1 segwit address as in BIP
+// 173 and BIP 350.
+func parseSegwitAddressAt(input, address string, offset int) error {
+	lower := strings.ToLower(address)
+	if address != lower && address != strings.ToUpper(address) {
+		return fail(ErrInvalidCoinAddress, input, offset, "mixed case")
+	}
+	if len(address) > 90 {
+		return fail(ErrInvalidCoinAddress, input, offset+90, "address is longer than 90")
+	}
+
+	const hrp = "bc"
+	values := []byte{hrp[0] >> 5, hrp[1] >> 5, 0, hrp[0] & 31, hrp[1] & 31}
+	for i := len(hrp) + 1; i < len(lower); i++ {
+		value := strings.IndexByte(bech32Charset, lower[i])
+		if value < 0 {
+			return fail(ErrInvalidCoinAddress, input, offset+i, "only bech32 characters are allowed")
+		}
+		values = append(values, byte(value))
+	}
+	data := values[5:]
+	if len(data) < 7 {
+		return fail(ErrInvalidCoinAddress, input, offset, "address is too short")
+	}
+
+	version, constant := data[0], uint32(bech32Constant)
+	if version > 0 {
+		constant = bech32mConstant
+	}
+	if version > 16 || bech32Polymod(values) != constant {
+		return fail(ErrInvalidCoinAddress, input, offset, "checksum mismatch")
+	}
+
+	var program []byte
+	var accumulator, bitCount uint
+	for _, value := range data[1 : len(data)-6] {
+		accumulator, bitCount = accumulator<<5|uint(value), bitCount+5
+		if bitCount >= 8 {
+			bitCount -= 8
+			program = append(program, byte(accumulator>>bitCount))
+		}
+	}
+	if bitCount >= 5 || accumulator&(1<<bitCount-1) != 0 {
+		return fail(ErrInvalidCoinAddress, input, offset, "invalid padding")
+	}
+	if len(program) < 2 || len(program) > 40 || version == 0 && len(program) != 20 && len(program) != 32 {
+		return fail(ErrInvalidCoinAddress, input, offset, "invalid witness program length %d", len(program))
+	}
+	return nil
+}
+
+// parseEthereumAddressAt checks that the address found at the offset of the input is 0x followed by 40 hex digits,
+// either in one case or with the mixed case EIP-55 checksum.
+func parseEthereumAddressAt(input, address string, offset int) error {
+	if !strings.HasPrefix(address, "0x") {
+		return fail(ErrInvalidCoinAddress, input, offset, "address does not start with 0x")
+	}
+	digits := address[2:]
+	for i := 0; i < len(digits); i++ {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", rune(digits[i])) {
+			return fail(ErrInvalidCoinAddress, input, offset+2+i, "only hex digits are allowed")
+		}
+	}
+	if len(digits) != 40 {
+		return fail(ErrInvalidCoinAddress, input, offset, "address has %d hex digits, not 40", len(digits))
+	}
+	if digits == strings.ToLower(digits) || digits == strings.ToUpper(digits) {
+		return nil
+	}
+
+	// Ethereum hashes with the original Keccak-256, which pads differently than the standardized SHA3-256
+	keccak := sha3.NewLegacyKeccak256()
+	keccak.Write([]byte(strings.ToLower(digits)))
+	hash := keccak.Sum(nil)
+	for i := 0; i < len(digits); i++ {
+		upper := hash[i/2]>>(4*(1-i%2))&0xf >= 8
+		if digits[i] >= 'a' && upper || digits[i] >= 'A' && digits[i] <= 'F' && !upper {
+			return fail(ErrInvalidCoinAddress, input, offset+2+i, "EIP-55 checksum mismatch")
+		}
+	}
+	return nil
+}
+
+// parseSolanaAddressAt checks that the address found at the offset of the input is a base58 encoded 32 byte public
+// key.
+func parseSolanaAddressAt(input, address string, offset int) error {
+	decoded, invalid := base58Decode(address)
+	if invalid >= 0 {
+		return fail(ErrInvalidCoinAddress, input, offset+invalid, "only base58 characters are allowed")
+	}
+	if len(decoded) != 32 {
+		return fail(ErrInvalidCoinAddress, input, offset, "address decodes to %d bytes, not 32", len(decoded))
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package protocol
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Command names, the first word of a memo.
+const (
+	CommandSetPrimaryName = "set_primary_name"
+	CommandSetCID         = "set_cid"
+	CommandSetRecord      = "set_record"
+	CommandSetAddress     = "set_address"
+
+	CommandClearPrimaryName = "clear_primary_name"
+	CommandClearCID         = "clear_cid"
+	CommandClearRecord      = "clear_record"
+
+	CommandAssignSubname = "assign_subname"
+)
+
+const (
+	// MaxRecordKeyLength and MaxRecordValueLength are the maximum lengths of a text record in bytes.
+	MaxRecordKeyLength   = 64
+	MaxRecordValueLength = 256
+)
+
+// Command is a command sent as the memo of a burn send. The account sending it has to own the username token.
+type Command interface {
+	// Name is the first word of the memo.
+	Name() string
+	// args returns the arguments of the memo.
+	args() []string
+}
+
+// SetPrimaryName makes the username of the token the primary name of its owner.
+type SetPrimaryName struct {
+	Token string `json:"token"`
+}
+
+func (SetPrimaryName) Name() string { return CommandSetPrimaryName }
+
+func (c SetPrimaryName) args() []string { return []string{c.Token} }
+
+// SetCID points the username of the token to the content identifier.
+type SetCID struct {
+	Token string `json:"token"`
+	CID   string `json:"cid"`
+}
+
+func (SetCID) Name() string { return CommandSetCID }
+
+func (c SetCID) args() []string { return []string{c.Token, c.CID} }
+
+// SetRecord sets a text record of the username of the token, e.g. avatar, url, description, email, twitter or github.
+type SetRecord struct {
+	Token string `json:"token"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func (SetRecord) Name() string { return CommandSetRecord }
+
+func (c SetRecord) args() []string { return []string{c.Token, c.Key, c.Value} }
+
+// SetAddress sets the address of the username of the token on another chain, the coin being one of the Coins.
+type SetAddress struct {
+	Token   string `json:"token"`
+	Coin    string `json:"coin"`
+	Address string `json:"address"`
+}
+
+func (SetAddress) Name() string { return CommandSetAddress }
+
+func (c SetAddress) args() []string { return []string{c.Token, c.Coin, c.Address} }
+
+// ClearPrimaryName unsets the username of the token as the primary name of its owner.
+type ClearPrimaryName struct {
+	Token string `json:"token"`
+}
+
+func (ClearPrimaryName) Name() string { return CommandClearPrimaryName }
+
+func (c ClearPrimaryName) args() []string { return []string{c.Token} }
+
+// ClearCID removes the content identifier of the username of the token.
+type ClearCID struct {
+	Token string `json:"token"`
+}
+
+func (ClearCID) Name() string { return CommandClearCID }
+
+func (c ClearCID) args() []string { return []string{c.Token} }
+
+// ClearRecord removes a text record of the username of the token.
+type ClearRecord struct {
+	Token string `json:"token"`
+	Key   string `json:"key"`
+}
+
+func (ClearRecord) Name() string { return CommandClearRecord }
+
+func (c ClearRecord) args() []string { return []string{c.Token, c.Key} }
+
+// AssignSubname gives the subname of the token to the owner. Only the owner of the parent name can assign its
+// subnames.
+type AssignSubname struct {
+	Token string `json:"token"`
+	Owner string `json:"owner"`
+}
+
+func (AssignSubname) Name() string { return CommandAssignSubname }
+
+func (c AssignSubname) args() []string { return []string{c.Token, c.Owner} }
+
+// argument is a memo argument: its name in errors and its parser, which is given the arguments before it. The rest
+// argument is the remainder of the memo, spaces included.
+type argument struct {
+	name  string
+	parse parser
+	rest  bool
+}
+
+type parser func(input, arg string, offset int, previous []string) error
+
+// alone adapts the parser of an argument that does not depend on the arguments before it.
+func alone(parse func(input, arg string, offset int) error) parser {
+	return func(input, arg string, offset int, _ []string) error {
+		return parse(input, arg, offset)
+	}
+}
+
+var commands = map[string]struct {
+	arguments []argument
+	build     func(args []string) Command
+}{
+	CommandSetPrimaryName: {
+		arguments: []argument{{"token", alone(parseAddressAt), false}},
+		build:     func(args []string) Command { return SetPrimaryName{Token: args[0]} },
+	},
+	CommandSetCID: {
+		arguments: []argument{{"token", alone(parseAddressAt), false}, {"cid", alone(parseCIDAt), false}},
+		build:     func(args []string) Command { return SetCID{Token: args[0], CID: args[1]} },
+	},
+	CommandSetRecord: {
+		arguments: []argument{
+			{"token", alone(parseAddressAt), false},
+			{"key", alone(parseRecordKeyAt), false},
+			{"value", alone(parseRecordValueAt), true},
+		},
+		build: func(args []string) Command { return SetRecord{Token: args[0], Key: args[1], Value: args[2]} },
+	},
+	CommandSetAddress: {
+		arguments: []argument{
+			{"token", alone(parseAddressAt), false}, {"coin", alone(parseCoinAt), false}, {"address", parseCoinAddressAt, false},
+		},
+		build: func(args []string) Command { return SetAddress{Token: args[0], Coin: args[1], Address: args[2]} },
+	},
+	CommandClearPrimaryName: {
+		arguments: []argument{{"token", alone(parseAddressAt), false}},
+		build:     func(args []string) Command { return ClearPrimaryName{Token: args[0]} },
+	},
+	CommandClearCID: {
+		arguments: []argument{{"token", alone(parseAddressAt), false}},
+		build:     func(args []string) Command { return ClearCID{Token: args[0]} },
+	},
+	CommandClearRecord: {
+		arguments: []argument{{"token", alone(parseAddressAt), false}, {"key", alone(parseRecordKeyAt), false}},
+		build:     func(args []string) Command { return ClearRecord{Token: args[0], Key: args[1]} },
+	},
+	CommandAssignSubname: {
+		arguments: []argument{{"token", alone(parseAddressAt), false}, {"owner", alone(parseAddressAt), false}},
+		build:     func(args []string) Command { return AssignSubname{Token: args[0], Owner: args[1]} },
+	},
+}
+
+// parseCIDAt checks that the CID found at the offset of the input is ASCII letters, digits and underscores, which
+// covers CIDv0 and base32 and base36 CIDv1. The CID itself is not decoded.
+func parseCIDAt(input, cid string, offset int) error {
+	for i := 0; i < len(cid); i++ {
+		if !isWordByte(cid[i]) {
+			return fail(ErrInvalidCID, input, offset+i, "only letters, digits and _ are allowed")
+		}
+	}
+	return nil
+}
+
+// parseRecordKeyAt checks that the record key found at the offset of the input has 1 to MaxRecordKeyLength lower
+// case ASCII letters, digits, dots, dashes and underscores and starts with a letter or digit.
+func parseRecordKeyAt(input, key string, offset int) error {
+	for i := 0; i < len(key); i++ {
+		b := key[i]
+		if 'a' <= b && b <= 'z' || '0' <= b && b <= '9' || i > 0 && (b == '.' || b == '-' || b == '_') {
+			continue
+		}
+		return fail(ErrInvalidRecordKey, input, offset+i, "only a-z, 0-9, and after the first character . - _ are allowed")
+	}
+	if len(key) > MaxRecordKeyLength {
+		return fail(ErrInvalidRecordKey, input, offset+MaxRecordKeyLength, "key is longer than %d", MaxRecordKeyLength)
+	}
+	return nil
+}
+
+// parseRecordValueAt checks that the record value found at the offset of the input is UTF-8 text of at most
+// MaxRecordValueLength bytes without control characters.
+func parseRecordValueAt(input, value string, offset int) error {
+	for i, r := range value {
+		if r == utf8.RuneError && !strings.HasPrefix(value[i:], string(utf8.RuneError)) {
+			return fail(ErrInvalidRecordValue, input, offset+i, "value is not UTF-8")
+		}
+		if unicode.IsControl(r) {
+			return fail(ErrInvalidRecordValue, input, offset+i, "value contains control character %U", r)
+		}
+	}
+	if len(value) > MaxRecordValueLength {
+		return fail(
+			ErrInvalidRecordValue, input, offset+MaxRecordValueLength, "value is longer than %d", MaxRecordValueLength,
+		)
+	}
+	return nil
+}
+
+// ParseMemo parses a command memo: the command name followed by its arguments, separated by single spaces. The
+// value of set_record is the rest of the memo and may contain spaces.
+func ParseMemo(memo string) (Command, error) {
+	name, _, _ := strings.Cut(memo, " ")
+	command, ok := commands[name]
+	if !ok {
+		if name == "" && memo != "" {
+			return nil, fail(ErrUnexpectedSpace, memo, 0, "memo starts with a space")
+		}
+		return nil, fail(ErrUnknownCommand, memo, 0, "unknown command %q", name)
+	}
+
+	var args []string
+	offset := len(name) + 1
+	for _, argument := range command.arguments {
+		if offset >= len(memo) {
+			return nil, fail(ErrMissingArgument, memo, len(memo), "%v expects the %v", name, argument.name)
+		}
+		arg, _, _ := strings.Cut(memo[offset:], " ")
+		if argument.rest {
+			arg = memo[offset:]
+		}
+		if strings.HasPrefix(arg, " ") || arg == "" {
+			return nil, fail(ErrUnexpectedSpace, memo, offset, "arguments are separated by a single space")
+		}
+		if argument.rest && strings.HasSuffix(arg, " ") {
+			return nil, fail(ErrUnexpectedSpace, memo, len(memo)-1, "memo ends with a space")
+		}
+		if err := argument.parse(memo, arg, offset, args); err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		offset += len(arg) + 1
+	}
+
+	switch {
+	case offset == len(memo) || offset < len(memo) && memo[offset] == ' ':
+		return nil, fail(ErrUnexpectedSpace, memo, offset-1, "memo ends with a space")
+	case offset < len(memo):
+		return nil, fail(ErrUnexpectedArgument, memo, offset, "%v takes %d arguments", name, len(command.arguments))
+	}
+	return command.build(args), nil
+}
+
+// Encode returns the memo of the command, or the parse error of the memo if a field is invalid.
+func Encode(command Command) (string, error) {
+	memo := strings.Join(append([]string{command.Name()}, command.args()...), " ")
+	parsed, err := ParseMemo(memo)
+	if err != nil {
+		return "", err
+	}
+	if parsed != command {
+		return "", fmt.Errorf("%#v does not round-trip through its memo %q", command, memo)
+	}
+	return memo, nil
+}
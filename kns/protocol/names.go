@@ -0,0 +1,68 @@
+package protocol
+
+import "strings"
+
+const (
+	// AddressPrefix starts every Keeta account and token address.
+	AddressPrefix = "keeta_"
+	// MaxUsernameLength is the maximum length of a username or name label in characters, which are ASCII bytes in
+	// protocol version 1.
+	MaxUsernameLength = 32
+	// MaxNameLength is the maximum length of a name with its subname labels in bytes of its ASCII form, the longest
+	// DNS name.
+	MaxNameLength = 253
+)
+
+// isWordByte reports whether b is an ASCII letter, digit or underscore.
+func isWordByte(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' || b == '_'
+}
+
+// ParseUsername returns the username a token description inscribes in protocol version 1, which is the description
+// in lower case and what error offsets point into. It has 1 to MaxUsernameLength lower case ASCII letters, digits and
+// underscores. ParseName parses the names of later versions.
+func ParseUsername(description string) (string, error) {
+	username := strings.ToLower(description)
+	if username == "" {
+		return "", fail(ErrInvalidUsernameLength, username, 0, "username is empty")
+	}
+	for i := 0; i < len(username); i++ {
+		if b := username[i]; !('a' <= b && b <= 'z' || '0' <= b && b <= '9' || b == '_') {
+			return "", fail(ErrInvalidUsernameChar, username, i, "only a-z, 0-9 and _ are allowed")
+		}
+	}
+	if len(username) > MaxUsernameLength {
+		return "", fail(
+			ErrInvalidUsernameLength, username, MaxUsernameLength, "username is longer than %d", MaxUsernameLength,
+		)
+	}
+	return username, nil
+}
+
+// Parent returns the name the subname is under, empty for a top-level username.
+func Parent(name string) string {
+	_, parent, _ := strings.Cut(name, ".")
+	return parent
+}
+
+// ParseAddress checks that the address is AddressPrefix followed by ASCII letters, digits and underscores. The
+// checksum of the address is not verified.
+func ParseAddress(address string) error {
+	return parseAddressAt(address, address, 0)
+}
+
+// parseAddressAt parses the address found at the offset of the input, for errors pointing into the input.
+func parseAddressAt(input, address string, offset int) error {
+	if !strings.HasPrefix(address, AddressPrefix) {
+		return fail(ErrInvalidAddress, input, offset, "address should start with %v", AddressPrefix)
+	}
+	if len(address) == len(AddressPrefix) {
+		return fail(ErrInvalidAddress, input, offset+len(address), "address is empty after %v", AddressPrefix)
+	}
+	for i := len(AddressPrefix); i < len(address); i++ {
+		if !isWordByte(address[i]) {
+			return fail(ErrInvalidAddress, input, offset+i, "only letters, digits and _ are allowed")
+		}
+	}
+	return nil
+}
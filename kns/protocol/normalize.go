@@ -0,0 +1,254 @@
+package protocol
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// MaxLabelLength is the maximum length of a name label in bytes of its ASCII form, the longest DNS label.
+	MaxLabelLength = 63
+	// maxMarks is the maximum number of combining marks in a row.
+	maxMarks = 4
+
+	emojiPresentation = '\uFE0F'
+	zeroWidthJoiner   = '\u200D'
+	combiningKeycap   = '\u20E3'
+	blackFlag         = '\U0001F3F4'
+	cancelTag         = '\U000E007F'
+)
+
+// scripts are the scripts name letters can be written in. Labels are written in one of them, or in Latin mixed with
+// the scripts written alongside it in Japan, China or Korea.
+var scripts = map[string]*unicode.RangeTable{
+	"Latin": unicode.Latin, "Greek": unicode.Greek, "Cyrillic": unicode.Cyrillic, "Armenian": unicode.Armenian,
+	"Georgian": unicode.Georgian, "Hebrew": unicode.Hebrew, "Arabic": unicode.Arabic, "Thai": unicode.Thai,
+	"Devanagari": unicode.Devanagari, "Bengali": unicode.Bengali, "Tamil": unicode.Tamil, "Telugu": unicode.Telugu,
+	"Han": unicode.Han, "Hiragana": unicode.Hiragana, "Katakana": unicode.Katakana, "Hangul": unicode.Hangul,
+}
+
+// scriptMixes are the sets of scripts a label may mix, after UTS #39 highly restrictive.
+var scriptMixes = []map[string]bool{
+	{"Latin": true, "Han": true, "Hiragana": true, "Katakana": true},
+	{"Latin": true, "Han": true, "Hangul": true},
+}
+
+// latinLookalikes are the lower case letters of the scripts that can pass for Latin letters. A label written only
+// in them is a whole-script confusable of a Latin label, like Cyrillic "арр" of "app".
+var latinLookalikes = map[string]string{
+	"Cyrillic": "аеорсухіјѕԁԛԝһӏькв",
+	"Greek":    "αεικνορτυχγω",
+	"Armenian": "ահոօսզցւ",
+}
+
+// emojiRanges are the blocks of emoji, of which the assigned symbols are emoji.
+var emojiRanges = [][2]rune{
+	{0x231A, 0x231B}, {0x23E9, 0x23FA}, {0x25AA, 0x25FE}, {0x2600, 0x27BF}, {0x2934, 0x2935}, {0x2B05, 0x2B55},
+	{0x3030, 0x3030}, {0x303D, 0x303D}, {0x3297, 0x3299}, {0x1F000, 0x1F1E5}, {0x1F200, 0x1F3FA},
+	{0x1F400, 0x1FAFF},
+}
+
+// ParseName returns the normalized name a token description inscribes from protocol version 2 on: a username or a
+// subname, labels joined by dots from the subname label to the top-level username like blog.alice. Normalization
+// maps compatibility characters such as full-width letters to their plain form, folds the case, composes to NFC and
+// drops emoji presentation selectors, and error offsets point into the result. A label has 1 to MaxUsernameLength
+// characters:
+//   - ASCII digits and underscores,
+//   - letters of one script, or of Latin and the scripts it mixes with in Japan, China or Korea, followed by up to 4
+//     combining marks, but not only letters passing for Latin ones in another script,
+//   - emoji, with skin tone modifiers, joined by zero width joiners, flags, keycaps and tag sequences.
+//
+// Its ASCII form is at most MaxLabelLength bytes and that of the name at most MaxNameLength bytes.
+func ParseName(description string) (string, error) {
+	name := norm.NFC.String(cases.Fold().String(norm.NFKC.String(description)))
+	name = strings.ReplaceAll(name, string(emojiPresentation), "")
+
+	offset, length := 0, 0
+	for label := range strings.SplitSeq(name, ".") {
+		if err := parseLabelAt(name, label, offset); err != nil {
+			return "", err
+		}
+		ascii := ToASCII(label)
+		if len(ascii) > MaxLabelLength {
+			return "", fail(
+				ErrInvalidUsernameLength, name, offset, "label is longer than %d bytes as %v", MaxLabelLength, ascii,
+			)
+		}
+		if length+len(ascii) > MaxNameLength {
+			if ascii == label {
+				offset += MaxNameLength - length
+			}
+			return "", fail(ErrInvalidUsernameLength, name, offset, "name is longer than %d bytes", MaxNameLength)
+		}
+		offset, length = offset+len(label)+1, length+len(ascii)+1
+	}
+	return name, nil
+}
+
+// parseLabelAt checks the normalized label found at the offset of the input.
+func parseLabelAt(input, label string, offset int) error {
+	if label == "" {
+		return fail(ErrInvalidUsernameLength, input, offset, "username is empty")
+	}
+
+	var (
+		used        []string
+		letters     string
+		marks       int
+		lastMark    rune
+		afterLetter bool
+	)
+	for i, characters := 0, 0; i < len(label); characters++ {
+		if characters == MaxUsernameLength {
+			return fail(ErrInvalidUsernameLength, input, offset+i, "username is longer than %d", MaxUsernameLength)
+		}
+
+		r, size := utf8.DecodeRuneInString(label[i:])
+		if n := emojiAt(label[i:]); n > 0 {
+			i, afterLetter = i+n, false
+			continue
+		}
+		switch {
+		case '0' <= r && r <= '9' || r == '_':
+			afterLetter = false
+		case unicode.IsLetter(r):
+			script := scriptOf(r)
+			if script == "" {
+				return fail(ErrInvalidUsernameChar, input, offset+i, "%U is not a letter of a supported script", r)
+			}
+			if used = addScript(used, script); !mixable(used) {
+				return fail(ErrMixedScript, input, offset+i, "%v letters do not mix with %v", script, used[0])
+			}
+			letters += string(r)
+			afterLetter = true
+		case unicode.In(r, unicode.Mn, unicode.Mc):
+			if !afterLetter || marks == maxMarks || r == lastMark {
+				return fail(
+					ErrInvalidUsernameChar, input, offset+i, "%U should follow a letter, at most %d different marks in a row",
+					r, maxMarks,
+				)
+			}
+		default:
+			return fail(ErrInvalidUsernameChar, input, offset+i, "%U is not allowed", r)
+		}
+
+		if unicode.In(r, unicode.Mn, unicode.Mc) {
+			marks, lastMark = marks+1, r
+		} else {
+			marks, lastMark = 0, 0
+		}
+		i += size
+	}
+
+	if len(used) == 1 && latinLookalikes[used[0]] != "" && strings.Trim(letters, latinLookalikes[used[0]]) == "" {
+		return fail(ErrConfusableName, input, offset, "%v letters that pass for Latin ones", used[0])
+	}
+	return nil
+}
+
+// scriptOf returns the supported script of the letter, empty if it is none.
+func scriptOf(r rune) string {
+	if r == '\u30FC' {
+		// the prolonged sound mark is common to hiragana and katakana
+		return "Katakana"
+	}
+	for name, table := range scripts {
+		if unicode.Is(table, r) {
+			return name
+		}
+	}
+	return ""
+}
+
+func addScript(used []string, script string) []string {
+	for _, s := range used {
+		if s == script {
+			return used
+		}
+	}
+	return append(used, script)
+}
+
+// mixable reports whether a label can mix the scripts.
+func mixable(used []string) bool {
+	if len(used) < 2 {
+		return true
+	}
+	for _, mix := range scriptMixes {
+		all := true
+		for _, script := range used {
+			all = all && mix[script]
+		}
+		if all {
+			return true
+		}
+	}
+	return false
+}
+
+// isEmoji reports whether r is an emoji that can start or be joined into an emoji sequence.
+func isEmoji(r rune) bool {
+	for _, bounds := range emojiRanges {
+		if bounds[0] <= r && r <= bounds[1] {
+			return unicode.Is(unicode.So, r)
+		}
+	}
+	return false
+}
+
+func isRegionalIndicator(r rune) bool { return '\U0001F1E6' <= r && r <= '\U0001F1FF' }
+
+func isSkinTone(r rune) bool { return '\U0001F3FB' <= r && r <= '\U0001F3FF' }
+
+func isTag(r rune) bool { return '\U000E0020' <= r && r <= '\U000E007E' }
+
+// emojiAt returns the length in bytes of the emoji sequence s starts with, 0 if it does not start with one.
+func emojiAt(s string) int {
+	r, n := utf8.DecodeRuneInString(s)
+	switch {
+	case '0' <= r && r <= '9' || r == '#' || r == '*':
+		if next, size := utf8.DecodeRuneInString(s[n:]); next == combiningKeycap {
+			return n + size
+		}
+		return 0
+	case isRegionalIndicator(r):
+		if next, size := utf8.DecodeRuneInString(s[n:]); isRegionalIndicator(next) {
+			return n + size
+		}
+		return 0
+	case r == blackFlag:
+		// subdivision flags are the black flag followed by tags and a cancel tag
+		i := n
+		for {
+			next, size := utf8.DecodeRuneInString(s[i:])
+			if !isTag(next) {
+				if next == cancelTag && i > n {
+					return i + size
+				}
+				break
+			}
+			i += size
+		}
+	case !isEmoji(r):
+		return 0
+	}
+
+	for {
+		if next, size := utf8.DecodeRuneInString(s[n:]); isSkinTone(next) {
+			n += size
+		}
+		joiner, size := utf8.DecodeRuneInString(s[n:])
+		if joiner != zeroWidthJoiner {
+			return n
+		}
+		next, nextSize := utf8.DecodeRuneInString(s[n+size:])
+		if !isEmoji(next) {
+			return n
+		}
+		n += size + nextSize
+	}
+}
@@ -0,0 +1,50 @@
+// Package protocol is the grammar of the KNS commands: the usernames inscribed by naming a token, the addresses they
+// refer to and the memos of the burn sends that manage them. It parses them into typed commands and encodes those
+// back, and ships the conformance vectors in vectors.json other implementations can check themselves against.
+package protocol
+
+import "fmt"
+
+// Code is the kind of a parse error, the error field of the conformance vectors.
+type Code string
+
+const (
+	ErrUnknownCommand        Code = "unknown_command"
+	ErrMissingArgument       Code = "missing_argument"
+	ErrUnexpectedArgument    Code = "unexpected_argument"
+	ErrUnexpectedSpace       Code = "unexpected_space"
+	ErrInvalidAddress        Code = "invalid_address"
+	ErrInvalidCID            Code = "invalid_cid"
+	ErrInvalidRecordKey      Code = "invalid_record_key"
+	ErrInvalidRecordValue    Code = "invalid_record_value"
+	ErrUnknownCoin           Code = "unknown_coin"
+	ErrInvalidCoinAddress    Code = "invalid_coin_address"
+	ErrInvalidUsernameLength Code = "invalid_username_length"
+	ErrInvalidUsernameChar   Code = "invalid_username_character"
+	ErrMixedScript           Code = "mixed_script"
+	ErrConfusableName        Code = "confusable_name"
+)
+
+func (c Code) Error() string {
+	return string(c)
+}
+
+// Error is a parse error of the input at the byte offset, errors.Is matches it with its Code.
+type Error struct {
+	Code   Code
+	Input  string
+	Offset int
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v at offset %d of %q: %v", e.Code, e.Offset, e.Input, e.Reason)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Code
+}
+
+func fail(code Code, input string, offset int, format string, args ...any) *Error {
+	return &Error{Code: code, Input: input, Offset: offset, Reason: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,185 @@
+package protocol
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func loadVectors(t *testing.T) Vectors {
+	t.Helper()
+	vectors, err := LoadVectors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return vectors
+}
+
+// checkError fails unless err is a parse error with the code and, if given, the offset of the vector.
+func checkError(t *testing.T, input string, err error, code Code, offset *int) {
+	t.Helper()
+	var parseErr *Error
+	if !errors.As(err, &parseErr) || !errors.Is(err, code) {
+		t.Errorf("%q: error %v, want %v", input, err, code)
+		return
+	}
+	if offset != nil && parseErr.Offset != *offset {
+		t.Errorf("%q: error at offset %d, want %d", input, parseErr.Offset, *offset)
+	}
+}
+
+func TestMemoVectors(t *testing.T) {
+	for _, vector := range loadVectors(t).Memos {
+		command, err := ParseMemo(vector.Memo)
+		if vector.Error != "" {
+			checkError(t, vector.Memo, err, vector.Error, vector.Offset)
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", vector.Memo, err)
+			continue
+		}
+		if got := Fields(command); !reflect.DeepEqual(got, vector.Command) {
+			t.Errorf("%q: command %v, want %v", vector.Memo, got, vector.Command)
+		}
+		if memo, err := Encode(command); err != nil || memo != vector.Memo {
+			t.Errorf("%q: encoded as %q %v", vector.Memo, memo, err)
+		}
+	}
+}
+
+func TestUsernameVectors(t *testing.T) {
+	for _, vector := range loadVectors(t).Usernames {
+		username, err := ParseUsername(vector.Description)
+		if vector.Error != "" {
+			checkError(t, vector.Description, err, vector.Error, vector.Offset)
+		} else if err != nil || username != vector.Username {
+			t.Errorf("%q: username %q %v, want %q", vector.Description, username, err, vector.Username)
+		}
+	}
+}
+
+func TestNameVectors(t *testing.T) {
+	for _, vector := range loadVectors(t).Names {
+		name, err := ParseName(vector.Description)
+		if vector.Error != "" {
+			checkError(t, vector.Description, err, vector.Error, vector.Offset)
+		} else if err != nil || name != vector.Username {
+			t.Errorf("%q: name %q %v, want %q", vector.Description, name, err, vector.Username)
+		}
+	}
+}
+
+func TestParent(t *testing.T) {
+	for name, want := range map[string]string{"alice": "", "blog.alice": "alice", "a.blog.alice": "blog.alice"} {
+		if parent := Parent(name); parent != want {
+			t.Errorf("parent of %q %q, want %q", name, parent, want)
+		}
+	}
+}
+
+func TestPunycodeVectors(t *testing.T) {
+	for _, vector := range loadVectors(t).Punycode {
+		if ascii := ToASCII(vector.Name); ascii != vector.ASCII {
+			t.Errorf("%q: ASCII form %q, want %q", vector.Name, ascii, vector.ASCII)
+		}
+		if name, err := ToUnicode(vector.ASCII); err != nil || name != vector.Name {
+			t.Errorf("%q: name %q %v, want %q", vector.ASCII, name, err, vector.Name)
+		}
+	}
+	if name, err := ToUnicode("XN--ZO-IJA.alice"); err != nil || name != "zoë.alice" {
+		t.Errorf("upper case ASCII form: name %q %v, want zoë.alice", name, err)
+	}
+	if _, err := ToUnicode("xn--zo-i!a.alice"); err == nil {
+		t.Error("invalid punycode decoded")
+	}
+}
+
+// TestPunycodeRFC3492 checks sample strings of RFC 3492 section 7.1, with the basic code points in lower case as the
+// ASCII form of a name has them.
+func TestPunycodeRFC3492(t *testing.T) {
+	for _, sample := range []struct{ name, ascii string }{
+		// (A) Arabic (Egyptian)
+		{
+			"\u0644\u064A\u0647\u0645\u0627\u0628\u062A\u0643\u0644\u0645\u0648\u0634\u0639\u0631\u0628\u064A" +
+				"\u061F",
+			"egbpdaj6bu4bxfgehfvwxn",
+		},
+		// (B) Chinese (simplified)
+		{"\u4ED6\u4EEC\u4E3A\u4EC0\u4E48\u4E0D\u8BF4\u4E2D\u6587", "ihqwcrb4cv8a8dqg056pqjye"},
+		// (C) Chinese (traditional)
+		{"\u4ED6\u5011\u7232\u4EC0\u9EBD\u4E0D\u8AAA\u4E2D\u6587", "ihqwctvzc91f659drss3x8bo0yb"},
+		// (D) Czech
+		{"pro\u010Dprost\u011Bnemluv\u00ED\u010Desky", "proprostnemluvesky-uyb24dma41a"},
+		// (E) Hebrew
+		{
+			"\u05DC\u05DE\u05D4\u05D4\u05DD\u05E4\u05E9\u05D5\u05D8\u05DC\u05D0\u05DE\u05D3\u05D1\u05E8\u05D9" +
+				"\u05DD\u05E2\u05D1\u05E8\u05D9\u05EA",
+			"4dbcagdahymbxekheh6e0a7fei0b",
+		},
+		// (I) Russian (Cyrillic)
+		{
+			"\u043F\u043E\u0447\u0435\u043C\u0443\u0436\u0435\u043E\u043D\u0438\u043D\u0435\u0433\u043E\u0432" +
+				"\u043E\u0440\u044F\u0442\u043F\u043E\u0440\u0443\u0441\u0441\u043A\u0438",
+			"b1abfaaepdrnnbgefbadotcwatmq2g4l",
+		},
+		// (M) <amuro><namie>-with-SUPER-MONKEYS
+		{"\u5B89\u5BA4\u5948\u7F8E\u6075-with-super-monkeys", "-with-super-monkeys-pc58ag80a8qai00g7n9n"},
+		// (R) <sono><supiido><de>
+		{"\u305D\u306E\u30B9\u30D4\u30FC\u30C9\u3067", "d9juau41awczczp"},
+	} {
+		if got := ToASCII(sample.name); got != ACEPrefix+sample.ascii {
+			t.Errorf("%q: ASCII form %q, want %q", sample.name, got, ACEPrefix+sample.ascii)
+		}
+		if got, err := ToUnicode(ACEPrefix + sample.ascii); err != nil || got != sample.name {
+			t.Errorf("%q: name %q %v, want %q", sample.ascii, got, err, sample.name)
+		}
+	}
+}
+
+func TestAddressVectors(t *testing.T) {
+	for _, vector := range loadVectors(t).Addresses {
+		err := ParseAddress(vector.Address)
+		if vector.Error != "" {
+			checkError(t, vector.Address, err, vector.Error, vector.Offset)
+		} else if err != nil {
+			t.Errorf("%q: %v", vector.Address, err)
+		}
+	}
+}
+
+func TestCoinAddressVectors(t *testing.T) {
+	for _, vector := range loadVectors(t).CoinAddresses {
+		err := ParseCoinAddress(vector.Coin, vector.Address)
+		if vector.Error != "" {
+			checkError(t, vector.Coin+" "+vector.Address, err, vector.Error, vector.Offset)
+		} else if err != nil {
+			t.Errorf("%v %q: %v", vector.Coin, vector.Address, err)
+		}
+	}
+}
+
+func TestLookupCoin(t *testing.T) {
+	for _, coin := range []string{"eth", "60"} {
+		if c, ok := LookupCoin(coin); !ok || c.Symbol != "eth" {
+			t.Errorf("coin %q %+v %v, want eth", coin, c, ok)
+		}
+	}
+	if c, ok := LookupCoin("ETH"); ok {
+		t.Errorf("coin ETH %+v, want none", c)
+	}
+}
+
+func TestEncodeRejectsInvalidCommands(t *testing.T) {
+	for _, command := range []Command{
+		SetPrimaryName{},
+		SetPrimaryName{Token: "keeta_abc extra"},
+		SetCID{Token: "keeta_abc"},
+		SetCID{Token: "keeta_abc", CID: "Qm Qm"},
+		SetAddress{Token: "keeta_abc", Coin: "eth", Address: "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeD"},
+	} {
+		if memo, err := Encode(command); err == nil {
+			t.Errorf("%#v encoded as %q", command, memo)
+		}
+	}
+}
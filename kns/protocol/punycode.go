@@ -0,0 +1,30 @@
+package protocol
+
+import (
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// ACEPrefix starts the labels of a name in ASCII form that are punycode.
+const ACEPrefix = "xn--"
+
+// ToASCII returns the ASCII form of the name for DNS, the IDNA A-labels: labels that are not ASCII are encoded as
+// punycode after ACEPrefix, so xn--zo-ija.alice is zoë.alice.
+func ToASCII(name string) string {
+	// the Punycode profile neither maps nor validates, ParseName does, so encoding can not fail
+	ascii, _ := idna.Punycode.ToASCII(name)
+	return ascii
+}
+
+// ToUnicode returns the name of its ASCII form, decoding the labels starting with ACEPrefix in any case. The result
+// still has to be normalized with ParseName.
+func ToUnicode(ascii string) (string, error) {
+	labels := strings.Split(ascii, ".")
+	for i, label := range labels {
+		if len(label) >= len(ACEPrefix) && strings.EqualFold(label[:len(ACEPrefix)], ACEPrefix) {
+			labels[i] = strings.ToLower(label)
+		}
+	}
+	return idna.Punycode.ToUnicode(strings.Join(labels, "."))
+}
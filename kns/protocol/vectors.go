@@ -0,0 +1,74 @@
+package protocol
+
+import (
+	_ "embed"
+	"encoding/json"
+)
+
+// VectorsJSON is vectors.json, the conformance vectors of the grammar.
+//
+//go:embed vectors.json
+var VectorsJSON []byte
+
+// Vectors are conformance test cases. A case either expects the parsed value or the Code of the error, whose offset
+// is part of the case when given.
+type Vectors struct {
+	Memos     []MemoVector     `json:"memos"`
+	Usernames []UsernameVector `json:"usernames"`
+	// Names are token descriptions parsed as names, which may be subnames and are normalized Unicode.
+	Names []UsernameVector `json:"names"`
+	// Punycode are names with their ASCII form.
+	Punycode  []PunycodeVector `json:"punycode"`
+	Addresses []AddressVector  `json:"addresses"`
+	// CoinAddresses are the addresses of set_address by coin.
+	CoinAddresses []CoinAddressVector `json:"coin_addresses"`
+}
+
+type MemoVector struct {
+	Memo string `json:"memo"`
+	// Command is the command name and its arguments by name.
+	Command map[string]string `json:"command,omitempty"`
+	Error   Code              `json:"error,omitempty"`
+	Offset  *int              `json:"offset,omitempty"`
+}
+
+type UsernameVector struct {
+	Description string `json:"description"`
+	Username    string `json:"username,omitempty"`
+	Error       Code   `json:"error,omitempty"`
+	Offset      *int   `json:"offset,omitempty"`
+}
+
+type PunycodeVector struct {
+	Name  string `json:"name"`
+	ASCII string `json:"ascii"`
+}
+
+type AddressVector struct {
+	Address string `json:"address"`
+	Error   Code   `json:"error,omitempty"`
+	Offset  *int   `json:"offset,omitempty"`
+}
+
+type CoinAddressVector struct {
+	Coin    string `json:"coin"`
+	Address string `json:"address"`
+	Error   Code   `json:"error,omitempty"`
+	Offset  *int   `json:"offset,omitempty"`
+}
+
+// LoadVectors decodes VectorsJSON.
+func LoadVectors() (Vectors, error) {
+	var vectors Vectors
+	err := json.Unmarshal(VectorsJSON, &vectors)
+	return vectors, err
+}
+
+// Fields returns the command name under "command" and its arguments by name, the form of MemoVector.Command.
+func Fields(command Command) map[string]string {
+	fields := map[string]string{"command": command.Name()}
+	for i, arg := range command.args() {
+		fields[commands[command.Name()].arguments[i].name] = arg
+	}
+	return fields
+}
@@ -2,94 +2,203 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"kns-indexer/config"
 	_ "kns-indexer/docs"
-	"kns-indexer/handlers"
 	"kns-indexer/indexer"
+	"kns-indexer/outbox"
+	"kns-indexer/store"
 	"log/slog"
 	"os"
-
-	"github.com/gofiber/fiber/v3"
-	"github.com/gofiber/fiber/v3/middleware/logger"
-	"github.com/gofiber/swagger/v2"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
 )
 
+const usage = `Usage: kns-indexer [config flags] [command] [arguments]
+
+Commands:
+  all                             run the API and campaign for running the indexer, the default
+  serve                           run the API only
+  index                           campaign for running the indexer only
+  migrate [status|up|down [n]]    show, apply or revert the last n schema migrations
+  rebuild                         delete the index and start over from the first page, stop the indexers first
+  export [-format ndjson|csv]     write every username to stdout
+  verify                          replay the history into memory and compare it with the index
+  replay-dead-letters             retry the dead-lettered history items
+  config print                    print the effective configuration with secrets redacted
+  devnet                          run a simulated ledger with the indexer and the API, in memory by default
+  devnet inscribe <account> <username>
+  devnet transfer <account> <username> <to>
+  devnet set-cid <account> <username> <cid>
+  devnet set-primary-name <account> <username>
+  devnet set-record <account> <username> <key> <value>
+  devnet set-address <account> <username> <coin> <address>
+  devnet clear-primary-name <account> <username>
+  devnet clear-cid <account> <username>
+  devnet clear-record <account> <username> <key>
+  devnet assign-subname <account> <subname> <to>
+                                  append a command of the account to the running devnet, accounts not starting
+                                  with keeta_ are names of fake accounts
+
+Run kns-indexer -h to list the config flags.
+`
+
+var commands = []string{"all", "serve", "index", "migrate", "rebuild", "export", "verify", "replay-dead-letters", "config", "devnet"}
+
 // @title KNS Indexer API
 // @version 1.0
 // @description This is a simple API for KNS Indexer
 // @BasePath /
 func main() {
-	handler := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+	// stdout is left to export and the stdout event sink
+	handler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
 		Level:     slog.LevelDebug,
 		AddSource: true,
 	})
 	slog.SetDefault(slog.New(handler))
 
-	pool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
-	if err != nil {
-		panic(err)
+	cfg, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Fprint(os.Stderr, usage)
+		return
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
-	defer pool.Close()
 
-	conn, err := pool.Acquire(context.Background())
-	if err != nil {
-		panic(err)
+	command := "all"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
 	}
 
-	createTablesSql := `
-	CREATE TABLE IF NOT EXISTS settings(
-		page INTEGER NOT NULL CHECK (page > 0) DEFAULT 1,
-		last_block_timestamp TIMESTAMPTZ,
-		last_block_hash TEXT
-	);
-	CREATE TABLE IF NOT EXISTS username(
-		username TEXT PRIMARY KEY,
-		address TEXT NOT NULL,
-		owner TEXT NOT NULL,
-		cid TEXT,
-		is_primary BOOLEAN NOT NULL DEFAULT FALSE,
-		timestamp TIMESTAMPTZ NOT NULL
-	);
-	`
-
-	if _, err = conn.Exec(context.Background(), createTablesSql); err != nil {
-		panic(err)
+	if !slices.Contains(commands, command) || command == "config" && (len(args) != 1 || args[0] != "print") {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
 	}
 
-	var isSettingsExists bool
-	if err = conn.QueryRow(context.Background(), "SELECT EXISTS(SELECT 1 FROM settings);").Scan(&isSettingsExists); err != nil {
-		panic(err)
+	if command == "devnet" && len(args) > 0 {
+		if err = devnetCommand(cfg, args); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	} else if command == "devnet" {
+		cfg = devnetConfig(cfg)
 	}
-	if !isSettingsExists {
-		if _, err = conn.Exec(context.Background(), "INSERT INTO settings DEFAULT VALUES;"); err != nil {
+
+	if command == "config" {
+		if err = cfg.Print(os.Stdout); err != nil {
 			panic(err)
 		}
-		slog.Info("Settings created")
+		if err = cfg.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid config:\n%v\n", err)
+			os.Exit(1)
+		}
+		return
 	}
 
-	conn.Release()
-
-	slog.Info("Starting KNS Indexer")
-
-	go indexer.Run(pool)
+	if err = cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid config:\n%v\n", err)
+		os.Exit(1)
+	}
+	ix, err := indexer.New(cfg)
+	if err != nil {
+		panic(err)
+	}
 
-	app := fiber.New()
-	app.Use(logger.New())
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	app.Get("/*", handlers.NewDomainHandler(pool))
+	db, err := store.Open(ctx, cfg.DatabaseURL)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
 
-	app.Get("/docs/*", swagger.HandlerDefault)
+	switch command {
+	case "all", "serve", "index", "devnet":
+		if err = db.Migrate(ctx); err != nil {
+			break
+		}
+		var relay func(ctx context.Context)
+		if relay, err = outboxRelay(cfg, db); err != nil {
+			break
+		}
+		slog.Info("Starting KNS Indexer", "command", command)
+		switch command {
+		case "all":
+			go runIndexer(ctx, ix, db, relay)
+			err = serve(ctx, cfg, ix, db)
+		case "serve":
+			if pg, ok := db.(*store.Postgres); ok {
+				go ix.Follow(ctx, pg)
+			}
+			err = serve(ctx, cfg, ix, db)
+		case "index":
+			runIndexer(ctx, ix, db, relay)
+		case "devnet":
+			err = runDevnet(ctx, cfg, ix, db, relay)
+		}
+		slog.Info("KNS Indexer stopped!")
+	case "migrate":
+		err = migrate(ctx, args, db)
+	case "rebuild":
+		err = rebuild(ctx, db)
+	case "export":
+		err = export(ctx, args, db)
+	case "verify":
+		err = verify(ctx, ix, db)
+	case "replay-dead-letters":
+		var replayed, failed int
+		if replayed, failed, err = ix.ReplayDeadLetters(ctx, db); err == nil {
+			slog.Info("Replayed dead letters", "replayed", replayed, "failed", failed)
+		}
+	}
 
-	app.Get("/usernames", handlers.NewGetUsernamesHandler(pool))
-	app.Get("/usernames/owner/:owner", handlers.NewGetOwnerUsernamesHandler(pool))
-	app.Get("/usernames/:username", handlers.NewGetUsernameHandler(pool))
-	app.Get("/primary-username/:owner", handlers.NewGetPrimaryUsernameHandler(pool))
+	if err != nil {
+		slog.Error("Command failed", "command", command, "error", err)
+		os.Exit(1)
+	}
+}
 
-	slog.Info("Starting API on :8000")
+// runIndexer runs the indexer and the outbox relay until the context is done, on PostgreSQL only while this replica
+// is the leader.
+func runIndexer(ctx context.Context, ix *indexer.Indexer, db store.Store, relay func(ctx context.Context)) {
+	if pg, ok := db.(*store.Postgres); ok {
+		ix.Lead(ctx, pg, relay)
+	} else {
+		go relay(ctx)
+		ix.Supervise(ctx, db)
+	}
+}
 
-	if err = app.Listen(":8000"); err != nil {
-		panic(err)
+// outboxRelay returns a function relaying the outbox to every configured sink until its context is done.
+func outboxRelay(cfg config.Config, db store.Store) (func(ctx context.Context), error) {
+	var sinks []outbox.EventSink
+	names := map[string]bool{}
+	for _, spec := range cfg.Outbox.Sinks {
+		sink, err := outbox.Parse(spec)
+		if err != nil {
+			return nil, err
+		}
+		// sinks with the same name would share their offset
+		if names[sink.Name()] {
+			return nil, fmt.Errorf("event sinks should have distinct names, %v is used twice", sink.Name())
+		}
+		names[sink.Name()] = true
+		sinks = append(sinks, sink)
 	}
 
-	slog.Info("KNS Indexer stopped!")
+	return func(ctx context.Context) {
+		var wg sync.WaitGroup
+		for _, sink := range sinks {
+			slog.Info("Relaying outbox", "sink", sink.Name())
+			wg.Go(func() { outbox.Relay(ctx, db, sink, cfg.Outbox.BatchSize, cfg.Outbox.PollInterval) })
+		}
+		wg.Wait()
+	}, nil
 }
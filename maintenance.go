@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"kns-indexer/indexer"
+	"kns-indexer/models"
+	"kns-indexer/store"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+)
+
+// rebuild resets the index, the indexer applies the history again from the first page on its next start.
+func rebuild(ctx context.Context, db store.Store) error {
+	if err := db.Reset(ctx); err != nil {
+		return err
+	}
+	slog.Info("Index reset, start the indexer to rebuild it")
+	return nil
+}
+
+// export writes every username to stdout as newline-delimited JSON or CSV.
+func export(ctx context.Context, args []string, db store.Store) error {
+	flagSet := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flagSet.String("format", "ndjson", "output format, ndjson or csv")
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+	if *format != "ndjson" && *format != "csv" {
+		return fmt.Errorf("format should be ndjson or csv")
+	}
+
+	usernames, err := db.AllUsernames(ctx)
+	if err != nil {
+		return err
+	}
+
+	if *format == "ndjson" {
+		encoder := json.NewEncoder(os.Stdout)
+		for _, username := range usernames {
+			if err = encoder.Encode(username); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	w := csv.NewWriter(os.Stdout)
+	if err = w.Write(
+		[]string{"username", "address", "owner", "cid", "is_primary", "timestamp", "parent", "display"},
+	); err != nil {
+		return err
+	}
+	for _, username := range usernames {
+		var cid, parent, display string
+		if username.CID != nil {
+			cid = *username.CID
+		}
+		if username.Parent != nil {
+			parent = *username.Parent
+		}
+		if username.Display != nil {
+			display = *username.Display
+		}
+		if err = w.Write([]string{
+			username.Username,
+			username.Address,
+			username.Owner,
+			cid,
+			strconv.FormatBool(username.IsPrimary),
+			username.Timestamp.Format(time.RFC3339Nano),
+			parent,
+			display,
+		}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// verify replays the history up to the last indexed block into memory and reports every username that differs
+// from the index. Usernames changed by replayed dead letters show up as differences.
+func verify(ctx context.Context, ix *indexer.Indexer, db store.Store) error {
+	_, _, lastBlockHash, err := db.LoadCursor(ctx)
+	if err != nil {
+		return err
+	}
+	if lastBlockHash == nil {
+		slog.Info("Nothing indexed yet")
+		return nil
+	}
+
+	indexed, err := db.AllUsernames(ctx)
+	if err != nil {
+		return err
+	}
+	if err = store.AttachRecords(ctx, db, indexed); err != nil {
+		return err
+	}
+	replayed, err := ix.Replay(ctx, lastBlockHash)
+	if err != nil {
+		return err
+	}
+
+	indexedByName := map[string]models.Username{}
+	for _, username := range indexed {
+		indexedByName[username.Username] = username
+	}
+
+	differences := 0
+	for _, want := range replayed {
+		got, ok := indexedByName[want.Username]
+		delete(indexedByName, want.Username)
+		if !ok {
+			fmt.Printf("missing %v\n", want.Username)
+			differences++
+		} else if !sameUsername(got, want) {
+			fmt.Printf("differs %v: indexed %v, replayed %v\n", want.Username, formatUsername(got), formatUsername(want))
+			differences++
+		}
+	}
+	for username := range indexedByName {
+		fmt.Printf("unexpected %v\n", username)
+		differences++
+	}
+
+	if differences > 0 {
+		return fmt.Errorf("%d of %d usernames differ from the history up to block %v", differences, len(replayed), *lastBlockHash)
+	}
+	slog.Info("Index matches the history", "usernames", len(replayed), "lastBlockHash", *lastBlockHash)
+	return nil
+}
+
+func sameUsername(a, b models.Username) bool {
+	return formatUsername(a) == formatUsername(b)
+}
+
+func formatUsername(u models.Username) string {
+	cid, parent, display := "<nil>", "<nil>", "<nil>"
+	if u.CID != nil {
+		cid = *u.CID
+	}
+	if u.Parent != nil {
+		parent = *u.Parent
+	}
+	if u.Display != nil {
+		display = *u.Display
+	}
+	return fmt.Sprintf(
+		"address=%v owner=%v cid=%v primary=%v timestamp=%v parent=%v display=%v records=%v",
+		u.Address, u.Owner, cid, u.IsPrimary, u.Timestamp.UTC(), parent, display, u.Records,
+	)
+}
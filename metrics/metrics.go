@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Metric is a Prometheus counter or gauge with optional labels.
+type Metric struct {
+	name string
+	help string
+	kind string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []*Metric
+)
+
+func NewCounter(name, help string) *Metric {
+	return register(&Metric{name: name, help: help, kind: "counter", values: map[string]float64{}})
+}
+
+func NewGauge(name, help string) *Metric {
+	return register(&Metric{name: name, help: help, kind: "gauge", values: map[string]float64{}})
+}
+
+func register(m *Metric) *Metric {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, m)
+	return m
+}
+
+// Inc increments the metric, labels are name and value pairs.
+func (m *Metric) Inc(labels ...string) {
+	m.Add(1, labels...)
+}
+
+func (m *Metric) Add(delta float64, labels ...string) {
+	key := labelsKey(labels)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[key] += delta
+}
+
+func (m *Metric) Set(value float64, labels ...string) {
+	key := labelsKey(labels)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[key] = value
+}
+
+func labelsKey(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var pairs []string
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", labels[i], labels[i+1]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Write writes all metrics in Prometheus text exposition format.
+func Write(w io.Writer) error {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	for _, m := range registry {
+		m.mu.Lock()
+		keys := make([]string, 0, len(m.values))
+		for key := range m.values {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, key := range keys {
+			fmt.Fprintf(&sb, "%s%s %v\n", m.name, key, m.values[key])
+		}
+		m.mu.Unlock()
+
+		if _, err := io.WriteString(w, sb.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
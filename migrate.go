@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"kns-indexer/migrations"
+	"kns-indexer/store"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// migrate runs "migrate status", "migrate up" or "migrate down [steps]", reverting one migration by default. Other
+// stores than PostgreSQL only support up.
+func migrate(ctx context.Context, args []string, db store.Store) error {
+	if len(args) == 0 {
+		args = []string{"status"}
+	}
+
+	pg, ok := db.(*store.Postgres)
+	if !ok {
+		if args[0] != "up" {
+			return fmt.Errorf("migrate %v is only supported on PostgreSQL", args[0])
+		}
+		return db.Migrate(ctx)
+	}
+	pool := pg.Pool
+
+	switch args[0] {
+	case "status":
+		statuses, err := migrations.Statuses(ctx, pool)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tREVERSIBLE\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%v\t%s\n", status.Version, status.Name, status.Down != "", appliedAt)
+		}
+		return w.Flush()
+	case "up":
+		applied, err := migrations.Up(ctx, pool)
+		fmt.Printf("Applied %d migrations\n", len(applied))
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("steps should be positive integer")
+			}
+		}
+		reverted, err := migrations.Down(ctx, pool, steps)
+		fmt.Printf("Reverted %d migrations\n", len(reverted))
+		return err
+	}
+
+	return fmt.Errorf("unknown migrate command %q, expected status, up or down", args[0])
+}
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS settings(
+	page INTEGER NOT NULL CHECK (page > 0) DEFAULT 1,
+	last_block_timestamp TIMESTAMPTZ,
+	last_block_hash TEXT
+);
+INSERT INTO settings SELECT WHERE NOT EXISTS(SELECT 1 FROM settings);
+
+CREATE TABLE IF NOT EXISTS username(
+	username TEXT PRIMARY KEY,
+	address TEXT NOT NULL,
+	owner TEXT NOT NULL,
+	cid TEXT,
+	is_primary BOOLEAN NOT NULL DEFAULT FALSE,
+	timestamp TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS pending_action(
+	block_hash TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	type TEXT NOT NULL,
+	account TEXT NOT NULL,
+	token TEXT NOT NULL,
+	username TEXT,
+	owner TEXT,
+	cid TEXT,
+	timestamp TIMESTAMPTZ NOT NULL,
+	first_seen TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (block_hash, position)
+);
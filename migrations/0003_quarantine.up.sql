@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS quarantine(
+	block_hash TEXT PRIMARY KEY,
+	reason TEXT NOT NULL,
+	raw JSONB NOT NULL,
+	timestamp TIMESTAMPTZ NOT NULL,
+	quarantined_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS dead_letter(
+	id BIGSERIAL PRIMARY KEY,
+	stage TEXT NOT NULL,
+	block_hash TEXT,
+	position INTEGER,
+	error TEXT NOT NULL,
+	raw JSONB NOT NULL,
+	context JSONB,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	replayed_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS dead_letter_item ON dead_letter(
+	stage, COALESCE(block_hash, ''), COALESCE(position, -1), md5(raw::text)
+);
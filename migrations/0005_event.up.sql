@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS event(
+	block_hash TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	type TEXT NOT NULL,
+	account TEXT NOT NULL,
+	token TEXT NOT NULL,
+	username TEXT NOT NULL,
+	owner TEXT,
+	cid TEXT,
+	timestamp TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (block_hash, position)
+);
+CREATE INDEX IF NOT EXISTS event_username ON event(username, timestamp);
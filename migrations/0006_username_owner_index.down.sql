@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS username_owner;
+DROP INDEX IF EXISTS username_address;
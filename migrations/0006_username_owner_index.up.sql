@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS username_owner ON username(owner, timestamp);
+CREATE INDEX IF NOT EXISTS username_address ON username(address);
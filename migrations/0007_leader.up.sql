@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS leader(
+	id INTEGER PRIMARY KEY CHECK (id = 1) DEFAULT 1,
+	holder TEXT,
+	term BIGINT NOT NULL DEFAULT 0,
+	acquired_at TIMESTAMPTZ,
+	renewed_at TIMESTAMPTZ,
+	lease_expires_at TIMESTAMPTZ
+);
+INSERT INTO leader SELECT WHERE NOT EXISTS(SELECT 1 FROM leader);
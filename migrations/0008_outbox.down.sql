@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS outbox_offset;
+DROP TABLE IF EXISTS outbox;
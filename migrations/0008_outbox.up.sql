@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS outbox(
+	id BIGSERIAL PRIMARY KEY,
+	action JSONB NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS outbox_offset(
+	sink TEXT PRIMARY KEY,
+	delivered_id BIGINT NOT NULL
+);
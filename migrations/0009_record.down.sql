@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS record;
+
+ALTER TABLE pending_action DROP COLUMN IF EXISTS record_key, DROP COLUMN IF EXISTS record_value;
+ALTER TABLE event DROP COLUMN IF EXISTS record_key, DROP COLUMN IF EXISTS record_value;
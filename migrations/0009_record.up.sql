@@ -0,0 +1,9 @@
+ALTER TABLE event ADD COLUMN IF NOT EXISTS record_key TEXT, ADD COLUMN IF NOT EXISTS record_value TEXT;
+ALTER TABLE pending_action ADD COLUMN IF NOT EXISTS record_key TEXT, ADD COLUMN IF NOT EXISTS record_value TEXT;
+
+CREATE TABLE IF NOT EXISTS record(
+	username TEXT NOT NULL,
+	key TEXT NOT NULL,
+	value TEXT NOT NULL,
+	PRIMARY KEY (username, key)
+);
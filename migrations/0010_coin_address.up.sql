@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS coin_address(
+	username TEXT NOT NULL,
+	coin TEXT NOT NULL,
+	address TEXT NOT NULL,
+	PRIMARY KEY (username, coin)
+);
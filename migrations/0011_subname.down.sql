@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS username_parent;
+ALTER TABLE username DROP COLUMN IF EXISTS parent;
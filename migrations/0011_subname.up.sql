@@ -0,0 +1,2 @@
+ALTER TABLE username ADD COLUMN IF NOT EXISTS parent TEXT;
+CREATE INDEX IF NOT EXISTS username_parent ON username(parent);
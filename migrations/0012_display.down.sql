@@ -0,0 +1 @@
+ALTER TABLE username DROP COLUMN IF EXISTS display;
@@ -0,0 +1 @@
+ALTER TABLE username ADD COLUMN IF NOT EXISTS display TEXT;
@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS pending_block(
+	block_hash TEXT PRIMARY KEY,
+	first_seen TIMESTAMPTZ NOT NULL
+);
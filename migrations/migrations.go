@@ -0,0 +1,210 @@
+package migrations
+
+import (
+	"cmp"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// advisoryLockKey serializes migrations of replicas starting at the same time.
+const advisoryLockKey = 4_657_483_920_117
+
+//go:embed *.sql
+var files embed.FS
+
+var filePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+var ErrIrreversible = errors.New("migration has no down migration")
+
+// Migration is a schema change, Down is empty when reverting it is not safe.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// All returns the embedded migrations ordered by version.
+func All() ([]Migration, error) {
+	return parse(files)
+}
+
+// parse reads the migrations of the up and down files in the root of fsys.
+func parse(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := filePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file %v", entry.Name())
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		sql, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if match[3] == "up" {
+			migration.Up = string(sql)
+		} else {
+			migration.Down = string(sql)
+		}
+	}
+
+	var migrations []Migration
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d has no up migration", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return cmp.Compare(a.Version, b.Version) })
+	return migrations, nil
+}
+
+// Statuses returns every embedded migration with the time it was applied, nil if it is pending.
+func Statuses(ctx context.Context, pool *pgxpool.Pool) ([]Status, error) {
+	var statuses []Status
+	err := withLock(ctx, pool, func(conn *pgxpool.Conn, migrations []Migration, applied map[int64]time.Time) error {
+		for _, migration := range migrations {
+			status := Status{Migration: migration}
+			if appliedAt, ok := applied[migration.Version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// Up applies every pending migration in its own transaction and returns the applied ones.
+func Up(ctx context.Context, pool *pgxpool.Pool) ([]Migration, error) {
+	var done []Migration
+	err := withLock(ctx, pool, func(conn *pgxpool.Conn, migrations []Migration, applied map[int64]time.Time) error {
+		for _, migration := range migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, migration.Up); err != nil {
+					return err
+				}
+				_, err := tx.Exec(
+					ctx, "INSERT INTO schema_migrations(version, name) VALUES ($1, $2);", migration.Version, migration.Name,
+				)
+				return err
+			}); err != nil {
+				return fmt.Errorf("failed to apply migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			slog.Info("Applied migration", "version", migration.Version, "name", migration.Name)
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the given number of most recently applied migrations and returns the reverted ones. It stops at the
+// first migration without a down migration.
+func Down(ctx context.Context, pool *pgxpool.Pool, steps int) ([]Migration, error) {
+	var done []Migration
+	err := withLock(ctx, pool, func(conn *pgxpool.Conn, migrations []Migration, applied map[int64]time.Time) error {
+		for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("%w: %d_%s", ErrIrreversible, migration.Version, migration.Name)
+			}
+			if err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, migration.Down); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, "DELETE FROM schema_migrations WHERE version = $1;", migration.Version)
+				return err
+			}); err != nil {
+				return fmt.Errorf("failed to revert migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			slog.Info("Reverted migration", "version", migration.Version, "name", migration.Name)
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// withLock runs f holding the migrations advisory lock on a dedicated connection.
+func withLock(
+	ctx context.Context,
+	pool *pgxpool.Pool,
+	f func(conn *pgxpool.Conn, migrations []Migration, applied map[int64]time.Time) error,
+) error {
+	migrations, err := All()
+	if err != nil {
+		return err
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err = conn.Exec(ctx, "SELECT pg_advisory_lock($1);", advisoryLockKey); err != nil {
+		return fmt.Errorf("failed to acquire migrations lock: %w", err)
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1);", advisoryLockKey)
+
+	if _, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations(
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);`); err != nil {
+		return err
+	}
+
+	rows, err := conn.Query(ctx, "SELECT version, applied_at FROM schema_migrations;")
+	if err != nil {
+		return err
+	}
+	applied := map[int64]time.Time{}
+	var (
+		version   int64
+		appliedAt time.Time
+	)
+	if _, err = pgx.ForEachRow(rows, []any{&version, &appliedAt}, func() error {
+		applied[version] = appliedAt
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	return f(conn, migrations, applied)
+}
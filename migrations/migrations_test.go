@@ -0,0 +1,64 @@
+package migrations
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParse(t *testing.T) {
+	migrations, err := parse(fstest.MapFS{
+		"10_ten.up.sql":   {Data: []byte("CREATE TABLE ten();")},
+		"10_ten.down.sql": {Data: []byte("DROP TABLE ten;")},
+		"2_two.up.sql":    {Data: []byte("CREATE TABLE two();")},
+		"0001_one.up.sql": {Data: []byte("CREATE TABLE one();")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Migration{
+		{Version: 1, Name: "one", Up: "CREATE TABLE one();"},
+		{Version: 2, Name: "two", Up: "CREATE TABLE two();"},
+		{Version: 10, Name: "ten", Up: "CREATE TABLE ten();", Down: "DROP TABLE ten;"},
+	}
+	if !reflect.DeepEqual(migrations, want) {
+		t.Errorf("migrations %+v, want %+v", migrations, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for name, test := range map[string]struct {
+		fsys fstest.MapFS
+		want string
+	}{
+		"unexpected file": {
+			fsys: fstest.MapFS{"0001_one.sql": {Data: []byte("CREATE TABLE one();")}},
+			want: "unexpected migration file 0001_one.sql",
+		},
+		"down file only": {
+			fsys: fstest.MapFS{"0001_one.down.sql": {Data: []byte("DROP TABLE one;")}},
+			want: "migration 1 has no up migration",
+		},
+	} {
+		if _, err := parse(test.fsys); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%v: error %v, want %q", name, err, test.want)
+		}
+	}
+}
+
+// TestAll checks that the embedded migrations are numbered without gaps and revertible down to the initial schema.
+func TestAll(t *testing.T) {
+	migrations, err := All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, migration := range migrations {
+		if migration.Version != int64(i+1) {
+			t.Errorf("migration %d_%s, want version %d", migration.Version, migration.Name, i+1)
+		}
+		if migration.Down == "" && migration.Version != 1 {
+			t.Errorf("migration %d_%s has no down migration", migration.Version, migration.Name)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+type FeeSchedule struct {
+	ProtocolVersion int       `json:"protocolVersion" example:"2"`
+	ActivatedAt     time.Time `json:"activatedAt" example:"2026-01-01T00:00:00Z"`
+	Enabled         bool      `json:"enabled" example:"true"`
+	Treasury        string    `json:"treasury,omitempty" example:"keeta_aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"`
+	BaseToken       string    `json:"baseToken,omitempty" example:"keeta_cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc"`
+	Tiers           []FeeTier `json:"tiers"`
+}
+
+type FeeTier struct {
+	MinLength int    `json:"minLength" example:"1"`
+	MaxLength int    `json:"maxLength" example:"3"`
+	Amount    string `json:"amount" example:"1000000"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+type PendingAction struct {
+	Type      string    `json:"type" example:"inscribe" enums:"inscribe,transfer,set_primary_name,set_cid,set_record,set_address,clear_primary_name,clear_cid,clear_record,assign_subname" db:"type"`
+	BlockHash string    `json:"blockHash" example:"0F3E5A6B7C8D9E0F1A2B3C4D5E6F7A8B9C0D1E2F3A4B5C6D7E8F9A0B1C2D3E4F" db:"block_hash"`
+	Position  int       `json:"position" example:"0" db:"position"`
+	Account   string    `json:"account" example:"keeta_aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" db:"account"`
+	Token     string    `json:"token" example:"keeta_aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" db:"token"`
+	Username  *string   `json:"username,omitempty" example:"username" db:"username"`
+	Owner     *string   `json:"owner,omitempty" example:"keeta_bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb" db:"owner"`
+	CID       *string   `json:"cid,omitempty" example:"Qmaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" db:"cid"`
+	Key       *string   `json:"key,omitempty" example:"avatar" db:"record_key"`
+	Value     *string   `json:"value,omitempty" example:"https://example.com/avatar.png" db:"record_value"`
+	Timestamp time.Time `json:"timestamp" example:"2025-11-25T11:22:33.123Z" db:"timestamp"`
+	FirstSeen time.Time `json:"firstSeen" example:"2025-11-25T11:22:34.456Z" db:"first_seen"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+type Status struct {
+	Page               int             `json:"page" example:"42"`
+	LastBlockHash      *string         `json:"lastBlockHash,omitempty" example:"0F3E5A6B7C8D9E0F1A2B3C4D5E6F7A8B9C0D1E2F3A4B5C6D7E8F9A0B1C2D3E4F"`
+	LastBlockTimestamp *time.Time      `json:"lastBlockTimestamp,omitempty" example:"2025-11-25T11:22:33.123Z"`
+	PendingBlocks      int             `json:"pendingBlocks" example:"0"`
+	Health             Health          `json:"health"`
+	Consensus          ConsensusStatus `json:"consensus"`
+	Leader             Leader          `json:"leader"`
+}
+
+type ConsensusStatus struct {
+	Quorum           int           `json:"quorum" example:"2"`
+	Sources          []Source      `json:"sources"`
+	LastAgreedAt     *time.Time    `json:"lastAgreedAt,omitempty" example:"2025-11-25T11:22:33.123Z"`
+	Disagreements    uint          `json:"disagreements" example:"0"`
+	LastDisagreement *Disagreement `json:"lastDisagreement,omitempty"`
+}
+
+type Source struct {
+	URL           string     `json:"url" example:"https://rep1.test.network.api.keeta.com"`
+	InQuorum      bool       `json:"inQuorum" example:"true"`
+	Fingerprint   string     `json:"fingerprint,omitempty" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+	Error         string     `json:"error,omitempty" example:"unexpected status 502 Bad Gateway"`
+	LastFetchedAt *time.Time `json:"lastFetchedAt,omitempty" example:"2025-11-25T11:22:33.123Z"`
+}
+
+type Disagreement struct {
+	Page         int               `json:"page" example:"42"`
+	Timestamp    time.Time         `json:"timestamp" example:"2025-11-25T11:22:33.123Z"`
+	QuorumMet    bool              `json:"quorumMet" example:"true"`
+	Fingerprints map[string]string `json:"fingerprints"`
+}
+
+type Health struct {
+	Ready               bool       `json:"ready" example:"true"`
+	ConsecutiveFailures int        `json:"consecutiveFailures" example:"0"`
+	Restarts            uint       `json:"restarts" example:"0"`
+	LastError           string     `json:"lastError,omitempty" example:"failed to fetch page metadata of page 42: unexpected status 502 Bad Gateway"`
+	LastFailureAt       *time.Time `json:"lastFailureAt,omitempty" example:"2025-11-25T11:22:33.123Z"`
+	LastSuccessAt       *time.Time `json:"lastSuccessAt,omitempty" example:"2025-11-25T11:22:33.123Z"`
+}
+
+// Leader is the replica running the indexer, every replica serves the API.
+type Leader struct {
+	InstanceID     string     `json:"instanceId" example:"kns-indexer-1"`
+	IsLeader       bool       `json:"isLeader" example:"true"`
+	Holder         *string    `json:"holder,omitempty" example:"kns-indexer-1"`
+	Term           int64      `json:"term" example:"3"`
+	LeaseExpiresAt *time.Time `json:"leaseExpiresAt,omitempty" example:"2025-11-25T11:22:33.123Z"`
+}
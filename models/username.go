@@ -9,4 +9,12 @@ type Username struct {
 	CID       *string   `json:"cid,omitempty" example:"Qmaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" db:"cid"`
 	IsPrimary bool      `json:"isPrimary" example:"false" db:"is_primary"`
 	Timestamp time.Time `json:"timestamp" example:"2025-11-25T11:22:33.123Z" db:"timestamp"`
+	// Parent is the name a subname is under, whose owner controls it.
+	Parent *string `json:"parent,omitempty" example:"alice" db:"parent"`
+	// Display is the name in the form it was inscribed in when that differs from its normalized username.
+	Display *string `json:"display,omitempty" example:"Alice" db:"display"`
+	// Records are the text records by key, only filled in when requested.
+	Records map[string]string `json:"records,omitempty" db:"-"`
+	// Addresses are the addresses on other chains by coin symbol, only filled in with the records.
+	Addresses map[string]string `json:"addresses,omitempty" db:"-"`
 }
@@ -0,0 +1,178 @@
+package outbox
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"kns-indexer/store"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func record(t *testing.T, db store.Store, usernames ...string) {
+	t.Helper()
+	ctx := context.Background()
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, username := range usernames {
+		action := store.Action{
+			Type: "inscribe", BlockHash: username, Account: "keeta_" + username, Token: "keeta_" + username,
+			Username: username, Timestamp: time.Date(2025, 12, 3, 0, i, 0, 0, time.UTC),
+		}
+		if err = tx.RecordEvent(ctx, action); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = tx.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// decode returns the usernames of the NDJSON entries and fails on IDs that do not increase.
+func decode(t *testing.T, r io.Reader) []string {
+	t.Helper()
+	var (
+		usernames []string
+		lastID    int64
+	)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var entry store.OutboxEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry.ID <= lastID {
+			t.Fatalf("ID %d after %d", entry.ID, lastID)
+		}
+		lastID = entry.ID
+		usernames = append(usernames, entry.Action.Username)
+	}
+	return usernames
+}
+
+func TestParse(t *testing.T) {
+	for spec, want := range map[string]EventSink{
+		"stdout":              NewWriterSink("stdout", os.Stdout),
+		"file:/tmp/kns":       NewFileSink("/tmp/kns"),
+		"https://example.com": NewHTTPSink("https://example.com"),
+	} {
+		sink, err := Parse(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reflect.TypeOf(sink) != reflect.TypeOf(want) || sink.Name() != spec {
+			t.Errorf("sink of %q is %T named %q", spec, sink, sink.Name())
+		}
+	}
+	for _, spec := range []string{"", "file:", "nats://localhost"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("parsed invalid sink %q", spec)
+		}
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	db := store.NewMemory()
+	record(t, db, "alice", "bob", "carol")
+
+	path := filepath.Join(t.TempDir(), "kns.ndjson")
+	sink := NewFileSink(path)
+	for range 3 {
+		if _, err := db.RelayOutbox(context.Background(), sink.Name(), 2, func(entries []store.OutboxEntry) error {
+			return sink.Deliver(context.Background(), entries)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := decode(t, bytes.NewReader(b)); !reflect.DeepEqual(got, []string{"alice", "bob", "carol"}) {
+		t.Fatalf("file has %v, want every username once", got)
+	}
+}
+
+// TestRelay relays to an HTTP sink that fails its first request, which is delivered again.
+func TestRelay(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		requests  int
+		usernames []string
+		done      = make(chan struct{})
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if requests++; requests == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("Content-Type") != "application/x-ndjson" {
+			t.Errorf("content type %q", r.Header.Get("Content-Type"))
+		}
+		if usernames = append(usernames, decode(t, r.Body)...); len(usernames) == 3 {
+			close(done)
+		}
+	}))
+	defer server.Close()
+
+	db := store.NewMemory()
+	record(t, db, "alice", "bob", "carol")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Relay(ctx, db, NewHTTPSink(server.URL), 2, time.Millisecond)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("relay did not deliver the outbox")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(usernames, []string{"alice", "bob", "carol"}) {
+		t.Fatalf("sink got %v, want every username once", usernames)
+	}
+	if requests != 3 {
+		t.Fatalf("%d requests, want a failed one and two batches", requests)
+	}
+}
+
+func TestHTTPSinkFailsOnStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	err := NewHTTPSink(server.URL).Deliver(context.Background(), []store.OutboxEntry{{ID: 1}})
+	if err == nil {
+		t.Fatal("delivery answered 400 succeeded")
+	}
+}
+
+func TestHTTPSinkHidesCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+
+	sink := NewHTTPSink(strings.Replace(server.URL, "://", "://user:secret@", 1) + "/hook?token=secret")
+	if want := server.URL + "/hook"; sink.Name() != want {
+		t.Errorf("name %q, want %q", sink.Name(), want)
+	}
+	err := sink.Deliver(context.Background(), []store.OutboxEntry{{ID: 1}})
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("delivery to a closed server error %v, want one without the credentials", err)
+	}
+}
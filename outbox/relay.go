@@ -0,0 +1,53 @@
+package outbox
+
+import (
+	"context"
+	"kns-indexer/metrics"
+	"kns-indexer/store"
+	"log/slog"
+	"time"
+)
+
+const maxRetryDelay = time.Minute
+
+var (
+	delivered = metrics.NewCounter("kns_outbox_delivered_total", "Outbox entries delivered to an event sink")
+	failures  = metrics.NewCounter("kns_outbox_failures_total", "Failed deliveries of outbox batches to an event sink")
+)
+
+// Relay delivers the outbox to the sink in batches of up to batchSize entries until the context is done. It polls
+// every pollInterval once the sink is up to date and retries a failed batch with exponential backoff.
+func Relay(ctx context.Context, db store.Store, sink EventSink, batchSize int, pollInterval time.Duration) {
+	name := sink.Name()
+	retryDelay := pollInterval
+	for {
+		n, err := db.RelayOutbox(ctx, name, batchSize, func(entries []store.OutboxEntry) error {
+			return sink.Deliver(ctx, entries)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+
+		var delay time.Duration
+		switch {
+		case err != nil:
+			failures.Inc("sink", name)
+			slog.Error("Delivering outbox failed, retrying", "sink", name, "error", err, "delay", retryDelay)
+			delay, retryDelay = retryDelay, min(retryDelay*2, maxRetryDelay)
+		case n < batchSize:
+			delivered.Add(float64(n), "sink", name)
+			delay, retryDelay = pollInterval, pollInterval
+		default:
+			// more entries are waiting
+			delivered.Add(float64(n), "sink", name)
+			retryDelay = pollInterval
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Package outbox relays the actions recorded in the outbox of the store to event sinks, at least once and in order.
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"kns-indexer/store"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const httpTimeout = 30 * time.Second
+
+// EventSink receives the outbox entries. A batch is delivered again until Deliver succeeds, so a sink sees every
+// entry at least once and should deduplicate by ID if it cares.
+type EventSink interface {
+	// Name identifies the offset of the sink in the store and should stay the same across restarts.
+	Name() string
+	Deliver(ctx context.Context, entries []store.OutboxEntry) error
+}
+
+// Parse returns the sink of a spec: stdout, file:path or an http(s) URL. The stdout sink relies on logs going to
+// stderr.
+func Parse(spec string) (EventSink, error) {
+	switch {
+	case spec == "stdout":
+		return NewWriterSink(spec, os.Stdout), nil
+	case strings.HasPrefix(spec, "file:"):
+		if path := strings.TrimPrefix(spec, "file:"); path != "" {
+			return NewFileSink(path), nil
+		}
+	case strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://"):
+		if _, err := url.Parse(spec); err != nil {
+			return nil, fmt.Errorf("invalid event sink URL: %w", err)
+		}
+		return NewHTTPSink(spec), nil
+	}
+	return nil, fmt.Errorf("unknown event sink %q, expected stdout, file:path or an http(s) URL", spec)
+}
+
+// ndjson encodes the entries as one JSON object per line.
+func ndjson(entries []store.OutboxEntry) ([]byte, error) {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return nil, err
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// WriterSink writes the entries as NDJSON to a writer.
+type WriterSink struct {
+	name string
+	mu   sync.Mutex
+	w    io.Writer
+}
+
+func NewWriterSink(name string, w io.Writer) *WriterSink {
+	return &WriterSink{name: name, w: w}
+}
+
+func (s *WriterSink) Name() string {
+	return s.name
+}
+
+func (s *WriterSink) Deliver(_ context.Context, entries []store.OutboxEntry) error {
+	b, err := ndjson(entries)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(b)
+	return err
+}
+
+// FileSink appends the entries as NDJSON to a file, which is reopened for every batch so it can be rotated.
+type FileSink struct {
+	path string
+}
+
+func NewFileSink(path string) *FileSink {
+	return &FileSink{path: path}
+}
+
+func (s *FileSink) Name() string {
+	return "file:" + s.path
+}
+
+func (s *FileSink) Deliver(_ context.Context, entries []store.OutboxEntry) error {
+	b, err := ndjson(entries)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(b); err == nil {
+		// the offset moves past the entries once this returns, so they have to be on disk
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// HTTPSink POSTs every batch as NDJSON to a URL, any status but 2xx fails the delivery.
+type HTTPSink struct {
+	url    string
+	name   string
+	client *http.Client
+}
+
+func NewHTTPSink(rawURL string) *HTTPSink {
+	return &HTTPSink{url: rawURL, name: redactURL(rawURL), client: &http.Client{Timeout: httpTimeout}}
+}
+
+// Name is the URL without the user info, query and fragment, which may hold credentials.
+func (s *HTTPSink) Name() string {
+	return s.name
+}
+
+// redactURL returns the scheme, host and path of the URL.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "invalid URL"
+	}
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String()
+}
+
+func (s *HTTPSink) Deliver(ctx context.Context, entries []store.OutboxEntry) error {
+	b, err := ndjson(entries)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("event sink %s: invalid request", s.name)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// the error quotes the URL
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("event sink %s unreachable: %w", s.name, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("event sink %s responded %s", s.name, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"kns-indexer/config"
+	"kns-indexer/events"
+	"kns-indexer/handlers"
+	"kns-indexer/indexer"
+	"kns-indexer/store"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/logger"
+	"github.com/gofiber/swagger/v2"
+)
+
+// serve runs the API until the context is done.
+func serve(ctx context.Context, cfg config.Config, ix *indexer.Indexer, db store.Store) error {
+	bus := events.NewBus()
+	go bus.Follow(ctx, ix, db)
+
+	app := newApp(cfg, ix, db, bus)
+
+	go func() {
+		<-ctx.Done()
+		if err := app.Shutdown(); err != nil {
+			slog.Error("failed to shut down API", "error", err)
+		}
+	}()
+
+	slog.Info("Starting API on " + cfg.API.ListenAddr)
+
+	return app.Listen(cfg.API.ListenAddr)
+}
+
+// newApp returns the API serving the store and the state of the indexer and streaming the actions published on the bus.
+func newApp(cfg config.Config, ix *indexer.Indexer, db store.Store, bus *events.Bus) *fiber.App {
+	app := fiber.New()
+	app.Use(logger.New())
+
+	app.Get("/*", handlers.NewDomainHandler(db, cfg.API.IPFSGateway, cfg.API.GatewayDomain))
+
+	app.Get("/docs/*", swagger.HandlerDefault)
+
+	app.Get("/usernames", handlers.NewGetUsernamesHandler(db))
+	app.Get("/usernames/owner/:owner", handlers.NewGetOwnerUsernamesHandler(db))
+	app.Get("/usernames/:username/records", handlers.NewGetRecordsHandler(db))
+	app.Get("/usernames/:username/addresses/:coin", handlers.NewGetAddressHandler(db))
+	app.Get("/usernames/:username", handlers.NewGetUsernameHandler(db))
+	app.Get("/primary-username/:owner", handlers.NewGetPrimaryUsernameHandler(db))
+	app.Get("/pending-actions", handlers.NewGetPendingActionsHandler(db))
+	app.Get("/events", handlers.NewEventsHandler(bus))
+	app.Get("/fees", handlers.NewGetFeesHandler(ix))
+	app.Get("/status", handlers.NewGetStatusHandler(ix))
+	app.Get("/ready", handlers.NewGetReadyHandler(ix))
+	app.Get("/metrics", handlers.NewMetricsHandler())
+
+	return app
+}
@@ -0,0 +1,499 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"kns-indexer/models"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory is a Store kept in memory, for tests and replaying the history without touching the database.
+type Memory struct {
+	mu    sync.RWMutex
+	state memoryState
+
+	// relayMu serializes the relays and guards the offsets of the sinks, which outlive Reset.
+	relayMu sync.Mutex
+	offsets map[string]int64
+}
+
+type memoryState struct {
+	usernames   map[string]models.Username
+	events      []Action
+	deadLetters []memoryDeadLetter
+	quarantined map[string]bool
+	pending     []models.PendingAction
+	// pendingBlocks are the first seen times of the pending blocks by block hash
+	pendingBlocks map[string]time.Time
+	records       map[recordKey]string
+	addresses     map[recordKey]string
+	outbox        []OutboxEntry
+	// outboxID is the last outbox entry ID, kept on Reset so IDs are never reused.
+	outboxID int64
+
+	page               int
+	lastBlockTimestamp *time.Time
+	lastBlockHash      *string
+}
+
+type recordKey struct {
+	username string
+	key      string
+}
+
+type memoryDeadLetter struct {
+	StoredDeadLetter
+	blockHash string
+	err       string
+	replayed  bool
+}
+
+func (s memoryState) clone() memoryState {
+	s.usernames = maps.Clone(s.usernames)
+	s.events = slices.Clone(s.events)
+	s.deadLetters = slices.Clone(s.deadLetters)
+	s.quarantined = maps.Clone(s.quarantined)
+	s.pending = slices.Clone(s.pending)
+	s.pendingBlocks = maps.Clone(s.pendingBlocks)
+	s.records = maps.Clone(s.records)
+	s.addresses = maps.Clone(s.addresses)
+	s.outbox = slices.Clone(s.outbox)
+	return s
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		state: memoryState{
+			usernames: map[string]models.Username{}, quarantined: map[string]bool{}, records: map[recordKey]string{},
+			addresses: map[recordKey]string{}, page: 1,
+		},
+		offsets: map[string]int64{},
+	}
+}
+
+func (db *Memory) Username(_ context.Context, username string) (models.Username, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	u, ok := db.state.usernames[username]
+	if !ok {
+		return models.Username{}, ErrNotFound
+	}
+	return u, nil
+}
+
+func (db *Memory) Usernames(
+	_ context.Context, owner string, descending bool, limit, offset int,
+) ([]models.Username, uint, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	usernames := []models.Username{}
+	for _, u := range db.state.usernames {
+		if owner == "" || u.Owner == owner {
+			usernames = append(usernames, u)
+		}
+	}
+	slices.SortFunc(usernames, func(a, b models.Username) int {
+		order := a.Timestamp.Compare(b.Timestamp)
+		if descending {
+			order = -order
+		}
+		return cmp.Or(order, strings.Compare(a.Username, b.Username))
+	})
+
+	total := uint(len(usernames))
+	usernames = usernames[min(offset, len(usernames)):]
+	return usernames[:min(limit, len(usernames))], total, nil
+}
+
+func (db *Memory) PrimaryUsername(_ context.Context, owner string) (models.Username, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	for _, u := range db.state.usernames {
+		if u.Owner == owner && u.IsPrimary {
+			return u, nil
+		}
+	}
+	return models.Username{}, ErrNotFound
+}
+
+func (db *Memory) AllUsernames(context.Context) ([]models.Username, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	usernames := append([]models.Username{}, slices.Collect(maps.Values(db.state.usernames))...)
+	slices.SortFunc(usernames, func(a, b models.Username) int { return strings.Compare(a.Username, b.Username) })
+	return usernames, nil
+}
+
+func (db *Memory) Events(_ context.Context, username string) ([]Action, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	events := []Action{}
+	for _, event := range db.state.events {
+		if event.Username == username {
+			events = append(events, event)
+		}
+	}
+	slices.SortStableFunc(events, func(a, b Action) int {
+		return cmp.Or(a.Timestamp.Compare(b.Timestamp), a.Position-b.Position)
+	})
+	return events, nil
+}
+
+func (db *Memory) Records(_ context.Context, usernames ...string) (map[string]map[string]string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return byUsername(db.state.records, usernames), nil
+}
+
+func (db *Memory) Addresses(_ context.Context, usernames ...string) (map[string]map[string]string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return byUsername(db.state.addresses, usernames), nil
+}
+
+// byUsername groups the values of the usernames by username and key.
+func byUsername(values map[recordKey]string, usernames []string) map[string]map[string]string {
+	records := map[string]map[string]string{}
+	for key, value := range values {
+		if !slices.Contains(usernames, key.username) {
+			continue
+		}
+		if records[key.username] == nil {
+			records[key.username] = map[string]string{}
+		}
+		records[key.username][key.key] = value
+	}
+	return records
+}
+
+func (db *Memory) PendingActions(_ context.Context, account string) ([]models.PendingAction, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	pending := []models.PendingAction{}
+	for _, action := range db.state.pending {
+		if account == "" || action.Account == account {
+			pending = append(pending, action)
+		}
+	}
+	slices.SortStableFunc(pending, func(a, b models.PendingAction) int {
+		return cmp.Or(a.Timestamp.Compare(b.Timestamp), a.Position-b.Position)
+	})
+	return pending, nil
+}
+
+func (db *Memory) Begin(context.Context) (Tx, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return &memoryTx{db: db, state: db.state.clone()}, nil
+}
+
+func (db *Memory) LoadCursor(context.Context) (int, *time.Time, *string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.state.page, db.state.lastBlockTimestamp, db.state.lastBlockHash, nil
+}
+
+func (db *Memory) PendingBlocks(context.Context) (map[string]time.Time, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return maps.Clone(db.state.pendingBlocks), nil
+}
+
+func (db *Memory) UnreplayedDeadLetters(context.Context) ([]StoredDeadLetter, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	var deadLetters []StoredDeadLetter
+	for _, deadLetter := range db.state.deadLetters {
+		if !deadLetter.replayed {
+			deadLetters = append(deadLetters, deadLetter.StoredDeadLetter)
+		}
+	}
+	return deadLetters, nil
+}
+
+func (db *Memory) SetDeadLetterError(_ context.Context, id int64, deadLetterErr string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for i := range db.state.deadLetters {
+		if db.state.deadLetters[i].ID == id {
+			db.state.deadLetters[i].err = deadLetterErr
+		}
+	}
+	return nil
+}
+
+func (db *Memory) Migrate(context.Context) error {
+	return nil
+}
+
+func (db *Memory) Reset(context.Context) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	outboxID := db.state.outboxID
+	db.state = NewMemory().state
+	db.state.outboxID = outboxID
+	return nil
+}
+
+func (db *Memory) RelayOutbox(
+	_ context.Context, sink string, limit int, deliver func([]OutboxEntry) error,
+) (int, error) {
+	db.relayMu.Lock()
+	defer db.relayMu.Unlock()
+
+	db.mu.RLock()
+	offset := db.offsets[sink]
+	i, _ := slices.BinarySearchFunc(db.state.outbox, offset+1, func(entry OutboxEntry, id int64) int {
+		return cmp.Compare(entry.ID, id)
+	})
+	entries := slices.Clone(db.state.outbox[i:min(i+limit, len(db.state.outbox))])
+	db.mu.RUnlock()
+
+	if len(entries) == 0 {
+		return 0, nil
+	}
+	if err := deliver(entries); err != nil {
+		return 0, err
+	}
+	db.offsets[sink] = entries[len(entries)-1].ID
+	return len(entries), nil
+}
+
+func (db *Memory) Close() {}
+
+// memoryTx applies changes to a copy of the state that replaces the committed one on Commit.
+type memoryTx struct {
+	db    *Memory
+	state memoryState
+	done  bool
+}
+
+func (t *memoryTx) InsertUsername(
+	_ context.Context, username, display, address, owner string, timestamp time.Time,
+) (bool, error) {
+	if _, ok := t.state.usernames[username]; ok {
+		return false, nil
+	}
+	t.state.usernames[username] = models.Username{
+		Username: username, Address: address, Owner: owner, Timestamp: timestamp, Display: nullIfEmpty(display),
+	}
+	return true, nil
+}
+
+func (t *memoryTx) InsertSubname(
+	_ context.Context, username, display, parent, address, owner string, timestamp time.Time,
+) (bool, error) {
+	if p, ok := t.state.usernames[parent]; !ok || p.Owner != owner {
+		return false, nil
+	}
+	if _, ok := t.state.usernames[username]; ok {
+		return false, nil
+	}
+	t.state.usernames[username] = models.Username{
+		Username: username, Address: address, Owner: owner, Timestamp: timestamp, Parent: &parent,
+		Display: nullIfEmpty(display),
+	}
+	return true, nil
+}
+
+func (t *memoryTx) AssignSubname(_ context.Context, address, owner, to string) (string, error) {
+	for username, u := range t.state.usernames {
+		if u.Address != address || u.Parent == nil || t.state.usernames[*u.Parent].Owner != owner {
+			continue
+		}
+		u.Owner = to
+		t.state.usernames[username] = u
+		for key := range t.state.addresses {
+			if key.username == username {
+				delete(t.state.addresses, key)
+			}
+		}
+		return username, nil
+	}
+	return "", nil
+}
+
+// update changes the username with the given token owned by owner and returns it, empty if there is none.
+func (t *memoryTx) update(address, owner string, change func(u *models.Username)) string {
+	for username, u := range t.state.usernames {
+		if u.Address == address && u.Owner == owner {
+			change(&u)
+			t.state.usernames[username] = u
+			return username
+		}
+	}
+	return ""
+}
+
+func (t *memoryTx) SetPrimaryName(_ context.Context, address, owner string) (string, error) {
+	username := t.update(address, owner, func(u *models.Username) { u.IsPrimary = true })
+	if username == "" {
+		return "", nil
+	}
+	for other, u := range t.state.usernames {
+		if u.Address != address && u.Owner == owner {
+			u.IsPrimary = false
+			t.state.usernames[other] = u
+		}
+	}
+	return username, nil
+}
+
+func (t *memoryTx) SetCid(_ context.Context, address, owner, cid string) (string, error) {
+	return t.update(address, owner, func(u *models.Username) { u.CID = &cid }), nil
+}
+
+func (t *memoryTx) TransferUsername(_ context.Context, address, from, to string) (string, error) {
+	username := t.update(address, from, func(u *models.Username) { u.Owner = to })
+	for key := range t.state.addresses {
+		if username != "" && key.username == username {
+			delete(t.state.addresses, key)
+		}
+	}
+	return username, nil
+}
+
+func (t *memoryTx) SetRecord(_ context.Context, address, owner, key, value string) (string, error) {
+	username := t.update(address, owner, func(*models.Username) {})
+	if username != "" {
+		t.state.records[recordKey{username, key}] = value
+	}
+	return username, nil
+}
+
+func (t *memoryTx) SetAddress(_ context.Context, address, owner, coin, coinAddress string) (string, error) {
+	username := t.update(address, owner, func(*models.Username) {})
+	if username != "" {
+		t.state.addresses[recordKey{username, coin}] = coinAddress
+	}
+	return username, nil
+}
+
+func (t *memoryTx) ClearPrimaryName(_ context.Context, address, owner string) (string, error) {
+	return t.update(address, owner, func(u *models.Username) { u.IsPrimary = false }), nil
+}
+
+func (t *memoryTx) ClearCid(_ context.Context, address, owner string) (string, error) {
+	return t.update(address, owner, func(u *models.Username) { u.CID = nil }), nil
+}
+
+func (t *memoryTx) ClearRecord(_ context.Context, address, owner, key string) (string, error) {
+	username := t.update(address, owner, func(*models.Username) {})
+	delete(t.state.records, recordKey{username, key})
+	return username, nil
+}
+
+func (t *memoryTx) RecordEvent(_ context.Context, action Action) error {
+	for _, event := range t.state.events {
+		if event.BlockHash == action.BlockHash && event.Position == action.Position {
+			return nil
+		}
+	}
+	t.state.events = append(t.state.events, action)
+	t.state.outboxID++
+	t.state.outbox = append(t.state.outbox, OutboxEntry{ID: t.state.outboxID, Action: action})
+	return nil
+}
+
+func (t *memoryTx) InsertDeadLetter(_ context.Context, deadLetter DeadLetter) error {
+	raw, err := json.Marshal(deadLetter.Raw)
+	if err != nil {
+		return err
+	}
+	deadLetterContext, err := json.Marshal(deadLetter.Context)
+	if err != nil {
+		return err
+	}
+
+	// the same item is dead-lettered once, like the unique index of the other stores
+	position := -1
+	if deadLetter.Position != nil {
+		position = *deadLetter.Position
+	}
+	for _, stored := range t.state.deadLetters {
+		storedPosition := -1
+		if stored.Position != nil {
+			storedPosition = *stored.Position
+		}
+		if stored.Stage == deadLetter.Stage && stored.blockHash == deadLetter.BlockHash && storedPosition == position &&
+			string(stored.Raw) == string(raw) {
+			return nil
+		}
+	}
+
+	t.state.deadLetters = append(t.state.deadLetters, memoryDeadLetter{
+		StoredDeadLetter: StoredDeadLetter{
+			ID:       int64(len(t.state.deadLetters) + 1),
+			Stage:    deadLetter.Stage,
+			Position: deadLetter.Position,
+			Raw:      raw,
+			Context:  deadLetterContext,
+		},
+		blockHash: deadLetter.BlockHash,
+		err:       deadLetter.Err.Error(),
+	})
+	return nil
+}
+
+func (t *memoryTx) MarkDeadLetterReplayed(_ context.Context, id int64) error {
+	for i := range t.state.deadLetters {
+		if t.state.deadLetters[i].ID == id {
+			t.state.deadLetters[i].replayed = true
+		}
+	}
+	return nil
+}
+
+func (t *memoryTx) QuarantineBlock(_ context.Context, blockHash, _ string, _ any, _ time.Time) error {
+	t.state.quarantined[blockHash] = true
+	return nil
+}
+
+func (t *memoryTx) ReplacePendingActions(_ context.Context, actions []Action, firstSeen map[string]time.Time) error {
+	t.state.pending, t.state.pendingBlocks = nil, maps.Clone(firstSeen)
+	for _, action := range actions {
+		t.state.pending = append(t.state.pending, models.PendingAction{
+			Type:      action.Type,
+			BlockHash: action.BlockHash,
+			Position:  action.Position,
+			Account:   action.Account,
+			Token:     action.Token,
+			Username:  nullIfEmpty(action.Username),
+			Owner:     nullIfEmpty(action.Owner),
+			CID:       nullIfEmpty(action.CID),
+			Key:       nullIfEmpty(action.Key),
+			Value:     nullIfEmpty(action.Value),
+			Timestamp: action.Timestamp,
+			FirstSeen: firstSeen[action.BlockHash],
+		})
+	}
+	return nil
+}
+
+func (t *memoryTx) SaveCursor(_ context.Context, page int, lastBlockTimestamp *time.Time, lastBlockHash *string) error {
+	t.state.page, t.state.lastBlockTimestamp, t.state.lastBlockHash = page, lastBlockTimestamp, lastBlockHash
+	return nil
+}
+
+func (t *memoryTx) Commit(context.Context) error {
+	if t.done {
+		return errors.New("transaction closed")
+	}
+	t.done = true
+	t.db.mu.Lock()
+	defer t.db.mu.Unlock()
+	t.db.state = t.state
+	return nil
+}
+
+func (t *memoryTx) Rollback(context.Context) error {
+	t.done = true
+	return nil
+}
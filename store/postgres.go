@@ -0,0 +1,574 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kns-indexer/migrations"
+	"kns-indexer/models"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrNotLeader = errors.New("leadership lost")
+
+type Postgres struct {
+	Pool *pgxpool.Pool
+	// Term fences the commits of the indexer to a leadership term, nil to commit unconditionally.
+	Term *Term
+}
+
+func OpenPostgres(ctx context.Context, databaseURL string) (*Postgres, error) {
+	pool, err := pgxpool.New(ctx, databaseURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Postgres{Pool: pool}, nil
+}
+
+// WithTerm returns a store sharing the pool whose commits are fenced to the leadership term.
+func (db *Postgres) WithTerm(term *Term) *Postgres {
+	return &Postgres{Pool: db.Pool, Term: term}
+}
+
+func (db *Postgres) Username(ctx context.Context, username string) (models.Username, error) {
+	rows, err := db.Pool.Query(
+		ctx,
+		"SELECT username, address, owner, cid, is_primary, timestamp, parent, display FROM username WHERE username = $1;",
+		username,
+	)
+	if err != nil {
+		return models.Username{}, err
+	}
+	u, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[models.Username])
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Username{}, ErrNotFound
+	}
+	return u, err
+}
+
+func (db *Postgres) Usernames(
+	ctx context.Context, owner string, descending bool, limit, offset int,
+) ([]models.Username, uint, error) {
+	conn, err := db.Pool.Acquire(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Release()
+
+	var total uint
+	if err = conn.QueryRow(
+		ctx, "SELECT COUNT(*) FROM username WHERE $1 = '' OR owner = $1;", owner,
+	).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	sortOrder := "ASC"
+	if descending {
+		sortOrder = "DESC"
+	}
+	rows, err := conn.Query(
+		ctx,
+		`SELECT username, address, owner, cid, is_primary, timestamp, parent, display FROM username
+		WHERE $1 = '' OR owner = $1 ORDER BY timestamp `+sortOrder+`, username LIMIT $2 OFFSET $3;`,
+		owner,
+		limit,
+		offset,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	usernames, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.Username])
+	return usernames, total, err
+}
+
+func (db *Postgres) PrimaryUsername(ctx context.Context, owner string) (models.Username, error) {
+	rows, err := db.Pool.Query(
+		ctx,
+		`SELECT username, address, owner, cid, is_primary, timestamp, parent, display FROM username
+		WHERE owner = $1 AND is_primary = TRUE;`,
+		owner,
+	)
+	if err != nil {
+		return models.Username{}, err
+	}
+	u, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[models.Username])
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Username{}, ErrNotFound
+	}
+	return u, err
+}
+
+func (db *Postgres) AllUsernames(ctx context.Context) ([]models.Username, error) {
+	rows, err := db.Pool.Query(
+		ctx, "SELECT username, address, owner, cid, is_primary, timestamp, parent, display FROM username ORDER BY username;",
+	)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.Username])
+}
+
+func (db *Postgres) Events(ctx context.Context, username string) ([]Action, error) {
+	rows, err := db.Pool.Query(
+		ctx,
+		`SELECT type, block_hash, position, account, token, username, COALESCE(owner, ''), COALESCE(cid, ''),
+			COALESCE(record_key, ''), COALESCE(record_value, ''), timestamp
+		FROM event WHERE username = $1 ORDER BY timestamp, position;`,
+		username,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Action, error) {
+		var a Action
+		err := row.Scan(
+			&a.Type, &a.BlockHash, &a.Position, &a.Account, &a.Token, &a.Username, &a.Owner, &a.CID, &a.Key, &a.Value,
+			&a.Timestamp,
+		)
+		return a, err
+	})
+}
+
+func (db *Postgres) Records(ctx context.Context, usernames ...string) (map[string]map[string]string, error) {
+	return db.byUsername(ctx, "SELECT username, key, value FROM record", usernames)
+}
+
+func (db *Postgres) Addresses(ctx context.Context, usernames ...string) (map[string]map[string]string, error) {
+	return db.byUsername(ctx, "SELECT username, coin, address FROM coin_address", usernames)
+}
+
+// byUsername groups the key and value rows the query selects for the usernames by username and key.
+func (db *Postgres) byUsername(
+	ctx context.Context, query string, usernames []string,
+) (map[string]map[string]string, error) {
+	rows, err := db.Pool.Query(ctx, query+" WHERE username = ANY($1);", usernames)
+	if err != nil {
+		return nil, err
+	}
+	records := map[string]map[string]string{}
+	var username, key, value string
+	_, err = pgx.ForEachRow(rows, []any{&username, &key, &value}, func() error {
+		if records[username] == nil {
+			records[username] = map[string]string{}
+		}
+		records[username][key] = value
+		return nil
+	})
+	return records, err
+}
+
+func (db *Postgres) PendingActions(ctx context.Context, account string) ([]models.PendingAction, error) {
+	rows, err := db.Pool.Query(
+		ctx,
+		`SELECT type, block_hash, position, account, token, username, owner, cid, record_key, record_value, timestamp,
+			first_seen
+		FROM pending_action WHERE $1 = '' OR account = $1 ORDER BY timestamp, position;`,
+		account,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.PendingAction])
+}
+
+func (db *Postgres) Begin(ctx context.Context) (Tx, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return postgresTx{tx: tx, term: db.Term}, nil
+}
+
+func (db *Postgres) LoadCursor(ctx context.Context) (page int, lastBlockTimestamp *time.Time, lastBlockHash *string, err error) {
+	err = db.Pool.QueryRow(
+		ctx, "SELECT page, last_block_timestamp, last_block_hash FROM settings;",
+	).Scan(&page, &lastBlockTimestamp, &lastBlockHash)
+	return
+}
+
+func (db *Postgres) PendingBlocks(ctx context.Context) (map[string]time.Time, error) {
+	rows, err := db.Pool.Query(ctx, "SELECT block_hash, first_seen FROM pending_block;")
+	if err != nil {
+		return nil, err
+	}
+	firstSeen := map[string]time.Time{}
+	var (
+		blockHash string
+		seen      time.Time
+	)
+	_, err = pgx.ForEachRow(rows, []any{&blockHash, &seen}, func() error {
+		firstSeen[blockHash] = seen
+		return nil
+	})
+	return firstSeen, err
+}
+
+func (db *Postgres) UnreplayedDeadLetters(ctx context.Context) ([]StoredDeadLetter, error) {
+	rows, err := db.Pool.Query(
+		ctx, "SELECT id, stage, position, raw, context FROM dead_letter WHERE replayed_at IS NULL ORDER BY id;",
+	)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByName[StoredDeadLetter])
+}
+
+func (db *Postgres) SetDeadLetterError(ctx context.Context, id int64, deadLetterErr string) error {
+	_, err := db.Pool.Exec(ctx, "UPDATE dead_letter SET error = $1 WHERE id = $2;", deadLetterErr, id)
+	return err
+}
+
+func (db *Postgres) Migrate(ctx context.Context) error {
+	_, err := migrations.Up(ctx, db.Pool)
+	return err
+}
+
+func (db *Postgres) Reset(ctx context.Context) error {
+	return pgx.BeginFunc(ctx, db.Pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "TRUNCATE username, event, pending_action, pending_block, quarantine, dead_letter, outbox, record, coin_address;"); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, "UPDATE settings SET page = 1, last_block_timestamp = NULL, last_block_hash = NULL;")
+		return err
+	})
+}
+
+// RelayOutbox reads the entries, delivers them and saves the offset in separate statements, so no transaction stays
+// open while the sink is slow.
+func (db *Postgres) RelayOutbox(
+	ctx context.Context, sink string, limit int, deliver func([]OutboxEntry) error,
+) (int, error) {
+	rows, _ := db.Pool.Query(
+		ctx,
+		`SELECT id, action FROM outbox
+		WHERE id > COALESCE((SELECT delivered_id FROM outbox_offset WHERE sink = $1), 0) ORDER BY id LIMIT $2;`,
+		sink,
+		limit,
+	)
+	entries, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (OutboxEntry, error) {
+		var entry OutboxEntry
+		err := row.Scan(&entry.ID, &entry.Action)
+		return entry, err
+	})
+	if err != nil || len(entries) == 0 {
+		return 0, err
+	}
+
+	if err = deliver(entries); err != nil {
+		return 0, err
+	}
+	if _, err = db.Pool.Exec(
+		ctx,
+		`INSERT INTO outbox_offset(sink, delivered_id) VALUES ($1, $2)
+		ON CONFLICT (sink) DO UPDATE SET delivered_id = GREATEST(outbox_offset.delivered_id, EXCLUDED.delivered_id);`,
+		sink,
+		entries[len(entries)-1].ID,
+	); err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
+
+func (db *Postgres) Close() {
+	db.Pool.Close()
+}
+
+// Term is one leadership of a replica. Terms only increase, so a batch checking its term on commit can not be
+// committed by a former leader after another replica took over.
+type Term struct {
+	Holder string
+	Number int64
+}
+
+// fence fails unless the term still holds an unexpired lease. The leader row stays locked until the transaction ends,
+// so no replica can take over between the check and the commit.
+func (term *Term) fence(ctx context.Context, tx pgx.Tx) error {
+	if term == nil {
+		return nil
+	}
+	var ok bool
+	err := tx.QueryRow(
+		ctx,
+		`SELECT COALESCE(holder = $1 AND term = $2 AND lease_expires_at > clock_timestamp(), FALSE)
+		FROM leader WHERE id = 1 FOR SHARE;`,
+		term.Holder,
+		term.Number,
+	).Scan(&ok)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: term %d", ErrNotLeader, term.Number)
+	}
+	return nil
+}
+
+type postgresTx struct {
+	tx   pgx.Tx
+	term *Term
+}
+
+func (t postgresTx) InsertUsername(
+	ctx context.Context, username, display, address, owner string, timestamp time.Time,
+) (bool, error) {
+	commandTag, err := t.tx.Exec(
+		ctx,
+		`INSERT INTO username(username, address, owner, timestamp, display) VALUES ($1, $2, $3, $4, NULLIF($5, ''))
+		ON CONFLICT DO NOTHING;`,
+		username,
+		address,
+		owner,
+		timestamp,
+		display,
+	)
+	return commandTag.RowsAffected() == 1, err
+}
+
+func (t postgresTx) InsertSubname(
+	ctx context.Context, username, display, parent, address, owner string, timestamp time.Time,
+) (bool, error) {
+	commandTag, err := t.tx.Exec(
+		ctx,
+		`INSERT INTO username(username, address, owner, timestamp, parent, display)
+		SELECT $1, $2, $3, $4::timestamptz, username, NULLIF($6, '') FROM username WHERE username = $5 AND owner = $3
+		ON CONFLICT DO NOTHING;`,
+		username,
+		address,
+		owner,
+		timestamp,
+		parent,
+		display,
+	)
+	return commandTag.RowsAffected() == 1, err
+}
+
+func (t postgresTx) AssignSubname(ctx context.Context, address, owner, to string) (string, error) {
+	username, err := t.updateUsername(
+		ctx,
+		`UPDATE username SET owner = $1 WHERE address = $2
+		AND parent IN (SELECT username FROM username WHERE owner = $3) RETURNING username;`,
+		to,
+		address,
+		owner,
+	)
+	if err != nil || username == "" {
+		return "", err
+	}
+
+	_, err = t.tx.Exec(ctx, "DELETE FROM coin_address WHERE username = $1;", username)
+	return username, err
+}
+
+func (t postgresTx) SetPrimaryName(ctx context.Context, address, owner string) (string, error) {
+	username, err := t.updateUsername(
+		ctx, "UPDATE username SET is_primary = TRUE WHERE address = $1 AND owner = $2 RETURNING username;", address, owner,
+	)
+	if err != nil || username == "" {
+		return "", err
+	}
+
+	_, err = t.tx.Exec(ctx, "UPDATE username SET is_primary = FALSE WHERE address != $1 AND owner = $2;", address, owner)
+	return username, err
+}
+
+func (t postgresTx) SetCid(ctx context.Context, address, owner, cid string) (string, error) {
+	return t.updateUsername(
+		ctx, "UPDATE username SET cid = $1 WHERE address = $2 AND owner = $3 RETURNING username;", cid, address, owner,
+	)
+}
+
+func (t postgresTx) TransferUsername(ctx context.Context, address, from, to string) (string, error) {
+	username, err := t.updateUsername(
+		ctx, "UPDATE username SET owner = $1 WHERE address = $2 AND owner = $3 RETURNING username;", to, address, from,
+	)
+	if err != nil || username == "" {
+		return "", err
+	}
+
+	_, err = t.tx.Exec(ctx, "DELETE FROM coin_address WHERE username = $1;", username)
+	return username, err
+}
+
+func (t postgresTx) SetRecord(ctx context.Context, address, owner, key, value string) (string, error) {
+	return t.updateUsername(
+		ctx,
+		`INSERT INTO record(username, key, value) SELECT username, $1, $2 FROM username WHERE address = $3 AND owner = $4
+		ON CONFLICT (username, key) DO UPDATE SET value = EXCLUDED.value RETURNING username;`,
+		key,
+		value,
+		address,
+		owner,
+	)
+}
+
+func (t postgresTx) SetAddress(ctx context.Context, address, owner, coin, coinAddress string) (string, error) {
+	return t.updateUsername(
+		ctx,
+		`INSERT INTO coin_address(username, coin, address)
+		SELECT username, $1, $2 FROM username WHERE address = $3 AND owner = $4
+		ON CONFLICT (username, coin) DO UPDATE SET address = EXCLUDED.address RETURNING username;`,
+		coin,
+		coinAddress,
+		address,
+		owner,
+	)
+}
+
+func (t postgresTx) ClearPrimaryName(ctx context.Context, address, owner string) (string, error) {
+	return t.updateUsername(
+		ctx, "UPDATE username SET is_primary = FALSE WHERE address = $1 AND owner = $2 RETURNING username;", address, owner,
+	)
+}
+
+func (t postgresTx) ClearCid(ctx context.Context, address, owner string) (string, error) {
+	return t.updateUsername(
+		ctx, "UPDATE username SET cid = NULL WHERE address = $1 AND owner = $2 RETURNING username;", address, owner,
+	)
+}
+
+func (t postgresTx) ClearRecord(ctx context.Context, address, owner, key string) (string, error) {
+	username, err := t.updateUsername(
+		ctx, "SELECT username FROM username WHERE address = $1 AND owner = $2;", address, owner,
+	)
+	if err != nil || username == "" {
+		return "", err
+	}
+
+	_, err = t.tx.Exec(ctx, "DELETE FROM record WHERE username = $1 AND key = $2;", username, key)
+	return username, err
+}
+
+// updateUsername runs a query returning the username, like UPDATE ... RETURNING username, and returns an empty
+// username if no row matched.
+func (t postgresTx) updateUsername(ctx context.Context, sql string, args ...any) (string, error) {
+	var username string
+	err := t.tx.QueryRow(ctx, sql, args...).Scan(&username)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	return username, err
+}
+
+func (t postgresTx) RecordEvent(ctx context.Context, action Action) error {
+	if _, err := t.tx.Exec(ctx, lockOutbox); err != nil {
+		return err
+	}
+	_, err := t.tx.Exec(
+		ctx,
+		`WITH inserted AS (
+			INSERT INTO event(block_hash, position, type, account, token, username, owner, cid, record_key, record_value, timestamp)
+			VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, ''), NULLIF($10, ''), $11)
+			ON CONFLICT DO NOTHING RETURNING *
+		)`+outboxInserted,
+		action.BlockHash,
+		action.Position,
+		action.Type,
+		action.Account,
+		action.Token,
+		action.Username,
+		action.Owner,
+		action.CID,
+		action.Key,
+		action.Value,
+		action.Timestamp,
+	)
+	return err
+}
+
+func (t postgresTx) InsertDeadLetter(ctx context.Context, deadLetter DeadLetter) error {
+	_, err := t.tx.Exec(
+		ctx,
+		`INSERT INTO dead_letter(stage, block_hash, position, error, raw, context) VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6)
+		ON CONFLICT DO NOTHING;`,
+		deadLetter.Stage,
+		deadLetter.BlockHash,
+		deadLetter.Position,
+		deadLetter.Err.Error(),
+		deadLetter.Raw,
+		deadLetter.Context,
+	)
+	return err
+}
+
+func (t postgresTx) MarkDeadLetterReplayed(ctx context.Context, id int64) error {
+	_, err := t.tx.Exec(ctx, "UPDATE dead_letter SET replayed_at = NOW() WHERE id = $1;", id)
+	return err
+}
+
+func (t postgresTx) QuarantineBlock(ctx context.Context, blockHash, reason string, raw any, timestamp time.Time) error {
+	_, err := t.tx.Exec(
+		ctx,
+		"INSERT INTO quarantine(block_hash, reason, raw, timestamp) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING;",
+		blockHash,
+		reason,
+		raw,
+		timestamp,
+	)
+	return err
+}
+
+func (t postgresTx) ReplacePendingActions(ctx context.Context, actions []Action, firstSeen map[string]time.Time) error {
+	if _, err := t.tx.Exec(ctx, "DELETE FROM pending_action;"); err != nil {
+		return err
+	}
+	for _, action := range actions {
+		if _, err := t.tx.Exec(
+			ctx,
+			`INSERT INTO pending_action(
+				block_hash, position, type, account, token, username, owner, cid, record_key, record_value, timestamp, first_seen
+			)
+			VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, ''), NULLIF($10, ''), $11, $12);`,
+			action.BlockHash,
+			action.Position,
+			action.Type,
+			action.Account,
+			action.Token,
+			action.Username,
+			action.Owner,
+			action.CID,
+			action.Key,
+			action.Value,
+			action.Timestamp,
+			firstSeen[action.BlockHash],
+		); err != nil {
+			return err
+		}
+	}
+
+	if _, err := t.tx.Exec(ctx, "DELETE FROM pending_block;"); err != nil {
+		return err
+	}
+	for blockHash, seen := range firstSeen {
+		if _, err := t.tx.Exec(
+			ctx, "INSERT INTO pending_block(block_hash, first_seen) VALUES ($1, $2);", blockHash, seen,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t postgresTx) SaveCursor(ctx context.Context, page int, lastBlockTimestamp *time.Time, lastBlockHash *string) error {
+	_, err := t.tx.Exec(
+		ctx,
+		"UPDATE settings SET page = $1, last_block_timestamp = $2, last_block_hash = $3;",
+		page,
+		lastBlockTimestamp,
+		lastBlockHash,
+	)
+	return err
+}
+
+func (t postgresTx) Commit(ctx context.Context) error {
+	if err := t.term.fence(ctx, t.tx); err != nil {
+		return err
+	}
+	return t.tx.Commit(ctx)
+}
+
+func (t postgresTx) Rollback(ctx context.Context) error {
+	return t.tx.Rollback(ctx)
+}
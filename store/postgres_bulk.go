@@ -0,0 +1,287 @@
+package store
+
+import (
+	"context"
+	"kns-indexer/models"
+	"maps"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Bulk is implemented by stores that apply many pages in one transaction faster than through Tx.
+type Bulk interface {
+	BeginBulk(ctx context.Context) (Tx, error)
+}
+
+// BeginBulk begins a transaction that applies the username, record, address and event changes in memory and copies
+// them in on commit instead of writing them one by one. It reads the username table once and locks it against other
+// writers until it ends. Every other change is applied like in a transaction begun with Begin.
+func (db *Postgres) BeginBulk(ctx context.Context) (Tx, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = tx.Exec(ctx, "LOCK TABLE username IN EXCLUSIVE MODE;"); err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+	rows, _ := tx.Query(ctx, "SELECT username, address, owner, cid, is_primary, timestamp, parent, display FROM username;")
+	loaded, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.Username])
+	if err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+
+	t := &bulkTx{
+		postgresTx: postgresTx{tx: tx, term: db.Term},
+		loaded:     map[string]models.Username{},
+		names: &memoryTx{state: memoryState{
+			usernames: map[string]models.Username{}, records: map[recordKey]string{}, addresses: map[recordKey]string{},
+		}},
+		records:          map[recordKey]*string{},
+		clearedAddresses: map[string]bool{},
+		addresses:        map[recordKey]string{},
+	}
+	for _, u := range loaded {
+		t.loaded[u.Username], t.names.state.usernames[u.Username] = u, u
+	}
+	return t, nil
+}
+
+// bulkTx is a postgresTx that applies the username changes to an in-memory copy of the username table, with the
+// semantics of the memory store, and buffers them with the record, address and event changes until Commit copies
+// them in through staging tables.
+type bulkTx struct {
+	postgresTx
+	loaded map[string]models.Username
+	names  *memoryTx
+	// records are the changed records, nil for deleted ones
+	records map[recordKey]*string
+	// clearedAddresses are the usernames whose addresses are deleted before addresses are set
+	clearedAddresses map[string]bool
+	addresses        map[recordKey]string
+	events           []Action
+}
+
+func (t *bulkTx) InsertUsername(
+	ctx context.Context, username, display, address, owner string, timestamp time.Time,
+) (bool, error) {
+	return t.names.InsertUsername(ctx, username, display, address, owner, timestamp)
+}
+
+func (t *bulkTx) InsertSubname(
+	ctx context.Context, username, display, parent, address, owner string, timestamp time.Time,
+) (bool, error) {
+	return t.names.InsertSubname(ctx, username, display, parent, address, owner, timestamp)
+}
+
+func (t *bulkTx) AssignSubname(ctx context.Context, address, owner, to string) (string, error) {
+	username, err := t.names.AssignSubname(ctx, address, owner, to)
+	t.clearAddresses(username)
+	return username, err
+}
+
+func (t *bulkTx) SetPrimaryName(ctx context.Context, address, owner string) (string, error) {
+	return t.names.SetPrimaryName(ctx, address, owner)
+}
+
+func (t *bulkTx) SetCid(ctx context.Context, address, owner, cid string) (string, error) {
+	return t.names.SetCid(ctx, address, owner, cid)
+}
+
+func (t *bulkTx) TransferUsername(ctx context.Context, address, from, to string) (string, error) {
+	username, err := t.names.TransferUsername(ctx, address, from, to)
+	t.clearAddresses(username)
+	return username, err
+}
+
+func (t *bulkTx) SetRecord(ctx context.Context, address, owner, key, value string) (string, error) {
+	username, err := t.names.SetRecord(ctx, address, owner, key, value)
+	if username != "" {
+		t.records[recordKey{username, key}] = &value
+	}
+	return username, err
+}
+
+func (t *bulkTx) SetAddress(ctx context.Context, address, owner, coin, coinAddress string) (string, error) {
+	username, err := t.names.SetAddress(ctx, address, owner, coin, coinAddress)
+	if username != "" {
+		t.addresses[recordKey{username, coin}] = coinAddress
+	}
+	return username, err
+}
+
+func (t *bulkTx) ClearPrimaryName(ctx context.Context, address, owner string) (string, error) {
+	return t.names.ClearPrimaryName(ctx, address, owner)
+}
+
+func (t *bulkTx) ClearCid(ctx context.Context, address, owner string) (string, error) {
+	return t.names.ClearCid(ctx, address, owner)
+}
+
+func (t *bulkTx) ClearRecord(ctx context.Context, address, owner, key string) (string, error) {
+	username, err := t.names.ClearRecord(ctx, address, owner, key)
+	if username != "" {
+		t.records[recordKey{username, key}] = nil
+	}
+	return username, err
+}
+
+// clearAddresses deletes the addresses of the username, the stored ones on commit.
+func (t *bulkTx) clearAddresses(username string) {
+	if username == "" {
+		return
+	}
+	t.clearedAddresses[username] = true
+	maps.DeleteFunc(t.addresses, func(key recordKey, _ string) bool { return key.username == username })
+}
+
+func (t *bulkTx) RecordEvent(_ context.Context, action Action) error {
+	t.events = append(t.events, action)
+	return nil
+}
+
+// Commit merges the buffered changes in, adds the events not recorded before to the outbox, then commits.
+func (t *bulkTx) Commit(ctx context.Context) error {
+	for _, merge := range []func(ctx context.Context) error{
+		t.mergeUsernames, t.mergeRecords, t.mergeAddresses, t.mergeEvents,
+	} {
+		if err := merge(ctx); err != nil {
+			return err
+		}
+	}
+	return t.postgresTx.Commit(ctx)
+}
+
+func (t *bulkTx) mergeUsernames(ctx context.Context) error {
+	var changed []models.Username
+	for username, u := range t.names.state.usernames {
+		if loaded, ok := t.loaded[username]; !ok || !reflect.DeepEqual(loaded, u) {
+			changed = append(changed, u)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	return t.copyAndMerge(
+		ctx,
+		"CREATE TEMP TABLE IF NOT EXISTS username_staging (LIKE username INCLUDING DEFAULTS) ON COMMIT DROP;",
+		"username_staging",
+		[]string{"username", "address", "owner", "cid", "is_primary", "timestamp", "parent", "display"},
+		pgx.CopyFromSlice(len(changed), func(i int) ([]any, error) {
+			u := changed[i]
+			return []any{u.Username, u.Address, u.Owner, u.CID, u.IsPrimary, u.Timestamp, u.Parent, u.Display}, nil
+		}),
+		`INSERT INTO username(username, address, owner, cid, is_primary, timestamp, parent, display)
+		SELECT username, address, owner, cid, is_primary, timestamp, parent, display FROM username_staging
+		ON CONFLICT (username) DO UPDATE SET
+			address = EXCLUDED.address, owner = EXCLUDED.owner, cid = EXCLUDED.cid, is_primary = EXCLUDED.is_primary,
+			timestamp = EXCLUDED.timestamp, parent = EXCLUDED.parent, display = EXCLUDED.display;`,
+	)
+}
+
+func (t *bulkTx) mergeRecords(ctx context.Context) error {
+	if len(t.records) == 0 {
+		return nil
+	}
+
+	keys := slices.Collect(maps.Keys(t.records))
+	if err := t.copyAndMerge(
+		ctx,
+		"CREATE TEMP TABLE IF NOT EXISTS record_staging (username TEXT, key TEXT, value TEXT) ON COMMIT DROP;",
+		"record_staging",
+		[]string{"username", "key", "value"},
+		pgx.CopyFromSlice(len(keys), func(i int) ([]any, error) {
+			return []any{keys[i].username, keys[i].key, t.records[keys[i]]}, nil
+		}),
+		`DELETE FROM record USING record_staging
+		WHERE record_staging.value IS NULL
+			AND record.username = record_staging.username AND record.key = record_staging.key;`,
+	); err != nil {
+		return err
+	}
+	_, err := t.tx.Exec(
+		ctx,
+		`INSERT INTO record(username, key, value) SELECT username, key, value FROM record_staging WHERE value IS NOT NULL
+		ON CONFLICT (username, key) DO UPDATE SET value = EXCLUDED.value;`,
+	)
+	return err
+}
+
+func (t *bulkTx) mergeAddresses(ctx context.Context) error {
+	if len(t.clearedAddresses) > 0 {
+		if _, err := t.tx.Exec(
+			ctx, "DELETE FROM coin_address WHERE username = ANY($1);", slices.Collect(maps.Keys(t.clearedAddresses)),
+		); err != nil {
+			return err
+		}
+	}
+	if len(t.addresses) == 0 {
+		return nil
+	}
+
+	keys := slices.Collect(maps.Keys(t.addresses))
+	return t.copyAndMerge(
+		ctx,
+		"CREATE TEMP TABLE IF NOT EXISTS coin_address_staging (LIKE coin_address INCLUDING DEFAULTS) ON COMMIT DROP;",
+		"coin_address_staging",
+		[]string{"username", "coin", "address"},
+		pgx.CopyFromSlice(len(keys), func(i int) ([]any, error) {
+			return []any{keys[i].username, keys[i].key, t.addresses[keys[i]]}, nil
+		}),
+		`INSERT INTO coin_address(username, coin, address) SELECT username, coin, address FROM coin_address_staging
+		ON CONFLICT (username, coin) DO UPDATE SET address = EXCLUDED.address;`,
+	)
+}
+
+// mergeEvents inserts the buffered events and adds the ones not recorded before to the outbox.
+func (t *bulkTx) mergeEvents(ctx context.Context) error {
+	if len(t.events) == 0 {
+		return nil
+	}
+	if _, err := t.tx.Exec(ctx, lockOutbox); err != nil {
+		return err
+	}
+	return t.copyAndMerge(
+		ctx,
+		"CREATE TEMP TABLE IF NOT EXISTS event_staging (LIKE event INCLUDING DEFAULTS) ON COMMIT DROP;",
+		"event_staging",
+		[]string{
+			"block_hash", "position", "type", "account", "token", "username", "owner", "cid", "record_key", "record_value",
+			"timestamp",
+		},
+		pgx.CopyFromSlice(len(t.events), func(i int) ([]any, error) {
+			e := t.events[i]
+			return []any{
+				e.BlockHash, e.Position, e.Type, e.Account, e.Token, e.Username, nullIfEmpty(e.Owner), nullIfEmpty(e.CID),
+				nullIfEmpty(e.Key), nullIfEmpty(e.Value), e.Timestamp,
+			}, nil
+		}),
+		"WITH inserted AS (INSERT INTO event SELECT * FROM event_staging ON CONFLICT DO NOTHING RETURNING *)"+outboxInserted,
+	)
+}
+
+// copyAndMerge creates the staging table, copies the rows into it and runs the merge statement.
+func (t *bulkTx) copyAndMerge(
+	ctx context.Context, create, staging string, columns []string, rows pgx.CopyFromSource, merge string,
+) error {
+	if _, err := t.tx.Exec(ctx, create); err != nil {
+		return err
+	}
+	if _, err := t.tx.CopyFrom(ctx, pgx.Identifier{staging}, columns, rows); err != nil {
+		return err
+	}
+	_, err := t.tx.Exec(ctx, merge)
+	return err
+}
+
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+)
+
+// NotifyChannel is the channel every recorded event is notified on as a JSON Action once its transaction commits.
+const NotifyChannel = "kns_actions"
+
+// lockOutbox makes writers of the outbox wait for each other until they commit, so outbox IDs are visible in
+// increasing order and a relay never moves its offset past an entry that commits later. Relays are not blocked.
+const lockOutbox = "LOCK TABLE outbox IN SHARE ROW EXCLUSIVE MODE;"
+
+// outboxInserted adds the rows of the inserted event CTE to the outbox in the order they were applied in and
+// notifies them.
+const outboxInserted = `,
+outboxed AS (
+	INSERT INTO outbox(action)
+	SELECT json_build_object(
+		'type', type, 'blockHash', block_hash, 'position', position, 'account', account, 'token', token,
+		'username', username, 'owner', owner, 'cid', cid, 'key', record_key, 'value', record_value,
+		'timestamp', timestamp
+	)
+	FROM (SELECT * FROM inserted ORDER BY timestamp, block_hash, position) ordered
+	RETURNING id, action
+)
+SELECT pg_notify('` + NotifyChannel + `', action::text) FROM (SELECT * FROM outboxed ORDER BY id) ordered;`
+
+// Listen calls f with every action committed by an indexer on the database until the context is done or the
+// connection fails.
+func (db *Postgres) Listen(ctx context.Context, f func(Action)) error {
+	pooled, err := db.Pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// the connection is not returned to the pool listening
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err = conn.Exec(ctx, "LISTEN "+NotifyChannel+";"); err != nil {
+		return err
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var action Action
+		if err = json.Unmarshal([]byte(notification.Payload), &action); err != nil {
+			slog.Warn("malformed action notification", "payload", notification.Payload, "error", err)
+			continue
+		}
+		f(action)
+	}
+}
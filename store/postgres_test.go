@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPostgresNotify(t *testing.T) {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	db, err := OpenPostgres(ctx, databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err = db.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Reset(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	actions := make(chan Action, 16)
+	go db.Listen(ctx, func(action Action) { actions <- action })
+
+	record := func(action Action) {
+		commit(t, ctx, db, func(tx Tx) error { return tx.RecordEvent(ctx, action) })
+	}
+
+	// events are recorded until the listener receives one, as it may not be listening yet
+	var received Action
+	for i := 0; received.BlockHash == ""; i++ {
+		if i == 50 {
+			t.Fatal("no notification received")
+		}
+		record(Action{Type: "inscribe", BlockHash: fmt.Sprintf("B%d", i), Account: "keeta_a", Token: "keeta_t", Username: "alice", Timestamp: at(i)})
+		select {
+		case received = <-actions:
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	for len(actions) > 0 {
+		<-actions
+	}
+
+	want := Action{Type: "set_cid", BlockHash: "C1", Position: 2, Account: "keeta_a", Token: "keeta_t", Username: "alice", CID: "Qm1", Timestamp: at(60)}
+	record(want)
+	record(want)
+	select {
+	case got := <-actions:
+		got.Timestamp = got.Timestamp.UTC()
+		if got != want {
+			t.Fatalf("notified %+v, want %+v", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification received")
+	}
+	select {
+	case got := <-actions:
+		t.Fatalf("notified %+v again for the duplicate event", got)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
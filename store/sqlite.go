@@ -0,0 +1,829 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kns-indexer/models"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteTimeLayout has a fixed width so timestamps stored as text sort chronologically.
+const sqliteTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// sqliteMigrations are applied in order, PRAGMA user_version is the number of applied ones.
+var sqliteMigrations = []string{
+	`CREATE TABLE settings(
+		page INTEGER NOT NULL CHECK (page > 0) DEFAULT 1,
+		last_block_timestamp TEXT,
+		last_block_hash TEXT
+	);
+	INSERT INTO settings DEFAULT VALUES;
+
+	CREATE TABLE username(
+		username TEXT PRIMARY KEY,
+		address TEXT NOT NULL,
+		owner TEXT NOT NULL,
+		cid TEXT,
+		is_primary BOOLEAN NOT NULL DEFAULT FALSE,
+		timestamp TEXT NOT NULL
+	);
+	CREATE INDEX username_owner ON username(owner, timestamp);
+	CREATE INDEX username_address ON username(address);
+
+	CREATE TABLE event(
+		block_hash TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		type TEXT NOT NULL,
+		account TEXT NOT NULL,
+		token TEXT NOT NULL,
+		username TEXT NOT NULL,
+		owner TEXT,
+		cid TEXT,
+		timestamp TEXT NOT NULL,
+		PRIMARY KEY (block_hash, position)
+	);
+	CREATE INDEX event_username ON event(username, timestamp);
+
+	CREATE TABLE pending_action(
+		block_hash TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		type TEXT NOT NULL,
+		account TEXT NOT NULL,
+		token TEXT NOT NULL,
+		username TEXT,
+		owner TEXT,
+		cid TEXT,
+		timestamp TEXT NOT NULL,
+		first_seen TEXT NOT NULL,
+		PRIMARY KEY (block_hash, position)
+	);
+
+	CREATE TABLE quarantine(
+		block_hash TEXT PRIMARY KEY,
+		reason TEXT NOT NULL,
+		raw TEXT NOT NULL,
+		timestamp TEXT NOT NULL,
+		quarantined_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE dead_letter(
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		stage TEXT NOT NULL,
+		block_hash TEXT,
+		position INTEGER,
+		error TEXT NOT NULL,
+		raw TEXT NOT NULL,
+		context TEXT,
+		created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		replayed_at TEXT
+	);
+	CREATE UNIQUE INDEX dead_letter_item ON dead_letter(stage, COALESCE(block_hash, ''), COALESCE(position, -1), raw);`,
+	`CREATE TABLE outbox(
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		action TEXT NOT NULL,
+		created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE outbox_offset(
+		sink TEXT PRIMARY KEY,
+		delivered_id INTEGER NOT NULL
+	);`,
+	`ALTER TABLE event ADD COLUMN record_key TEXT;
+	ALTER TABLE event ADD COLUMN record_value TEXT;
+	ALTER TABLE pending_action ADD COLUMN record_key TEXT;
+	ALTER TABLE pending_action ADD COLUMN record_value TEXT;
+
+	CREATE TABLE record(
+		username TEXT NOT NULL,
+		key TEXT NOT NULL,
+		value TEXT NOT NULL,
+		PRIMARY KEY (username, key)
+	);`,
+	`CREATE TABLE coin_address(
+		username TEXT NOT NULL,
+		coin TEXT NOT NULL,
+		address TEXT NOT NULL,
+		PRIMARY KEY (username, coin)
+	);`,
+	`ALTER TABLE username ADD COLUMN parent TEXT;
+	CREATE INDEX username_parent ON username(parent);`,
+	`ALTER TABLE username ADD COLUMN display TEXT;`,
+	`CREATE TABLE pending_block(
+		block_hash TEXT PRIMARY KEY,
+		first_seen TEXT NOT NULL
+	);`,
+}
+
+// SQLite is a Store in a single SQLite file for deployments without a database server.
+type SQLite struct {
+	DB *sql.DB
+	// relayMu serializes the relays, the offsets are not locked in the database so delivering does not block the
+	// indexer.
+	relayMu sync.Mutex
+}
+
+func OpenSQLite(ctx context.Context, path string) (*SQLite, error) {
+	// writers wait for each other instead of failing, readers do not block the writer
+	db, err := sql.Open(
+		"sqlite",
+		"file:"+path+"?_txlock=immediate&_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)",
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err = db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLite{DB: db}, nil
+}
+
+func formatSQLiteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+func formatSQLiteTimePtr(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	s := formatSQLiteTime(*t)
+	return &s
+}
+
+// sqliteTime scans a timestamp stored as text.
+type sqliteTime struct {
+	time  *time.Time
+	valid bool
+}
+
+func (t *sqliteTime) Scan(src any) error {
+	if src == nil {
+		t.valid = false
+		return nil
+	}
+	s, ok := src.(string)
+	if !ok {
+		return fmt.Errorf("unexpected timestamp %T", src)
+	}
+	parsed, err := time.Parse(sqliteTimeLayout, s)
+	if err != nil {
+		return err
+	}
+	*t.time, t.valid = parsed, true
+	return nil
+}
+
+const sqliteUsernameColumns = "username, address, owner, cid, is_primary, timestamp, parent, display"
+
+func scanSQLiteUsernames(rows *sql.Rows) ([]models.Username, error) {
+	defer rows.Close()
+	usernames := []models.Username{}
+	for rows.Next() {
+		var u models.Username
+		if err := rows.Scan(
+			&u.Username, &u.Address, &u.Owner, &u.CID, &u.IsPrimary, &sqliteTime{time: &u.Timestamp}, &u.Parent, &u.Display,
+		); err != nil {
+			return nil, err
+		}
+		usernames = append(usernames, u)
+	}
+	return usernames, rows.Err()
+}
+
+func (db *SQLite) username(ctx context.Context, where string, args ...any) (models.Username, error) {
+	rows, err := db.DB.QueryContext(ctx, "SELECT "+sqliteUsernameColumns+" FROM username WHERE "+where+";", args...)
+	if err != nil {
+		return models.Username{}, err
+	}
+	usernames, err := scanSQLiteUsernames(rows)
+	if err != nil {
+		return models.Username{}, err
+	}
+	if len(usernames) == 0 {
+		return models.Username{}, ErrNotFound
+	}
+	return usernames[0], nil
+}
+
+func (db *SQLite) Username(ctx context.Context, username string) (models.Username, error) {
+	return db.username(ctx, "username = ?", username)
+}
+
+func (db *SQLite) Usernames(
+	ctx context.Context, owner string, descending bool, limit, offset int,
+) ([]models.Username, uint, error) {
+	var total uint
+	if err := db.DB.QueryRowContext(
+		ctx, "SELECT COUNT(*) FROM username WHERE ?1 = '' OR owner = ?1;", owner,
+	).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	sortOrder := "ASC"
+	if descending {
+		sortOrder = "DESC"
+	}
+	rows, err := db.DB.QueryContext(
+		ctx,
+		"SELECT "+sqliteUsernameColumns+" FROM username WHERE ?1 = '' OR owner = ?1 ORDER BY timestamp "+sortOrder+
+			", username LIMIT ?2 OFFSET ?3;",
+		owner,
+		limit,
+		offset,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	usernames, err := scanSQLiteUsernames(rows)
+	return usernames, total, err
+}
+
+func (db *SQLite) PrimaryUsername(ctx context.Context, owner string) (models.Username, error) {
+	return db.username(ctx, "owner = ? AND is_primary", owner)
+}
+
+func (db *SQLite) AllUsernames(ctx context.Context) ([]models.Username, error) {
+	rows, err := db.DB.QueryContext(ctx, "SELECT "+sqliteUsernameColumns+" FROM username ORDER BY username;")
+	if err != nil {
+		return nil, err
+	}
+	return scanSQLiteUsernames(rows)
+}
+
+func (db *SQLite) Events(ctx context.Context, username string) ([]Action, error) {
+	rows, err := db.DB.QueryContext(
+		ctx,
+		`SELECT type, block_hash, position, account, token, username, COALESCE(owner, ''), COALESCE(cid, ''),
+			COALESCE(record_key, ''), COALESCE(record_value, ''), timestamp
+		FROM event WHERE username = ? ORDER BY timestamp, position;`,
+		username,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []Action{}
+	for rows.Next() {
+		var a Action
+		if err = rows.Scan(
+			&a.Type, &a.BlockHash, &a.Position, &a.Account, &a.Token, &a.Username, &a.Owner, &a.CID, &a.Key, &a.Value,
+			&sqliteTime{time: &a.Timestamp},
+		); err != nil {
+			return nil, err
+		}
+		events = append(events, a)
+	}
+	return events, rows.Err()
+}
+
+func (db *SQLite) Records(ctx context.Context, usernames ...string) (map[string]map[string]string, error) {
+	return db.byUsername(ctx, "SELECT username, key, value FROM record", usernames)
+}
+
+func (db *SQLite) Addresses(ctx context.Context, usernames ...string) (map[string]map[string]string, error) {
+	return db.byUsername(ctx, "SELECT username, coin, address FROM coin_address", usernames)
+}
+
+// byUsername groups the key and value rows the query selects for the usernames by username and key.
+func (db *SQLite) byUsername(
+	ctx context.Context, query string, usernames []string,
+) (map[string]map[string]string, error) {
+	usernamesJSON, err := json.Marshal(usernames)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.DB.QueryContext(
+		ctx, query+" WHERE username IN (SELECT value FROM json_each(?));", string(usernamesJSON),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := map[string]map[string]string{}
+	for rows.Next() {
+		var username, key, value string
+		if err = rows.Scan(&username, &key, &value); err != nil {
+			return nil, err
+		}
+		if records[username] == nil {
+			records[username] = map[string]string{}
+		}
+		records[username][key] = value
+	}
+	return records, rows.Err()
+}
+
+func (db *SQLite) PendingActions(ctx context.Context, account string) ([]models.PendingAction, error) {
+	rows, err := db.DB.QueryContext(
+		ctx,
+		`SELECT type, block_hash, position, account, token, username, owner, cid, record_key, record_value, timestamp,
+			first_seen
+		FROM pending_action WHERE ?1 = '' OR account = ?1 ORDER BY timestamp, position;`,
+		account,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pending := []models.PendingAction{}
+	for rows.Next() {
+		var a models.PendingAction
+		if err = rows.Scan(
+			&a.Type, &a.BlockHash, &a.Position, &a.Account, &a.Token, &a.Username, &a.Owner, &a.CID, &a.Key, &a.Value,
+			&sqliteTime{time: &a.Timestamp}, &sqliteTime{time: &a.FirstSeen},
+		); err != nil {
+			return nil, err
+		}
+		pending = append(pending, a)
+	}
+	return pending, rows.Err()
+}
+
+func (db *SQLite) Begin(ctx context.Context) (Tx, error) {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return sqliteTx{tx}, nil
+}
+
+func (db *SQLite) LoadCursor(ctx context.Context) (page int, lastBlockTimestamp *time.Time, lastBlockHash *string, err error) {
+	var timestamp time.Time
+	scanned := &sqliteTime{time: &timestamp}
+	err = db.DB.QueryRowContext(
+		ctx, "SELECT page, last_block_timestamp, last_block_hash FROM settings;",
+	).Scan(&page, scanned, &lastBlockHash)
+	if scanned.valid {
+		lastBlockTimestamp = &timestamp
+	}
+	return
+}
+
+func (db *SQLite) PendingBlocks(ctx context.Context) (map[string]time.Time, error) {
+	rows, err := db.DB.QueryContext(ctx, "SELECT block_hash, first_seen FROM pending_block;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	firstSeen := map[string]time.Time{}
+	for rows.Next() {
+		var (
+			blockHash string
+			seen      time.Time
+		)
+		if err = rows.Scan(&blockHash, &sqliteTime{time: &seen}); err != nil {
+			return nil, err
+		}
+		firstSeen[blockHash] = seen
+	}
+	return firstSeen, rows.Err()
+}
+
+func (db *SQLite) UnreplayedDeadLetters(ctx context.Context) ([]StoredDeadLetter, error) {
+	rows, err := db.DB.QueryContext(
+		ctx, "SELECT id, stage, position, raw, context FROM dead_letter WHERE replayed_at IS NULL ORDER BY id;",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deadLetters []StoredDeadLetter
+	for rows.Next() {
+		var (
+			d                      StoredDeadLetter
+			raw, deadLetterContext *string
+		)
+		if err = rows.Scan(&d.ID, &d.Stage, &d.Position, &raw, &deadLetterContext); err != nil {
+			return nil, err
+		}
+		if raw != nil {
+			d.Raw = json.RawMessage(*raw)
+		}
+		if deadLetterContext != nil {
+			d.Context = json.RawMessage(*deadLetterContext)
+		}
+		deadLetters = append(deadLetters, d)
+	}
+	return deadLetters, rows.Err()
+}
+
+func (db *SQLite) SetDeadLetterError(ctx context.Context, id int64, deadLetterErr string) error {
+	_, err := db.DB.ExecContext(ctx, "UPDATE dead_letter SET error = ? WHERE id = ?;", deadLetterErr, id)
+	return err
+}
+
+// Migrate applies the migrations not applied yet, each in its own transaction.
+func (db *SQLite) Migrate(ctx context.Context) error {
+	var version int
+	if err := db.DB.QueryRowContext(ctx, "PRAGMA user_version;").Scan(&version); err != nil {
+		return err
+	}
+	for ; version < len(sqliteMigrations); version++ {
+		tx, err := db.DB.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, sqliteMigrations[version]); err == nil {
+			_, err = tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d;", version+1))
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to apply SQLite migration %d: %w", version+1, err)
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *SQLite) Reset(ctx context.Context) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, table := range []string{
+		"username", "event", "pending_action", "pending_block", "quarantine", "dead_letter", "outbox", "record",
+		"coin_address",
+	} {
+		if _, err = tx.ExecContext(ctx, "DELETE FROM "+table+";"); err != nil {
+			return err
+		}
+	}
+	if _, err = tx.ExecContext(
+		ctx, "UPDATE settings SET page = 1, last_block_timestamp = NULL, last_block_hash = NULL;",
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (db *SQLite) RelayOutbox(
+	ctx context.Context, sink string, limit int, deliver func([]OutboxEntry) error,
+) (int, error) {
+	db.relayMu.Lock()
+	defer db.relayMu.Unlock()
+
+	rows, err := db.DB.QueryContext(
+		ctx,
+		`SELECT id, action FROM outbox
+		WHERE id > COALESCE((SELECT delivered_id FROM outbox_offset WHERE sink = ?), 0) ORDER BY id LIMIT ?;`,
+		sink,
+		limit,
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	var entries []OutboxEntry
+	for rows.Next() {
+		var (
+			entry  OutboxEntry
+			action string
+		)
+		if err = rows.Scan(&entry.ID, &action); err != nil {
+			return 0, err
+		}
+		if err = json.Unmarshal([]byte(action), &entry.Action); err != nil {
+			return 0, err
+		}
+		entries = append(entries, entry)
+	}
+	if err = rows.Err(); err != nil || len(entries) == 0 {
+		return 0, err
+	}
+
+	if err = deliver(entries); err != nil {
+		return 0, err
+	}
+	_, err = db.DB.ExecContext(
+		ctx,
+		`INSERT INTO outbox_offset(sink, delivered_id) VALUES (?, ?)
+		ON CONFLICT (sink) DO UPDATE SET delivered_id = excluded.delivered_id;`,
+		sink,
+		entries[len(entries)-1].ID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
+
+func (db *SQLite) Close() {
+	db.DB.Close()
+}
+
+type sqliteTx struct {
+	tx *sql.Tx
+}
+
+func (t sqliteTx) InsertUsername(
+	ctx context.Context, username, display, address, owner string, timestamp time.Time,
+) (bool, error) {
+	result, err := t.tx.ExecContext(
+		ctx,
+		`INSERT INTO username(username, address, owner, timestamp, display) VALUES (?, ?, ?, ?, NULLIF(?, ''))
+		ON CONFLICT DO NOTHING;`,
+		username,
+		address,
+		owner,
+		formatSQLiteTime(timestamp),
+		display,
+	)
+	if err != nil {
+		return false, err
+	}
+	inserted, err := result.RowsAffected()
+	return inserted == 1, err
+}
+
+func (t sqliteTx) InsertSubname(
+	ctx context.Context, username, display, parent, address, owner string, timestamp time.Time,
+) (bool, error) {
+	result, err := t.tx.ExecContext(
+		ctx,
+		`INSERT INTO username(username, address, owner, timestamp, parent, display)
+		SELECT ?, ?, ?, ?, username, NULLIF(?, '') FROM username WHERE username = ? AND owner = ? ON CONFLICT DO NOTHING;`,
+		username,
+		address,
+		owner,
+		formatSQLiteTime(timestamp),
+		display,
+		parent,
+		owner,
+	)
+	if err != nil {
+		return false, err
+	}
+	inserted, err := result.RowsAffected()
+	return inserted == 1, err
+}
+
+func (t sqliteTx) AssignSubname(ctx context.Context, address, owner, to string) (string, error) {
+	username, err := t.updateUsername(
+		ctx,
+		`UPDATE username SET owner = ? WHERE address = ?
+		AND parent IN (SELECT username FROM username WHERE owner = ?) RETURNING username;`,
+		to,
+		address,
+		owner,
+	)
+	if err != nil || username == "" {
+		return "", err
+	}
+
+	_, err = t.tx.ExecContext(ctx, "DELETE FROM coin_address WHERE username = ?;", username)
+	return username, err
+}
+
+func (t sqliteTx) SetPrimaryName(ctx context.Context, address, owner string) (string, error) {
+	username, err := t.updateUsername(
+		ctx, "UPDATE username SET is_primary = TRUE WHERE address = ? AND owner = ? RETURNING username;", address, owner,
+	)
+	if err != nil || username == "" {
+		return "", err
+	}
+
+	_, err = t.tx.ExecContext(ctx, "UPDATE username SET is_primary = FALSE WHERE address != ? AND owner = ?;", address, owner)
+	return username, err
+}
+
+func (t sqliteTx) SetCid(ctx context.Context, address, owner, cid string) (string, error) {
+	return t.updateUsername(
+		ctx, "UPDATE username SET cid = ? WHERE address = ? AND owner = ? RETURNING username;", cid, address, owner,
+	)
+}
+
+func (t sqliteTx) TransferUsername(ctx context.Context, address, from, to string) (string, error) {
+	username, err := t.updateUsername(
+		ctx, "UPDATE username SET owner = ? WHERE address = ? AND owner = ? RETURNING username;", to, address, from,
+	)
+	if err != nil || username == "" {
+		return "", err
+	}
+
+	_, err = t.tx.ExecContext(ctx, "DELETE FROM coin_address WHERE username = ?;", username)
+	return username, err
+}
+
+func (t sqliteTx) SetRecord(ctx context.Context, address, owner, key, value string) (string, error) {
+	var username string
+	err := t.tx.QueryRowContext(
+		ctx,
+		`INSERT INTO record(username, key, value) SELECT username, ?, ? FROM username WHERE address = ? AND owner = ?
+		ON CONFLICT (username, key) DO UPDATE SET value = excluded.value RETURNING username;`,
+		key,
+		value,
+		address,
+		owner,
+	).Scan(&username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return username, err
+}
+
+func (t sqliteTx) SetAddress(ctx context.Context, address, owner, coin, coinAddress string) (string, error) {
+	var username string
+	err := t.tx.QueryRowContext(
+		ctx,
+		`INSERT INTO coin_address(username, coin, address)
+		SELECT username, ?, ? FROM username WHERE address = ? AND owner = ?
+		ON CONFLICT (username, coin) DO UPDATE SET address = excluded.address RETURNING username;`,
+		coin,
+		coinAddress,
+		address,
+		owner,
+	).Scan(&username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return username, err
+}
+
+func (t sqliteTx) ClearPrimaryName(ctx context.Context, address, owner string) (string, error) {
+	return t.updateUsername(
+		ctx, "UPDATE username SET is_primary = FALSE WHERE address = ? AND owner = ? RETURNING username;", address, owner,
+	)
+}
+
+func (t sqliteTx) ClearCid(ctx context.Context, address, owner string) (string, error) {
+	return t.updateUsername(
+		ctx, "UPDATE username SET cid = NULL WHERE address = ? AND owner = ? RETURNING username;", address, owner,
+	)
+}
+
+func (t sqliteTx) ClearRecord(ctx context.Context, address, owner, key string) (string, error) {
+	username, err := t.updateUsername(
+		ctx, "SELECT username FROM username WHERE address = ? AND owner = ?;", address, owner,
+	)
+	if err != nil || username == "" {
+		return "", err
+	}
+
+	_, err = t.tx.ExecContext(ctx, "DELETE FROM record WHERE username = ? AND key = ?;", username, key)
+	return username, err
+}
+
+// updateUsername runs a query returning the username, like UPDATE ... RETURNING username, and returns an empty
+// username if no row matched.
+func (t sqliteTx) updateUsername(ctx context.Context, query string, args ...any) (string, error) {
+	var username string
+	err := t.tx.QueryRowContext(ctx, query, args...).Scan(&username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return username, err
+}
+
+func (t sqliteTx) RecordEvent(ctx context.Context, action Action) error {
+	result, err := t.tx.ExecContext(
+		ctx,
+		`INSERT INTO event(block_hash, position, type, account, token, username, owner, cid, record_key, record_value, timestamp)
+		VALUES (?, ?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), ?) ON CONFLICT DO NOTHING;`,
+		action.BlockHash,
+		action.Position,
+		action.Type,
+		action.Account,
+		action.Token,
+		action.Username,
+		action.Owner,
+		action.CID,
+		action.Key,
+		action.Value,
+		formatSQLiteTime(action.Timestamp),
+	)
+	if err != nil {
+		return err
+	}
+	if inserted, err := result.RowsAffected(); err != nil || inserted == 0 {
+		return err
+	}
+
+	actionJSON, err := json.Marshal(action)
+	if err != nil {
+		return err
+	}
+	_, err = t.tx.ExecContext(ctx, "INSERT INTO outbox(action) VALUES (?);", string(actionJSON))
+	return err
+}
+
+func (t sqliteTx) InsertDeadLetter(ctx context.Context, deadLetter DeadLetter) error {
+	raw, err := json.Marshal(deadLetter.Raw)
+	if err != nil {
+		return err
+	}
+	deadLetterContext, err := json.Marshal(deadLetter.Context)
+	if err != nil {
+		return err
+	}
+	_, err = t.tx.ExecContext(
+		ctx,
+		`INSERT INTO dead_letter(stage, block_hash, position, error, raw, context) VALUES (?, NULLIF(?, ''), ?, ?, ?, ?)
+		ON CONFLICT DO NOTHING;`,
+		deadLetter.Stage,
+		deadLetter.BlockHash,
+		deadLetter.Position,
+		deadLetter.Err.Error(),
+		string(raw),
+		string(deadLetterContext),
+	)
+	return err
+}
+
+func (t sqliteTx) MarkDeadLetterReplayed(ctx context.Context, id int64) error {
+	_, err := t.tx.ExecContext(ctx, "UPDATE dead_letter SET replayed_at = CURRENT_TIMESTAMP WHERE id = ?;", id)
+	return err
+}
+
+func (t sqliteTx) QuarantineBlock(ctx context.Context, blockHash, reason string, raw any, timestamp time.Time) error {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	_, err = t.tx.ExecContext(
+		ctx,
+		"INSERT INTO quarantine(block_hash, reason, raw, timestamp) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING;",
+		blockHash,
+		reason,
+		string(data),
+		formatSQLiteTime(timestamp),
+	)
+	return err
+}
+
+func (t sqliteTx) ReplacePendingActions(ctx context.Context, actions []Action, firstSeen map[string]time.Time) error {
+	if _, err := t.tx.ExecContext(ctx, "DELETE FROM pending_action;"); err != nil {
+		return err
+	}
+	for _, action := range actions {
+		if _, err := t.tx.ExecContext(
+			ctx,
+			`INSERT INTO pending_action(
+				block_hash, position, type, account, token, username, owner, cid, record_key, record_value, timestamp, first_seen
+			)
+			VALUES (?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), ?, ?);`,
+			action.BlockHash,
+			action.Position,
+			action.Type,
+			action.Account,
+			action.Token,
+			action.Username,
+			action.Owner,
+			action.CID,
+			action.Key,
+			action.Value,
+			formatSQLiteTime(action.Timestamp),
+			formatSQLiteTime(firstSeen[action.BlockHash]),
+		); err != nil {
+			return err
+		}
+	}
+
+	if _, err := t.tx.ExecContext(ctx, "DELETE FROM pending_block;"); err != nil {
+		return err
+	}
+	for blockHash, seen := range firstSeen {
+		if _, err := t.tx.ExecContext(
+			ctx, "INSERT INTO pending_block(block_hash, first_seen) VALUES (?, ?);", blockHash, formatSQLiteTime(seen),
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t sqliteTx) SaveCursor(ctx context.Context, page int, lastBlockTimestamp *time.Time, lastBlockHash *string) error {
+	_, err := t.tx.ExecContext(
+		ctx,
+		"UPDATE settings SET page = ?, last_block_timestamp = ?, last_block_hash = ?;",
+		page,
+		formatSQLiteTimePtr(lastBlockTimestamp),
+		lastBlockHash,
+	)
+	return err
+}
+
+func (t sqliteTx) Commit(context.Context) error {
+	return t.tx.Commit()
+}
+
+func (t sqliteTx) Rollback(context.Context) error {
+	err := t.tx.Rollback()
+	if errors.Is(err, sql.ErrTxDone) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,185 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kns-indexer/models"
+	"strings"
+	"time"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// Store is the storage of the index: the usernames and their event history the API reads, and the cursor, dead
+// letters and batches of changes the indexer writes.
+type Store interface {
+	// Username returns ErrNotFound if the username is not registered.
+	Username(ctx context.Context, username string) (models.Username, error)
+	// Usernames returns a page of the usernames of the owner, of everyone when owner is empty, ordered by timestamp
+	// and the total number of them.
+	Usernames(ctx context.Context, owner string, descending bool, limit, offset int) ([]models.Username, uint, error)
+	// PrimaryUsername returns ErrNotFound if the owner has no primary username.
+	PrimaryUsername(ctx context.Context, owner string) (models.Username, error)
+	// AllUsernames returns every username ordered by username.
+	AllUsernames(ctx context.Context) ([]models.Username, error)
+	// Events returns the actions that changed the username ordered by timestamp and position.
+	Events(ctx context.Context, username string) ([]Action, error)
+	// Records returns the text records of the usernames by username and key, usernames without records are left out.
+	Records(ctx context.Context, usernames ...string) (map[string]map[string]string, error)
+	// Addresses returns the coin addresses of the usernames by username and coin, usernames without addresses are
+	// left out.
+	Addresses(ctx context.Context, usernames ...string) (map[string]map[string]string, error)
+	// PendingActions returns the actions of blocks that are not final yet of the account, of everyone when account
+	// is empty, ordered by timestamp and position.
+	PendingActions(ctx context.Context, account string) ([]models.PendingAction, error)
+
+	Begin(ctx context.Context) (Tx, error)
+	LoadCursor(ctx context.Context) (page int, lastBlockTimestamp *time.Time, lastBlockHash *string, err error)
+	// PendingBlocks returns when each block kept pending was first seen by block hash.
+	PendingBlocks(ctx context.Context) (map[string]time.Time, error)
+	UnreplayedDeadLetters(ctx context.Context) ([]StoredDeadLetter, error)
+	SetDeadLetterError(ctx context.Context, id int64, deadLetterErr string) error
+
+	// Migrate brings the schema up to date.
+	Migrate(ctx context.Context) error
+	// Reset deletes everything derived from the history and moves the cursor back to the first page. The outbox is
+	// emptied but the offsets of the sinks are kept, so rebuilt actions are relayed again with new IDs.
+	Reset(ctx context.Context) error
+	// RelayOutbox calls deliver with up to limit outbox entries after the offset of the sink, ordered by ID, and
+	// moves the offset past them if it succeeds. The offset never moves back, so relays of the same sink running at
+	// once may deliver entries twice but never skip one. It returns the number of delivered entries, 0 without
+	// calling deliver if the sink is up to date.
+	RelayOutbox(ctx context.Context, sink string, limit int, deliver func([]OutboxEntry) error) (int, error)
+	Close()
+}
+
+// Tx is a batch of changes committed atomically. Any error returned by a method aborts the batch.
+type Tx interface {
+	// InsertUsername reports whether the username was free. display is the name in the form it was inscribed in,
+	// empty if it is not kept.
+	InsertUsername(ctx context.Context, username, display, address, owner string, timestamp time.Time) (bool, error)
+	// InsertSubname inserts the subname under the parent name like InsertUsername and reports whether it was
+	// inserted, which requires the owner to own the parent.
+	InsertSubname(
+		ctx context.Context, username, display, parent, address, owner string, timestamp time.Time,
+	) (bool, error)
+	// AssignSubname gives the subname with the token to another owner and returns it, empty if the token is not the
+	// token of a subname whose parent is owned by owner. Like TransferUsername it deletes the coin addresses.
+	AssignSubname(ctx context.Context, address, owner, to string) (string, error)
+	// SetPrimaryName, SetCid and TransferUsername return the changed username, empty if the owner does not own the
+	// username token. TransferUsername deletes the coin addresses of the username, which belong to the former owner.
+	SetPrimaryName(ctx context.Context, address, owner string) (string, error)
+	SetCid(ctx context.Context, address, owner, cid string) (string, error)
+	TransferUsername(ctx context.Context, address, from, to string) (string, error)
+	// SetRecord sets the text record of the username with the token owned by owner and returns the username, empty
+	// if the owner does not own the username token. Records stay with the username when it is transferred.
+	SetRecord(ctx context.Context, address, owner, key, value string) (string, error)
+	// SetAddress sets the address of the username with the token owned by owner on the coin like SetRecord.
+	SetAddress(ctx context.Context, address, owner, coin, coinAddress string) (string, error)
+	// ClearPrimaryName, ClearCid and ClearRecord unset the primary name flag, the CID and the text record of the
+	// username with the token owned by owner and return the username, empty if the owner does not own the username
+	// token. The username is returned even if there was nothing to clear.
+	ClearPrimaryName(ctx context.Context, address, owner string) (string, error)
+	ClearCid(ctx context.Context, address, owner string) (string, error)
+	ClearRecord(ctx context.Context, address, owner, key string) (string, error)
+	// RecordEvent records an action that changed the state in the event history and adds it to the outbox.
+	// PostgreSQL also notifies it on NotifyChannel once the transaction commits.
+	RecordEvent(ctx context.Context, action Action) error
+
+	InsertDeadLetter(ctx context.Context, deadLetter DeadLetter) error
+	MarkDeadLetterReplayed(ctx context.Context, id int64) error
+	QuarantineBlock(ctx context.Context, blockHash, reason string, raw any, timestamp time.Time) error
+	// ReplacePendingActions replaces all pending actions and the pending blocks with the blocks of firstSeen, which
+	// is keyed by block hash.
+	ReplacePendingActions(ctx context.Context, actions []Action, firstSeen map[string]time.Time) error
+	SaveCursor(ctx context.Context, page int, lastBlockTimestamp *time.Time, lastBlockHash *string) error
+
+	Commit(ctx context.Context) error
+	// Rollback is a no-op after Commit.
+	Rollback(ctx context.Context) error
+}
+
+// Action is a KNS state change requested by a block operation. Whether it changes anything is decided when it is
+// applied, e.g. a transfer of a username the sender does not own is a no-op.
+type Action struct {
+	Type      string `json:"type"`
+	BlockHash string `json:"blockHash"`
+	Position  int    `json:"position"`
+	Account   string `json:"account"`
+	Token     string `json:"token,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Owner     string `json:"owner,omitempty"`
+	CID       string `json:"cid,omitempty"`
+	// Key and Value are the record key and value of set_record, the key of clear_record, and the coin and address
+	// of set_address. Value is also the display form of the name of inscribe.
+	Key       string    `json:"key,omitempty"`
+	Value     string    `json:"value,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// OutboxEntry is a recorded action waiting in the outbox to be relayed to the event sinks. IDs increase in commit
+// order.
+type OutboxEntry struct {
+	ID     int64  `json:"id"`
+	Action Action `json:"action"`
+}
+
+// DeadLetter is a part of the history that failed decoding or validation and was skipped.
+type DeadLetter struct {
+	Stage     string
+	BlockHash string
+	Position  *int
+	Err       error
+	Raw       any
+	// Context is what replaying the dead letter needs besides Raw, e.g. the block of an operation.
+	Context map[string]any
+}
+
+type StoredDeadLetter struct {
+	ID       int64           `db:"id"`
+	Stage    string          `db:"stage"`
+	Position *int            `db:"position"`
+	Raw      json.RawMessage `db:"raw"`
+	Context  json.RawMessage `db:"context"`
+}
+
+// AttachRecords fills in the text records and coin addresses of the usernames.
+func AttachRecords(ctx context.Context, db Store, usernames []models.Username) error {
+	names := make([]string, len(usernames))
+	for i, u := range usernames {
+		names[i] = u.Username
+	}
+	records, err := db.Records(ctx, names...)
+	if err != nil {
+		return err
+	}
+	addresses, err := db.Addresses(ctx, names...)
+	if err != nil {
+		return err
+	}
+	for i := range usernames {
+		usernames[i].Records = records[usernames[i].Username]
+		usernames[i].Addresses = addresses[usernames[i].Username]
+	}
+	return nil
+}
+
+// Open opens the store the URL points to: postgres:// or postgresql:// for PostgreSQL, which is also used for an
+// empty URL and key=value connection strings, sqlite://path for an SQLite file and memory:// for a store that is lost on exit.
+func Open(ctx context.Context, databaseURL string) (Store, error) {
+	scheme, _, ok := strings.Cut(databaseURL, "://")
+	if !ok {
+		scheme = ""
+	}
+	switch scheme {
+	case "", "postgres", "postgresql":
+		return OpenPostgres(ctx, databaseURL)
+	case "sqlite":
+		return OpenSQLite(ctx, strings.TrimPrefix(databaseURL, "sqlite://"))
+	case "memory":
+		return NewMemory(), nil
+	}
+	return nil, fmt.Errorf("unsupported database URL scheme %q", scheme)
+}
@@ -0,0 +1,779 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"kns-indexer/models"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// stores returns a constructor of an empty store for every backend. PostgreSQL runs only when TEST_DATABASE_URL is
+// set and is reset before every test, once with regular and once with bulk transactions.
+func stores(t *testing.T) map[string]func(t *testing.T) Store {
+	constructors := map[string]func(t *testing.T) Store{
+		"memory": func(t *testing.T) Store { return NewMemory() },
+		"sqlite": func(t *testing.T) Store {
+			db, err := OpenSQLite(context.Background(), filepath.Join(t.TempDir(), "kns.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(db.Close)
+			return db
+		},
+	}
+	if databaseURL := os.Getenv("TEST_DATABASE_URL"); databaseURL != "" {
+		constructors["postgres"] = func(t *testing.T) Store {
+			db, err := OpenPostgres(context.Background(), databaseURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(db.Close)
+			return db
+		}
+		constructors["postgres_bulk"] = func(t *testing.T) Store {
+			return bulkPostgres{constructors["postgres"](t).(*Postgres)}
+		}
+	} else {
+		t.Log("TEST_DATABASE_URL is not set, skipping PostgreSQL")
+	}
+	return constructors
+}
+
+// bulkPostgres is a PostgreSQL store whose transactions are bulk transactions.
+type bulkPostgres struct {
+	*Postgres
+}
+
+func (db bulkPostgres) Begin(ctx context.Context) (Tx, error) {
+	return db.BeginBulk(ctx)
+}
+
+// conformance runs the test against every backend with a migrated and reset store.
+func conformance(t *testing.T, test func(t *testing.T, ctx context.Context, db Store)) {
+	for name, open := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			db := open(t)
+			if err := db.Migrate(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Reset(ctx); err != nil {
+				t.Fatal(err)
+			}
+			test(t, ctx, db)
+		})
+	}
+}
+
+var base = time.Date(2025, 12, 3, 0, 0, 0, 0, time.UTC)
+
+func at(minute int) time.Time {
+	return base.Add(time.Duration(minute) * time.Minute)
+}
+
+// commit applies the changes in one transaction.
+func commit(t *testing.T, ctx context.Context, db Store, changes func(tx Tx) error) {
+	t.Helper()
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback(ctx)
+	if err = changes(tx); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func utc(usernames ...models.Username) []models.Username {
+	for i := range usernames {
+		usernames[i].Timestamp = usernames[i].Timestamp.UTC()
+	}
+	return usernames
+}
+
+func names(usernames []models.Username) []string {
+	result := []string{}
+	for _, u := range usernames {
+		result = append(result, u.Username)
+	}
+	return result
+}
+
+func TestCursor(t *testing.T) {
+	conformance(t, func(t *testing.T, ctx context.Context, db Store) {
+		page, lastBlockTimestamp, lastBlockHash, err := db.LoadCursor(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page != 1 || lastBlockTimestamp != nil || lastBlockHash != nil {
+			t.Fatalf("initial cursor %d/%v/%v, want 1/nil/nil", page, lastBlockTimestamp, lastBlockHash)
+		}
+
+		timestamp, hash := at(1), "B1"
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = tx.SaveCursor(ctx, 2, &timestamp, &hash); err != nil {
+			t.Fatal(err)
+		}
+		if err = tx.Rollback(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if page, _, _, _ = db.LoadCursor(ctx); page != 1 {
+			t.Fatalf("page %d after rollback, want 1", page)
+		}
+
+		commit(t, ctx, db, func(tx Tx) error { return tx.SaveCursor(ctx, 3, &timestamp, &hash) })
+		page, lastBlockTimestamp, lastBlockHash, err = db.LoadCursor(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page != 3 || lastBlockTimestamp == nil || !lastBlockTimestamp.Equal(timestamp) || *lastBlockHash != hash {
+			t.Fatalf("cursor %d/%v/%v, want 3/%v/%v", page, lastBlockTimestamp, lastBlockHash, timestamp, hash)
+		}
+	})
+}
+
+func TestUsernames(t *testing.T) {
+	conformance(t, func(t *testing.T, ctx context.Context, db Store) {
+		commit(t, ctx, db, func(tx Tx) error {
+			for i, name := range []string{"alice", "bob", "carol"} {
+				owner, display := "keeta_owner1", ""
+				if name == "carol" {
+					owner = "keeta_owner2"
+				}
+				if name == "bob" {
+					display = "Bob"
+				}
+				inserted, err := tx.InsertUsername(ctx, name, display, "keeta_token_"+name, owner, at(i))
+				if err != nil || !inserted {
+					t.Fatalf("insert %v: %v %v", name, inserted, err)
+				}
+			}
+			inserted, err := tx.InsertUsername(ctx, "alice", "", "keeta_token_other", "keeta_owner2", at(5))
+			if err != nil || inserted {
+				t.Fatalf("insert taken username: %v %v", inserted, err)
+			}
+			return nil
+		})
+
+		alice, err := db.Username(ctx, "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := models.Username{Username: "alice", Address: "keeta_token_alice", Owner: "keeta_owner1", Timestamp: at(0)}
+		if !reflect.DeepEqual(utc(alice), utc(want)) {
+			t.Fatalf("alice %+v, want %+v", alice, want)
+		}
+		if bob, err := db.Username(ctx, "bob"); err != nil || bob.Display == nil || *bob.Display != "Bob" {
+			t.Fatalf("bob %+v %v, want displayed as Bob", bob, err)
+		}
+		if _, err = db.Username(ctx, "dave"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("unknown username error %v, want ErrNotFound", err)
+		}
+
+		usernames, total, err := db.Usernames(ctx, "", true, 2, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 3 || !reflect.DeepEqual(names(usernames), []string{"carol", "bob"}) {
+			t.Fatalf("first page %v of %d, want [carol bob] of 3", names(usernames), total)
+		}
+		usernames, _, err = db.Usernames(ctx, "", true, 2, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(names(usernames), []string{"alice"}) {
+			t.Fatalf("second page %v, want [alice]", names(usernames))
+		}
+		usernames, total, err = db.Usernames(ctx, "keeta_owner1", false, 100, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 2 || !reflect.DeepEqual(names(usernames), []string{"alice", "bob"}) {
+			t.Fatalf("owner usernames %v of %d, want [alice bob] of 2", names(usernames), total)
+		}
+		usernames, total, err = db.Usernames(ctx, "keeta_nobody", false, 100, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 0 || usernames == nil || len(usernames) != 0 {
+			t.Fatalf("usernames of unknown owner %v of %d, want empty", usernames, total)
+		}
+
+		all, err := db.AllUsernames(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(names(all), []string{"alice", "bob", "carol"}) {
+			t.Fatalf("all usernames %v, want [alice bob carol]", names(all))
+		}
+	})
+}
+
+func TestUsernameChanges(t *testing.T) {
+	conformance(t, func(t *testing.T, ctx context.Context, db Store) {
+		commit(t, ctx, db, func(tx Tx) error {
+			for i, name := range []string{"alice", "bob"} {
+				if _, err := tx.InsertUsername(ctx, name, "", "keeta_token_"+name, "keeta_owner1", at(i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+		if _, err := db.PrimaryUsername(ctx, "keeta_owner1"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("primary username error %v, want ErrNotFound", err)
+		}
+
+		changes := []struct {
+			name   string
+			change func(tx Tx) (string, error)
+			want   string
+		}{
+			{"set primary", func(tx Tx) (string, error) { return tx.SetPrimaryName(ctx, "keeta_token_alice", "keeta_owner1") }, "alice"},
+			{"move primary", func(tx Tx) (string, error) { return tx.SetPrimaryName(ctx, "keeta_token_bob", "keeta_owner1") }, "bob"},
+			{"set primary of other owner", func(tx Tx) (string, error) { return tx.SetPrimaryName(ctx, "keeta_token_alice", "keeta_owner2") }, ""},
+			{"set cid", func(tx Tx) (string, error) { return tx.SetCid(ctx, "keeta_token_alice", "keeta_owner1", "Qm1") }, "alice"},
+			{"set cid of other owner", func(tx Tx) (string, error) { return tx.SetCid(ctx, "keeta_token_alice", "keeta_owner2", "Qm2") }, ""},
+			{"transfer", func(tx Tx) (string, error) {
+				return tx.TransferUsername(ctx, "keeta_token_alice", "keeta_owner1", "keeta_owner2")
+			}, "alice"},
+			{"transfer by former owner", func(tx Tx) (string, error) {
+				return tx.TransferUsername(ctx, "keeta_token_alice", "keeta_owner1", "keeta_owner3")
+			}, ""},
+		}
+		for _, c := range changes {
+			commit(t, ctx, db, func(tx Tx) error {
+				got, err := c.change(tx)
+				if err != nil {
+					return err
+				}
+				if got != c.want {
+					t.Errorf("%v changed %q, want %q", c.name, got, c.want)
+				}
+				return nil
+			})
+		}
+
+		primary, err := db.PrimaryUsername(ctx, "keeta_owner1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if primary.Username != "bob" {
+			t.Fatalf("primary username %v, want bob", primary.Username)
+		}
+
+		alice, err := db.Username(ctx, "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if alice.Owner != "keeta_owner2" || alice.CID == nil || *alice.CID != "Qm1" || alice.IsPrimary {
+			t.Fatalf("alice %+v, want owner keeta_owner2, cid Qm1 and not primary", alice)
+		}
+	})
+}
+
+func TestClears(t *testing.T) {
+	conformance(t, func(t *testing.T, ctx context.Context, db Store) {
+		commit(t, ctx, db, func(tx Tx) error {
+			if _, err := tx.InsertUsername(ctx, "alice", "", "keeta_token_alice", "keeta_owner1", at(0)); err != nil {
+				return err
+			}
+			_, err := tx.SetPrimaryName(ctx, "keeta_token_alice", "keeta_owner1")
+			if err == nil {
+				_, err = tx.SetCid(ctx, "keeta_token_alice", "keeta_owner1", "Qm1")
+			}
+			for _, key := range []string{"url", "avatar"} {
+				if err == nil {
+					_, err = tx.SetRecord(ctx, "keeta_token_alice", "keeta_owner1", key, "https://alice.example")
+				}
+			}
+			return err
+		})
+
+		for _, owner := range []string{"keeta_owner2", "keeta_owner1"} {
+			want := map[string]string{"keeta_owner1": "alice"}[owner]
+			commit(t, ctx, db, func(tx Tx) error {
+				clears := []func() (string, error){
+					func() (string, error) { return tx.ClearPrimaryName(ctx, "keeta_token_alice", owner) },
+					func() (string, error) { return tx.ClearCid(ctx, "keeta_token_alice", owner) },
+					func() (string, error) { return tx.ClearRecord(ctx, "keeta_token_alice", owner, "url") },
+					func() (string, error) { return tx.ClearRecord(ctx, "keeta_token_alice", owner, "email") },
+				}
+				for i, change := range clears {
+					got, err := change()
+					if err != nil {
+						return err
+					}
+					if got != want {
+						t.Errorf("clear %d by %v changed %q, want %q", i, owner, got, want)
+					}
+				}
+				return nil
+			})
+		}
+
+		if _, err := db.PrimaryUsername(ctx, "keeta_owner1"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("primary username error %v, want ErrNotFound", err)
+		}
+		alice, err := db.Username(ctx, "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if alice.CID != nil || alice.IsPrimary {
+			t.Fatalf("alice %+v, want no CID and not primary", alice)
+		}
+		records, err := db.Records(ctx, "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := map[string]map[string]string{"alice": {"avatar": "https://alice.example"}}; !reflect.DeepEqual(records, want) {
+			t.Fatalf("records %v, want %v", records, want)
+		}
+	})
+}
+
+func TestRecords(t *testing.T) {
+	conformance(t, func(t *testing.T, ctx context.Context, db Store) {
+		commit(t, ctx, db, func(tx Tx) error {
+			for i, name := range []string{"alice", "bob"} {
+				if _, err := tx.InsertUsername(ctx, name, "", "keeta_token_"+name, "keeta_owner1", at(i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+		changes := []struct {
+			name       string
+			owner      string
+			key, value string
+			want       string
+		}{
+			{"set", "keeta_owner1", "url", "https://old.example", "alice"},
+			{"overwrite", "keeta_owner1", "url", "https://alice.example", "alice"},
+			{"set other key", "keeta_owner1", "com.twitter", "alice", "alice"},
+			{"set by other owner", "keeta_owner2", "email", "mallory@example.com", ""},
+		}
+		for _, c := range changes {
+			commit(t, ctx, db, func(tx Tx) error {
+				got, err := tx.SetRecord(ctx, "keeta_token_alice", c.owner, c.key, c.value)
+				if err != nil {
+					return err
+				}
+				if got != c.want {
+					t.Errorf("%v changed %q, want %q", c.name, got, c.want)
+				}
+				return nil
+			})
+		}
+		commit(t, ctx, db, func(tx Tx) error {
+			_, err := tx.TransferUsername(ctx, "keeta_token_alice", "keeta_owner1", "keeta_owner2")
+			return err
+		})
+
+		records, err := db.Records(ctx, "alice", "bob", "carol")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]map[string]string{"alice": {"url": "https://alice.example", "com.twitter": "alice"}}
+		if !reflect.DeepEqual(records, want) {
+			t.Fatalf("records %v, want %v", records, want)
+		}
+
+		setRecord := Action{
+			Type: "set_record", BlockHash: "B1", Position: 0, Account: "keeta_owner2", Token: "keeta_token_alice",
+			Username: "alice", Key: "url", Value: "https://alice.example", Timestamp: at(3),
+		}
+		commit(t, ctx, db, func(tx Tx) error { return tx.RecordEvent(ctx, setRecord) })
+		events, err := db.Events(ctx, "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 1 || events[0].Key != setRecord.Key || events[0].Value != setRecord.Value {
+			t.Fatalf("events %+v, want %+v", events, setRecord)
+		}
+	})
+}
+
+func TestAddresses(t *testing.T) {
+	conformance(t, func(t *testing.T, ctx context.Context, db Store) {
+		commit(t, ctx, db, func(tx Tx) error {
+			for i, name := range []string{"alice", "bob"} {
+				if _, err := tx.InsertUsername(ctx, name, "", "keeta_token_"+name, "keeta_owner1", at(i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+		set := func(tx Tx, token, owner, coin, address, want string) error {
+			got, err := tx.SetAddress(ctx, token, owner, coin, address)
+			if got != want {
+				t.Errorf("set %v address of %v by %v changed %q, want %q", coin, token, owner, got, want)
+			}
+			return err
+		}
+		commit(t, ctx, db, func(tx Tx) error {
+			return errors.Join(
+				set(tx, "keeta_token_alice", "keeta_owner1", "eth", "0xold", "alice"),
+				set(tx, "keeta_token_alice", "keeta_owner1", "eth", "0xalice", "alice"),
+				set(tx, "keeta_token_alice", "keeta_owner1", "btc", "bc1alice", "alice"),
+				set(tx, "keeta_token_alice", "keeta_owner2", "sol", "mallory", ""),
+				set(tx, "keeta_token_bob", "keeta_owner1", "eth", "0xbob", "bob"),
+			)
+		})
+		addresses, err := db.Addresses(ctx, "alice", "bob", "carol")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]map[string]string{"alice": {"eth": "0xalice", "btc": "bc1alice"}, "bob": {"eth": "0xbob"}}
+		if !reflect.DeepEqual(addresses, want) {
+			t.Fatalf("addresses %v, want %v", addresses, want)
+		}
+
+		// the addresses of a transferred username are deleted, also when set in the same transaction
+		commit(t, ctx, db, func(tx Tx) error {
+			if err := set(tx, "keeta_token_bob", "keeta_owner1", "sol", "bob", "bob"); err != nil {
+				return err
+			}
+			for _, token := range []string{"keeta_token_alice", "keeta_token_bob"} {
+				if _, err := tx.TransferUsername(ctx, token, "keeta_owner1", "keeta_owner2"); err != nil {
+					return err
+				}
+			}
+			return set(tx, "keeta_token_alice", "keeta_owner2", "eth", "0xnew", "alice")
+		})
+		if addresses, err = db.Addresses(ctx, "alice", "bob"); err != nil {
+			t.Fatal(err)
+		}
+		if want = map[string]map[string]string{"alice": {"eth": "0xnew"}}; !reflect.DeepEqual(addresses, want) {
+			t.Fatalf("addresses after transfer %v, want %v", addresses, want)
+		}
+	})
+}
+
+func TestSubnames(t *testing.T) {
+	conformance(t, func(t *testing.T, ctx context.Context, db Store) {
+		insert := func(tx Tx, username, parent, owner string, want bool) error {
+			inserted, err := tx.InsertSubname(ctx, username, "", parent, "keeta_token_"+username, owner, at(1))
+			if inserted != want {
+				t.Errorf("insert %v by %v %v, want %v", username, owner, inserted, want)
+			}
+			return err
+		}
+		commit(t, ctx, db, func(tx Tx) error {
+			if _, err := tx.InsertUsername(ctx, "alice", "", "keeta_token_alice", "keeta_owner1", at(0)); err != nil {
+				return err
+			}
+			return errors.Join(
+				insert(tx, "blog.alice", "alice", "keeta_owner1", true),
+				insert(tx, "blog.alice", "alice", "keeta_owner1", false),
+				insert(tx, "pay.alice", "alice", "keeta_owner2", false),
+				insert(tx, "blog.bob", "bob", "keeta_owner1", false),
+				insert(tx, "a.blog.alice", "blog.alice", "keeta_owner1", true),
+			)
+		})
+
+		assign := func(tx Tx, token, owner, to, want string) error {
+			got, err := tx.AssignSubname(ctx, token, owner, to)
+			if got != want {
+				t.Errorf("assign %v by %v changed %q, want %q", token, owner, got, want)
+			}
+			return err
+		}
+		commit(t, ctx, db, func(tx Tx) error {
+			if _, err := tx.SetAddress(ctx, "keeta_token_blog.alice", "keeta_owner1", "eth", "0xalice"); err != nil {
+				return err
+			}
+			return errors.Join(
+				assign(tx, "keeta_token_alice", "keeta_owner1", "keeta_owner2", ""),
+				assign(tx, "keeta_token_blog.alice", "keeta_owner2", "keeta_owner2", ""),
+				assign(tx, "keeta_token_blog.alice", "keeta_owner1", "keeta_owner2", "blog.alice"),
+				// the parent owner keeps control of the subname after assigning it
+				assign(tx, "keeta_token_blog.alice", "keeta_owner1", "keeta_owner3", "blog.alice"),
+				// only the owner of the immediate parent controls a subname
+				assign(tx, "keeta_token_a.blog.alice", "keeta_owner1", "keeta_owner2", ""),
+				assign(tx, "keeta_token_a.blog.alice", "keeta_owner3", "keeta_owner2", "a.blog.alice"),
+			)
+		})
+
+		blog, err := db.Username(ctx, "blog.alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if blog.Owner != "keeta_owner3" || blog.Parent == nil || *blog.Parent != "alice" {
+			t.Fatalf("blog.alice %+v, want owned by keeta_owner3 under alice", blog)
+		}
+		alice, err := db.Username(ctx, "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if alice.Parent != nil {
+			t.Fatalf("alice parent %v, want none", *alice.Parent)
+		}
+		addresses, err := db.Addresses(ctx, "blog.alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addresses) != 0 {
+			t.Fatalf("addresses after assignment %v, want none", addresses)
+		}
+	})
+}
+
+func TestEvents(t *testing.T) {
+	conformance(t, func(t *testing.T, ctx context.Context, db Store) {
+		inscribe := Action{
+			Type: "inscribe", BlockHash: "B1", Position: 0, Account: "keeta_token", Token: "keeta_token", Username: "alice",
+			Owner: "keeta_owner1", Timestamp: at(1),
+		}
+		setCid := Action{
+			Type: "set_cid", BlockHash: "B2", Position: 1, Account: "keeta_owner1", Token: "keeta_token", Username: "alice",
+			CID: "Qm1", Timestamp: at(2),
+		}
+		commit(t, ctx, db, func(tx Tx) error {
+			for _, action := range []Action{setCid, inscribe, inscribe} {
+				if err := tx.RecordEvent(ctx, action); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+		events, err := db.Events(ctx, "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range events {
+			events[i].Timestamp = events[i].Timestamp.UTC()
+		}
+		if want := []Action{inscribe, setCid}; !reflect.DeepEqual(events, want) {
+			t.Fatalf("events %+v, want %+v", events, want)
+		}
+		if events, err = db.Events(ctx, "bob"); err != nil || events == nil || len(events) != 0 {
+			t.Fatalf("events of unknown username %v %v, want empty", events, err)
+		}
+	})
+}
+
+func TestPendingActions(t *testing.T) {
+	conformance(t, func(t *testing.T, ctx context.Context, db Store) {
+		actions := []Action{
+			{Type: "inscribe", BlockHash: "B2", Position: 0, Account: "keeta_b", Token: "keeta_b", Username: "bob", Timestamp: at(2)},
+			{Type: "set_cid", BlockHash: "B1", Position: 0, Account: "keeta_a", Token: "keeta_t", CID: "Qm1", Timestamp: at(1)},
+		}
+		firstSeen := map[string]time.Time{"B1": at(10), "B2": at(11), "B3": at(12)}
+		commit(t, ctx, db, func(tx Tx) error {
+			if err := tx.ReplacePendingActions(ctx, actions[:1], firstSeen); err != nil {
+				return err
+			}
+			return tx.ReplacePendingActions(ctx, actions, firstSeen)
+		})
+
+		pending, err := db.PendingActions(ctx, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pending) != 2 || pending[0].BlockHash != "B1" || pending[1].BlockHash != "B2" {
+			t.Fatalf("pending actions %+v, want B1 then B2", pending)
+		}
+		if pending[0].CID == nil || *pending[0].CID != "Qm1" || pending[0].Username != nil || !pending[0].FirstSeen.Equal(at(10)) {
+			t.Fatalf("pending action %+v, want cid Qm1, no username and first seen %v", pending[0], at(10))
+		}
+
+		if pending, err = db.PendingActions(ctx, "keeta_b"); err != nil || len(pending) != 1 || *pending[0].Username != "bob" {
+			t.Fatalf("pending actions of keeta_b %+v %v, want bob", pending, err)
+		}
+
+		// blocks without actions are pending too
+		pendingBlocks, err := db.PendingBlocks(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pendingBlocks) != len(firstSeen) {
+			t.Fatalf("pending blocks %v, want %v", pendingBlocks, firstSeen)
+		}
+		for blockHash, seen := range firstSeen {
+			if !pendingBlocks[blockHash].Equal(seen) {
+				t.Errorf("block %v first seen %v, want %v", blockHash, pendingBlocks[blockHash], seen)
+			}
+		}
+
+		commit(t, ctx, db, func(tx Tx) error { return tx.ReplacePendingActions(ctx, nil, nil) })
+		if pending, err = db.PendingActions(ctx, ""); err != nil || pending == nil || len(pending) != 0 {
+			t.Fatalf("pending actions %v %v after replacing, want empty", pending, err)
+		}
+		if pendingBlocks, err = db.PendingBlocks(ctx); err != nil || len(pendingBlocks) != 0 {
+			t.Fatalf("pending blocks %v %v after replacing, want none", pendingBlocks, err)
+		}
+	})
+}
+
+func TestDeadLetters(t *testing.T) {
+	conformance(t, func(t *testing.T, ctx context.Context, db Store) {
+		position := 1
+		operation := DeadLetter{
+			Stage: "operation", BlockHash: "B1", Position: &position, Err: errors.New("bad operation"),
+			Raw: map[string]any{"type": 0}, Context: map[string]any{"block": "B1"},
+		}
+		staple := DeadLetter{Stage: "staple", Err: errors.New("malformed vote staple"), Raw: []any{1}, Context: map[string]any{}}
+		commit(t, ctx, db, func(tx Tx) error {
+			for _, deadLetter := range []DeadLetter{operation, staple, operation} {
+				if err := tx.InsertDeadLetter(ctx, deadLetter); err != nil {
+					return err
+				}
+			}
+			return tx.QuarantineBlock(ctx, "B2", "invalid signature", map[string]any{"$hash": "B2"}, at(2))
+		})
+
+		deadLetters, err := db.UnreplayedDeadLetters(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deadLetters) != 2 || deadLetters[0].Stage != "operation" || *deadLetters[0].Position != 1 {
+			t.Fatalf("dead letters %+v, want the operation and the staple", deadLetters)
+		}
+		if string(deadLetters[0].Raw) != `{"type": 0}` && string(deadLetters[0].Raw) != `{"type":0}` {
+			t.Fatalf("raw %s, want the operation", deadLetters[0].Raw)
+		}
+
+		if err = db.SetDeadLetterError(ctx, deadLetters[1].ID, "still malformed"); err != nil {
+			t.Fatal(err)
+		}
+		commit(t, ctx, db, func(tx Tx) error { return tx.MarkDeadLetterReplayed(ctx, deadLetters[0].ID) })
+
+		if deadLetters, err = db.UnreplayedDeadLetters(ctx); err != nil || len(deadLetters) != 1 || deadLetters[0].Stage != "staple" {
+			t.Fatalf("dead letters %+v %v after replaying, want the staple", deadLetters, err)
+		}
+	})
+}
+
+func TestReset(t *testing.T) {
+	conformance(t, func(t *testing.T, ctx context.Context, db Store) {
+		hash := "B1"
+		timestamp := at(1)
+		commit(t, ctx, db, func(tx Tx) error {
+			if _, err := tx.InsertUsername(ctx, "alice", "", "keeta_token", "keeta_owner", at(1)); err != nil {
+				return err
+			}
+			return tx.SaveCursor(ctx, 5, &timestamp, &hash)
+		})
+
+		if err := db.Reset(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := db.Username(ctx, "alice"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("username error %v after reset, want ErrNotFound", err)
+		}
+		if page, _, lastBlockHash, err := db.LoadCursor(ctx); err != nil || page != 1 || lastBlockHash != nil {
+			t.Fatalf("cursor %d/%v %v after reset, want 1/nil", page, lastBlockHash, err)
+		}
+	})
+}
+
+// relay relays up to limit outbox entries of the sink and returns them.
+func relay(t *testing.T, ctx context.Context, db Store, sink string, limit int) []OutboxEntry {
+	t.Helper()
+	var entries []OutboxEntry
+	n, err := db.RelayOutbox(ctx, sink, limit, func(delivered []OutboxEntry) error {
+		entries = delivered
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(entries) {
+		t.Fatalf("relayed %d entries, delivered %d", n, len(entries))
+	}
+	return entries
+}
+
+func usernamesOf(entries []OutboxEntry) []string {
+	var usernames []string
+	for _, entry := range entries {
+		usernames = append(usernames, entry.Action.Username)
+	}
+	return usernames
+}
+
+func TestOutbox(t *testing.T) {
+	conformance(t, func(t *testing.T, ctx context.Context, db Store) {
+		inscribe := func(hash, username string, minute int) Action {
+			return Action{
+				Type: "inscribe", BlockHash: hash, Account: "keeta_" + username, Token: "keeta_" + username,
+				Username: username, Owner: "keeta_owner", Timestamp: at(minute),
+			}
+		}
+		commit(t, ctx, db, func(tx Tx) error {
+			for i, username := range []string{"alice", "bob", "carol"} {
+				if err := tx.RecordEvent(ctx, inscribe(username, username, i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		// a recorded event is not added again
+		commit(t, ctx, db, func(tx Tx) error { return tx.RecordEvent(ctx, inscribe("alice", "alice", 0)) })
+		// nor is one rolled back
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = tx.RecordEvent(ctx, inscribe("dave", "dave", 3)); err != nil {
+			t.Fatal(err)
+		}
+		if err = tx.Rollback(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		first := relay(t, ctx, db, "a", 2)
+		if got := usernamesOf(first); !reflect.DeepEqual(got, []string{"alice", "bob"}) {
+			t.Fatalf("first batch %v, want alice and bob", got)
+		}
+		if first[0].ID >= first[1].ID {
+			t.Fatalf("IDs %d and %d are not increasing", first[0].ID, first[1].ID)
+		}
+		action := first[0].Action
+		action.Timestamp = action.Timestamp.UTC()
+		if want := inscribe("alice", "alice", 0); !reflect.DeepEqual(action, want) {
+			t.Fatalf("action %+v, want %+v", first[0].Action, want)
+		}
+
+		errDeliver := errors.New("sink unavailable")
+		if _, err := db.RelayOutbox(ctx, "a", 2, func([]OutboxEntry) error { return errDeliver }); !errors.Is(err, errDeliver) {
+			t.Fatalf("relay error %v, want the delivery error", err)
+		}
+		if got := usernamesOf(relay(t, ctx, db, "a", 2)); !reflect.DeepEqual(got, []string{"carol"}) {
+			t.Fatalf("batch after failure %v, want carol again", got)
+		}
+		if got := relay(t, ctx, db, "a", 2); len(got) != 0 {
+			t.Fatalf("up to date sink got %v", got)
+		}
+		if got := usernamesOf(relay(t, ctx, db, "b", 10)); !reflect.DeepEqual(got, []string{"alice", "bob", "carol"}) {
+			t.Fatalf("other sink got %v, want everything", got)
+		}
+
+		if err := db.Reset(ctx); err != nil {
+			t.Fatal(err)
+		}
+		commit(t, ctx, db, func(tx Tx) error { return tx.RecordEvent(ctx, inscribe("alice", "alice", 0)) })
+		rebuilt := relay(t, ctx, db, "a", 10)
+		if got := usernamesOf(rebuilt); !reflect.DeepEqual(got, []string{"alice"}) {
+			t.Fatalf("batch after reset %v, want the rebuilt alice", got)
+		}
+		if rebuilt[0].ID <= first[1].ID {
+			t.Fatalf("ID %d after reset is reused", rebuilt[0].ID)
+		}
+	})
+}
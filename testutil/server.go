@@ -0,0 +1,104 @@
+// Package testutil provides a fake Keeta node and Keetools API serving scripted ledger history for end-to-end tests.
+package testutil
+
+import (
+	"encoding/json"
+	"kns-indexer/devnet"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Server is a fake Keetools and Keeta node API in one, serving a simulated ledger whose history is split into pages
+// of the requested limit, so the same history can be indexed with any page size.
+type Server struct {
+	*httptest.Server
+	*devnet.Ledger
+
+	mu       sync.Mutex
+	failures int
+	delay    time.Duration
+}
+
+// NewServer starts a server serving the history items, which is closed when the test ends.
+func NewServer(t testing.TB, history ...any) *Server {
+	t.Helper()
+
+	s := &Server{Ledger: devnet.NewLedger(time.Now, history...)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.failed() {
+			http.Error(w, "injected failure", http.StatusInternalServerError)
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(s.delayed()):
+		}
+		s.Ledger.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Fail makes the next n requests respond with 500 Internal Server Error.
+func (s *Server) Fail(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = n
+}
+
+// Delay holds every response for d or until the request is canceled, like a lagging node.
+func (s *Server) Delay(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delay = d
+}
+
+func (s *Server) delayed() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.delay
+}
+
+// failed reports whether the request has to fail and counts it.
+func (s *Server) failed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures == 0 {
+		return false
+	}
+	s.failures--
+	return true
+}
+
+// NewScenario returns a ledger to script history on, dating the first block start and every next one a minute later.
+func NewScenario(start time.Time) *devnet.Ledger {
+	next := start
+	return devnet.NewLedger(func() time.Time {
+		date := next
+		next = next.Add(time.Minute)
+		return date
+	})
+}
+
+// LoadHistory reads the history items of a fixture file shaped like a ledger history response.
+func LoadHistory(t testing.TB, path string) []any {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var response struct {
+		History []any `json:"history"`
+	}
+	if err = json.Unmarshal(data, &response); err != nil {
+		t.Fatalf("failed to decode %v: %v", path, err)
+	}
+	return response.History
+}